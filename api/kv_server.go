@@ -0,0 +1,207 @@
+package api
+
+import (
+	"KV-Store/kv"
+	pb "KV-Store/proto"
+	"KV-Store/raft"
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultScanLimit = 100
+	maxScanLimit     = 1000
+)
+
+// KVServer serves client reads and writes over gRPC, next to the HTTP API.
+// It implements the "KVServiceServer" interface generated by gRPC.
+type KVServer struct {
+	pb.UnimplementedKVServiceServer
+	store *kv.Store
+}
+
+// NewKVServer serves reads and writes from store
+func NewKVServer(store *kv.Store) *KVServer {
+	return &KVServer{store: store}
+}
+
+// checkKey rejects keys the store cannot hold
+func checkKey(key []byte) error {
+	switch {
+	case len(key) == 0:
+		return status.Error(codes.InvalidArgument, kv.ErrEmptyKey.Error())
+	case len(key) > kv.MaxKeyLen:
+		return status.Error(codes.InvalidArgument, kv.ErrKeyTooLarge.Error())
+	}
+	return nil
+}
+
+// Get reads the local store, or the leader's with linearizable set
+func (s *KVServer) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
+	if err := checkKey(req.Key); err != nil {
+		return nil, err
+	}
+	if req.Linearizable {
+		if err := s.store.ReadBarrier(); err != nil {
+			return nil, s.errorStatus(err)
+		}
+	}
+	val, version, found, err := s.store.GetVersion(string(req.Key))
+	if err != nil {
+		return nil, s.errorStatus(err)
+	}
+	if !found {
+		return &pb.GetResponse{}, nil
+	}
+	return &pb.GetResponse{Found: true, Value: []byte(val), Version: version}, nil
+}
+
+func (s *KVServer) Put(ctx context.Context, req *pb.PutRequest) (*pb.PutResponse, error) {
+	if err := checkKey(req.Key); err != nil {
+		return nil, err
+	}
+	var err error
+	switch {
+	case req.TtlMillis < 0:
+		err = kv.ErrInvalidTTL
+	case req.TtlMillis > 0:
+		err = s.store.PutWithTTL(string(req.Key), string(req.Value), time.Duration(req.TtlMillis)*time.Millisecond)
+	default:
+		err = s.store.Put(string(req.Key), string(req.Value), false)
+	}
+	if err != nil {
+		return nil, s.errorStatus(err)
+	}
+	return &pb.PutResponse{}, nil
+}
+
+func (s *KVServer) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	if err := checkKey(req.Key); err != nil {
+		return nil, err
+	}
+	if err := s.store.Put(string(req.Key), "", true); err != nil {
+		return nil, s.errorStatus(err)
+	}
+	return &pb.DeleteResponse{}, nil
+}
+
+// Scan lists live keys from the local store in key order, like /scan
+func (s *KVServer) Scan(ctx context.Context, req *pb.ScanRequest) (*pb.ScanResponse, error) {
+	start, end := string(req.Start), string(req.End)
+	if len(req.Prefix) > 0 {
+		if start != "" || end != "" {
+			return nil, status.Error(codes.InvalidArgument, "prefix cannot be combined with start or end")
+		}
+		start, end = string(req.Prefix), kv.PrefixEnd(string(req.Prefix))
+	}
+	limit := defaultScanLimit
+	if req.Limit < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit must not be negative")
+	}
+	if req.Limit > 0 {
+		limit = min(int(req.Limit), maxScanLimit)
+	}
+
+	items, more, err := s.store.Scan(start, end, limit)
+	if err != nil {
+		return nil, s.errorStatus(err)
+	}
+	resp := &pb.ScanResponse{Items: make([]*pb.KeyValue, len(items)), More: more}
+	for i, item := range items {
+		resp.Items[i] = &pb.KeyValue{Key: []byte(item.Key), Value: []byte(item.Value)}
+	}
+	return resp, nil
+}
+
+// Batch applies every op in one raft entry, all or nothing
+func (s *KVServer) Batch(ctx context.Context, req *pb.BatchRequest) (*pb.BatchResponse, error) {
+	ops := make([]kv.BatchOp, len(req.Ops))
+	for i, op := range req.Ops {
+		if err := checkKey(op.Key); err != nil {
+			return nil, err
+		}
+		ops[i] = kv.BatchOp{Key: string(op.Key), Value: string(op.Value), Delete: op.Delete}
+	}
+	if err := s.store.PutBatch(ops); err != nil {
+		return nil, s.errorStatus(err)
+	}
+	return &pb.BatchResponse{}, nil
+}
+
+// CompareAndSwap writes the value if the key holds expected, or is at version when set
+func (s *KVServer) CompareAndSwap(ctx context.Context, req *pb.CompareAndSwapRequest) (*pb.ConditionalResponse, error) {
+	if err := checkKey(req.Key); err != nil {
+		return nil, err
+	}
+	if req.Version != 0 {
+		return s.conditionalResponse(s.store.CompareAndSwapVersion(string(req.Key), req.Version, string(req.Value)))
+	}
+	return s.conditionalResponse(s.store.CompareAndSwap(string(req.Key), string(req.Expected), string(req.Value)))
+}
+
+func (s *KVServer) PutIfAbsent(ctx context.Context, req *pb.PutIfAbsentRequest) (*pb.ConditionalResponse, error) {
+	if err := checkKey(req.Key); err != nil {
+		return nil, err
+	}
+	return s.conditionalResponse(s.store.PutIfAbsent(string(req.Key), string(req.Value)))
+}
+
+func (s *KVServer) DeleteIfEquals(ctx context.Context, req *pb.DeleteIfEqualsRequest) (*pb.ConditionalResponse, error) {
+	if err := checkKey(req.Key); err != nil {
+		return nil, err
+	}
+	return s.conditionalResponse(s.store.DeleteIfEquals(string(req.Key), string(req.Expected)))
+}
+
+// conditionalResponse answers a failed condition like a success, with succeeded false
+func (s *KVServer) conditionalResponse(res kv.OpResult, err error) (*pb.ConditionalResponse, error) {
+	if err != nil && !errors.Is(err, kv.ErrConditionFailed) {
+		return nil, s.errorStatus(err)
+	}
+	return &pb.ConditionalResponse{Succeeded: err == nil, Found: res.Found, Value: []byte(res.Value), Version: res.Version}, nil
+}
+
+// Leader answers with the leader this node knows of; Unavailable while there is none
+func (s *KVServer) Leader(ctx context.Context, req *pb.LeaderRequest) (*pb.LeaderResponse, error) {
+	id, addr, ok := s.leader()
+	if !ok {
+		return nil, status.Error(codes.Unavailable, "leader not known yet")
+	}
+	return &pb.LeaderResponse{LeaderId: int32(id), LeaderAddr: addr}, nil
+}
+
+func (s *KVServer) leader() (int, string, bool) {
+	id := s.store.Raft.GetLeader()
+	addr, ok := s.store.Raft.Members().Voters[id]
+	return id, addr, id != -1 && ok
+}
+
+// errorStatus maps store errors to gRPC codes. A follower answers FailedPrecondition with a NotLeader
+// detail so the client can retry on the leader; while no leader is known the call is Unavailable.
+func (s *KVServer) errorStatus(err error) error {
+	switch {
+	case errors.Is(err, raft.ErrNotLeader):
+		leaderID, addr, ok := s.leader()
+		if !ok || leaderID == s.store.Me {
+			return status.Error(codes.Unavailable, "leader not known yet")
+		}
+		st, derr := status.New(codes.FailedPrecondition, err.Error()).
+			WithDetails(&pb.NotLeader{LeaderId: int32(leaderID), LeaderAddr: addr})
+		if derr != nil {
+			return status.Error(codes.Internal, derr.Error())
+		}
+		return st.Err()
+	case errors.Is(err, raft.ErrLeaderNotReady), errors.Is(err, raft.ErrReadTimeout):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, kv.ErrTimeout):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, kv.ErrEmptyKey), errors.Is(err, kv.ErrKeyTooLarge), errors.Is(err, kv.ErrBatchTooLarge),
+		errors.Is(err, kv.ErrInvalidTTL):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"KV-Store/kv"
+	pb "KV-Store/proto"
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRejectBadKeys(t *testing.T) {
+	s := NewKVServer(&kv.Store{})
+	ctx := context.Background()
+	for _, key := range [][]byte{nil, []byte(strings.Repeat("k", kv.MaxKeyLen+1))} {
+		calls := map[string]func() error{
+			"Get":    func() error { _, err := s.Get(ctx, &pb.GetRequest{Key: key}); return err },
+			"Put":    func() error { _, err := s.Put(ctx, &pb.PutRequest{Key: key, Value: []byte("v")}); return err },
+			"Delete": func() error { _, err := s.Delete(ctx, &pb.DeleteRequest{Key: key}); return err },
+			"Batch": func() error {
+				_, err := s.Batch(ctx, &pb.BatchRequest{Ops: []*pb.BatchOp{{Key: []byte("a")}, {Key: key}}})
+				return err
+			},
+		}
+		for name, call := range calls {
+			if code := status.Code(call()); code != codes.InvalidArgument {
+				t.Errorf("%s with a %d byte key = %v, want InvalidArgument", name, len(key), code)
+			}
+		}
+	}
+}
+
+// startCluster runs n stores with their raft and KV services in this process, storage in a temp dir
+func startCluster(t *testing.T, n int) ([]*kv.Store, []string) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "kv-api-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The stores keep running after the test, their files may still be written while we clean up
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	t.Chdir(dir)
+
+	members := make(map[int]string)
+	listeners := make([]net.Listener, n)
+	for i := range listeners {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		listeners[i], members[i] = lis, lis.Addr().String()
+	}
+	stores := make([]*kv.Store, n)
+	addrs := make([]string, n)
+	for i, lis := range listeners {
+		store, err := kv.NewKVStore(members, i, kv.DefaultOptions())
+		if err != nil {
+			t.Fatalf("NewKVStore %d: %v", i, err)
+		}
+		server := grpc.NewServer()
+		pb.RegisterRaftServiceServer(server, NewRaftServer(store.Raft))
+		pb.RegisterKVServiceServer(server, NewKVServer(store))
+		go func() { _ = server.Serve(lis) }()
+		t.Cleanup(server.Stop)
+		stores[i], addrs[i] = store, members[i]
+	}
+	return stores, addrs
+}
+
+// waitForLeader returns the index of the leader once it accepts writes
+func waitForLeader(t *testing.T, stores []*kv.Store) int {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		for i, store := range stores {
+			if store.Raft.GetLeader() != i {
+				continue
+			}
+			if _, err := NewKVServer(store).Put(context.Background(), &pb.PutRequest{Key: []byte("ready"), Value: []byte("1")}); err == nil {
+				return i
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("no leader accepted a write within 10s")
+	return -1
+}
+
+// A follower fails writes and linearizable reads with FailedPrecondition and a NotLeader detail
+// naming the leader, and binary keys and values round-trip through every call on the leader
+func TestKVServerCluster(t *testing.T) {
+	stores, addrs := startCluster(t, 3)
+	leader := waitForLeader(t, stores)
+	follower := (leader + 1) % len(stores)
+	ctx := context.Background()
+
+	fs := NewKVServer(stores[follower])
+	for name, call := range map[string]func() error{
+		"Put":    func() error { _, err := fs.Put(ctx, &pb.PutRequest{Key: []byte("k"), Value: []byte("v")}); return err },
+		"Delete": func() error { _, err := fs.Delete(ctx, &pb.DeleteRequest{Key: []byte("k")}); return err },
+		"Batch": func() error {
+			_, err := fs.Batch(ctx, &pb.BatchRequest{Ops: []*pb.BatchOp{{Key: []byte("k")}}})
+			return err
+		},
+		"Get": func() error {
+			_, err := fs.Get(ctx, &pb.GetRequest{Key: []byte("k"), Linearizable: true})
+			return err
+		},
+		"CompareAndSwap": func() error {
+			_, err := fs.CompareAndSwap(ctx, &pb.CompareAndSwapRequest{Key: []byte("k"), Expected: []byte("v")})
+			return err
+		},
+	} {
+		st := status.Convert(call())
+		if st.Code() != codes.FailedPrecondition {
+			t.Errorf("%s on a follower = %v, want FailedPrecondition", name, st.Err())
+			continue
+		}
+		var nl *pb.NotLeader
+		for _, d := range st.Details() {
+			if d, ok := d.(*pb.NotLeader); ok {
+				nl = d
+			}
+		}
+		if nl == nil || nl.LeaderAddr != addrs[leader] || int(nl.LeaderId) != leader {
+			t.Errorf("%s on a follower: NotLeader detail %v, want leader %d at %s", name, nl, leader, addrs[leader])
+		}
+	}
+
+	ls := NewKVServer(stores[leader])
+	binary := func(tag byte) ([]byte, []byte) {
+		return []byte{'b', tag, 0, '&', '=', 0xff, '/'}, []byte{0, tag, 0xfe, '\n', 0, '%'}
+	}
+	k1, v1 := binary(1)
+	if _, err := ls.Put(ctx, &pb.PutRequest{Key: k1, Value: v1}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	k2, v2 := binary(2)
+	k3, v3 := binary(3)
+	if _, err := ls.Batch(ctx, &pb.BatchRequest{Ops: []*pb.BatchOp{{Key: k2, Value: v2}, {Key: k3, Value: v3}}}); err != nil {
+		t.Fatalf("Batch: %v", err)
+	}
+	for _, pair := range [][2][]byte{{k1, v1}, {k2, v2}, {k3, v3}} {
+		resp, err := ls.Get(ctx, &pb.GetRequest{Key: pair[0], Linearizable: true})
+		if err != nil || !resp.Found || !bytes.Equal(resp.Value, pair[1]) || resp.Version == 0 {
+			t.Errorf("Get(%q) = %v, %v, want %q", pair[0], resp, err, pair[1])
+		}
+	}
+	resp, err := ls.Scan(ctx, &pb.ScanRequest{Prefix: []byte("b")})
+	if err != nil || len(resp.Items) != 3 || resp.More {
+		t.Fatalf("Scan = %v, %v, want 3 items", resp, err)
+	}
+	for i, want := range [][2][]byte{{k1, v1}, {k2, v2}, {k3, v3}} {
+		if !bytes.Equal(resp.Items[i].Key, want[0]) || !bytes.Equal(resp.Items[i].Value, want[1]) {
+			t.Errorf("Scan item %d = %q=%q, want %q=%q", i, resp.Items[i].Key, resp.Items[i].Value, want[0], want[1])
+		}
+	}
+
+	if _, err := ls.Batch(ctx, &pb.BatchRequest{Ops: []*pb.BatchOp{{Key: k1, Delete: true}}}); err != nil {
+		t.Fatalf("Batch delete: %v", err)
+	}
+	if resp, err := ls.Get(ctx, &pb.GetRequest{Key: k1, Linearizable: true}); err != nil || resp.Found {
+		t.Errorf("Get after delete = %v, %v, want not found", resp, err)
+	}
+}
@@ -51,6 +51,8 @@ func (s *RaftServer) RequestVote(ctx context.Context, req *pb.RequestVoteRequest
 		CandidateId:  int(req.CandidateId),
 		LastLogIndex: int(req.LastLogIndex),
 		LastLogTerm:  int(req.LastLogTerm),
+
+		LeadershipTransfer: req.LeadershipTransfer,
 	}
 	var reply raft.RequestVoteReply
 
@@ -62,6 +64,29 @@ func (s *RaftServer) RequestVote(ctx context.Context, req *pb.RequestVoteRequest
 	}, nil
 }
 
+func (s *RaftServer) PreVote(ctx context.Context, req *pb.PreVoteRequest) (*pb.PreVoteResponse, error) {
+	if err := s.ensureReady(ctx); err != nil {
+		return nil, err
+	}
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be nil")
+	}
+	args := &raft.PreVoteArgs{
+		Term:         int(req.Term),
+		CandidateId:  int(req.CandidateId),
+		LastLogIndex: int(req.LastLogIndex),
+		LastLogTerm:  int(req.LastLogTerm),
+	}
+	var reply raft.PreVoteReply
+
+	s.rf.PreVote(args, &reply)
+
+	return &pb.PreVoteResponse{
+		Term:        int32(reply.Term),
+		VoteGranted: reply.VoteGranted,
+	}, nil
+}
+
 func (s *RaftServer) AppendEntries(ctx context.Context, req *pb.AppendEntriesRequest) (*pb.AppendEntriesResponse, error) {
 	if err := s.ensureReady(ctx); err != nil {
 		return nil, err
@@ -76,6 +101,7 @@ func (s *RaftServer) AppendEntries(ctx context.Context, req *pb.AppendEntriesReq
 			Term:    int(e.Term),
 			Index:   int(e.Index),
 			Command: e.Command,
+			Type:    raft.EntryType(e.Type),
 		})
 	}
 
@@ -102,3 +128,47 @@ func (s *RaftServer) AppendEntries(ctx context.Context, req *pb.AppendEntriesReq
 		ConflictTerm:  int32(reply.ConflictTerm),
 	}, nil
 }
+
+func (s *RaftServer) InstallSnapshot(ctx context.Context, req *pb.InstallSnapshotRequest) (*pb.InstallSnapshotResponse, error) {
+	if err := s.ensureReady(ctx); err != nil {
+		return nil, err
+	}
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be nil")
+	}
+	args := &raft.InstallSnapshotArgs{
+		Term:              int(req.Term),
+		LeaderId:          int(req.LeaderId),
+		LastIncludedIndex: int(req.LastIncludedIndex),
+		LastIncludedTerm:  int(req.LastIncludedTerm),
+		Data:              req.Data,
+		Config:            raft.MembersFromProto(req.Members),
+	}
+	var reply raft.InstallSnapshotReply
+
+	s.rf.InstallSnapshot(args, &reply)
+
+	return &pb.InstallSnapshotResponse{
+		Term: int32(reply.Term),
+	}, nil
+}
+
+func (s *RaftServer) TimeoutNow(ctx context.Context, req *pb.TimeoutNowRequest) (*pb.TimeoutNowResponse, error) {
+	if err := s.ensureReady(ctx); err != nil {
+		return nil, err
+	}
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "request cannot be nil")
+	}
+	args := &raft.TimeoutNowArgs{
+		Term:     int(req.Term),
+		LeaderId: int(req.LeaderId),
+	}
+	var reply raft.TimeoutNowReply
+
+	s.rf.TimeoutNow(args, &reply)
+
+	return &pb.TimeoutNowResponse{
+		Term: int32(reply.Term),
+	}, nil
+}
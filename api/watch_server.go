@@ -0,0 +1,81 @@
+package api
+
+import (
+	"KV-Store/kv"
+	pb "KV-Store/proto"
+	"context"
+	"errors"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// WatchStartHeader is the response header holding the first index a watch delivers
+const WatchStartHeader = "watch-start-index"
+
+// WatchServer streams the changes applied on this node to gRPC clients.
+// It implements the "WatchServiceServer" interface generated by gRPC.
+type WatchServer struct {
+	pb.UnimplementedWatchServiceServer
+	store *kv.Store
+}
+
+// NewWatchServer serves watches from store
+func NewWatchServer(store *kv.Store) *WatchServer {
+	return &WatchServer{store: store}
+}
+
+// Watch sends one WatchResponse per raft entry that changed a watched key until the client goes away.
+// A watch resuming from an index the history no longer holds fails with OutOfRange,
+// a client that cannot keep up is cut off with ResourceExhausted and may resume after its last index.
+func (s *WatchServer) Watch(req *pb.WatchRequest, stream grpc.ServerStreamingServer[pb.WatchResponse]) error {
+	if s == nil || s.store == nil {
+		return status.Error(codes.FailedPrecondition, "watch service not initialized")
+	}
+	w, err := s.store.Watch(string(req.Key), req.Prefix, req.FromIndex)
+	if err != nil {
+		return watchStatus(err)
+	}
+	defer w.Close()
+	// Tell the client where the watch starts so it can resume there even before the first change
+	md := metadata.Pairs(WatchStartHeader, strconv.FormatUint(w.From(), 10))
+	if err := stream.SendHeader(md); err != nil {
+		return err
+	}
+
+	ctx := stream.Context()
+	for {
+		events, err := w.Next(ctx)
+		if err != nil {
+			return watchStatus(err)
+		}
+		resp := &pb.WatchResponse{Index: events[0].Index}
+		for _, e := range events {
+			ev := &pb.WatchEvent{Type: pb.WatchEvent_PUT, Key: []byte(e.Key), Value: []byte(e.Value)}
+			if e.Type == kv.EventDelete {
+				ev.Type = pb.WatchEvent_DELETE
+			}
+			resp.Events = append(resp.Events, ev)
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+func watchStatus(err error) error {
+	switch {
+	case errors.Is(err, kv.ErrWatchCompacted):
+		return status.Error(codes.OutOfRange, err.Error())
+	case errors.Is(err, kv.ErrWatchLagging):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, "watch canceled by client")
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, "watch deadline exceeded")
+	}
+	return status.Error(codes.Internal, err.Error())
+}
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"KV-Store/pkg/client"
+	"bytes"
 	"fmt"
 	"io"
 	"net/http"
@@ -13,6 +15,7 @@ import (
 var (
 	baseURL string
 	timeout time.Duration
+	nodes   []string
 )
 
 var rootCmd = &cobra.Command{
@@ -26,6 +29,11 @@ var rootCmd = &cobra.Command{
 				baseURL = config.ServerURL
 			}
 		}
+		if !cmd.Flags().Changed("nodes") {
+			if config, err := loadConfig(); err == nil && len(config.Nodes) > 0 {
+				nodes = config.Nodes
+			}
+		}
 		if !cmd.Flags().Changed("timeout") {
 			if config, err := loadConfig(); err == nil {
 				timeout = config.Timeout
@@ -44,16 +52,44 @@ func Execute() {
 func init() {
 	rootCmd.PersistentFlags().StringVar(&baseURL, "addr", "http://localhost:8080", "Server address")
 	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 30*time.Second, "Request timeout")
+	rootCmd.PersistentFlags().StringSliceVar(&nodes, "nodes", defaultNodes, "gRPC addresses of the cluster nodes, used by get, put, delete, scan, batch and cas")
+}
+
+var defaultNodes = []string{"localhost:5001", "localhost:5002", "localhost:5003"}
+
+// newClient creates a gRPC client for the cluster; it finds the leader and retries through elections on its own
+func newClient() (*client.Client, error) {
+	opts := client.DefaultOptions()
+	opts.Timeout = timeout
+	return client.New(nodes, opts)
+}
+
+// serverError is a response with an error status; commands that expect one can inspect the body
+type serverError struct {
+	Status int
+	Body   string
+}
+
+func (e *serverError) Error() string {
+	return fmt.Sprintf("server error (%d): %s", e.Status, e.Body)
 }
 
 // doRequest performs HTTP request to the KV-Store server
 func doRequest(method, url string) (string, error) {
+	return doRequestBody(method, url, "", nil)
+}
+
+// doRequestBody performs an HTTP request carrying body, sent with the given content type
+func doRequestBody(method, url, contentType string, body []byte) (string, error) {
 	client := &http.Client{Timeout: timeout}
-	
-	req, err := http.NewRequest(method, url, nil)
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %v", err)
 	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -61,14 +97,14 @@ func doRequest(method, url string) (string, error) {
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return "", fmt.Errorf("failed to read response: %v", err)
 	}
 
 	if resp.StatusCode >= 400 {
-		return "", fmt.Errorf("server error (%d): %s", resp.StatusCode, string(body))
+		return "", &serverError{Status: resp.StatusCode, Body: string(respBody)}
 	}
 
-	return string(body), nil
+	return string(respBody), nil
 }
\ No newline at end of file
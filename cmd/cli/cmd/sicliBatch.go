@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"KV-Store/pkg/client"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+type batchOp struct {
+	Op    string `json:"op"`
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+var batchCmd = &cobra.Command{
+	Use:   "batch <file>",
+	Short: "Apply a list of puts and deletes atomically",
+	Long: `Apply every put and delete in a JSON file as one atomic write: either all of them are applied or none.
+The file holds a list of operations, "-" reads it from stdin:
+
+  [{"op": "put", "key": "user:1", "value": "alice"},
+   {"op": "delete", "key": "user:2"}]`,
+	Example: `  sicli batch ops.json
+  cat ops.json | sicli batch -`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var data []byte
+		var err error
+		if args[0] == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(args[0])
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read batch: %v", err)
+		}
+
+		// Validate locally so a typo does not cost a round trip
+		var ops []batchOp
+		if err := json.Unmarshal(data, &ops); err != nil {
+			return fmt.Errorf("batch must be a JSON list of {op, key, value}: %v", err)
+		}
+		for i, op := range ops {
+			if op.Op != "put" && op.Op != "delete" {
+				return fmt.Errorf("op %d: op must be put or delete, got %q", i, op.Op)
+			}
+		}
+
+		batch := make([]client.Op, len(ops))
+		for i, op := range ops {
+			batch[i] = client.Op{Key: op.Key, Value: []byte(op.Value), Delete: op.Op == "delete"}
+		}
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+
+		if err := c.Batch(cmd.Context(), batch); err != nil {
+			return err
+		}
+
+		fmt.Printf("---Success: %d ops---\n", len(ops))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(batchCmd)
+}
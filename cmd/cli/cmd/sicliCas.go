@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"KV-Store/pkg/client"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	casExpected string
+	casVersion  uint64
+	casAbsent   bool
+	casDelete   bool
+)
+
+var casCmd = &cobra.Command{
+	Use:   "cas <key> [value]",
+	Short: "Write a key only if it matches an expected value, version or absence",
+	Long: `Conditionally write a key. The condition is checked when the write is applied, so concurrent
+writers cannot interleave between check and write:
+
+  --expected   the key must currently hold this value
+  --version    the key must be at this version (the raft index that wrote it)
+  --absent     the key must not exist
+  --delete     delete the key instead of writing a value (requires --expected)`,
+	Example: `  sicli cas counter 2 --expected 1
+  sicli cas counter 2 --version 1042
+  sicli cas lock:job owner-a --absent
+  sicli cas lock:job --delete --expected owner-a`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		expectedSet := cmd.Flags().Changed("expected")
+		versionSet := cmd.Flags().Changed("version")
+		conditions := 0
+		for _, set := range []bool{expectedSet, versionSet, casAbsent} {
+			if set {
+				conditions++
+			}
+		}
+		if conditions != 1 {
+			return errors.New("exactly one of --expected, --version and --absent is required")
+		}
+		if casDelete != (len(args) == 1) {
+			return errors.New("pass a value to write, or --delete without one")
+		}
+		if casDelete && !expectedSet {
+			return errors.New("--delete requires --expected")
+		}
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+
+		ctx := cmd.Context()
+		var res client.CondResult
+		switch {
+		case casDelete:
+			res, err = c.DeleteIfEquals(ctx, args[0], []byte(casExpected))
+		case casAbsent:
+			res, err = c.PutIfAbsent(ctx, args[0], []byte(args[1]))
+		case versionSet:
+			res, err = c.CompareAndSwapVersion(ctx, args[0], casVersion, []byte(args[1]))
+		default:
+			res, err = c.CompareAndSwap(ctx, args[0], []byte(casExpected), []byte(args[1]))
+		}
+		if err != nil {
+			return err
+		}
+
+		if !res.Succeeded {
+			if !res.Found {
+				return errors.New("condition failed: key does not exist")
+			}
+			return fmt.Errorf("condition failed: current value %q (version %d)", res.Value, res.Version)
+		}
+		if casDelete {
+			fmt.Println("---Success: deleted---")
+		} else {
+			fmt.Printf("---Success: version %d---\n", res.Version)
+		}
+		return nil
+	},
+}
+
+func init() {
+	casCmd.Flags().StringVar(&casExpected, "expected", "", "Value the key must currently hold")
+	casCmd.Flags().Uint64Var(&casVersion, "version", 0, "Version the key must currently be at")
+	casCmd.Flags().BoolVar(&casAbsent, "absent", false, "Only write if the key does not exist")
+	casCmd.Flags().BoolVar(&casDelete, "delete", false, "Delete the key instead of writing a value")
+	rootCmd.AddCommand(casCmd)
+}
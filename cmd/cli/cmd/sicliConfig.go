@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -13,12 +14,14 @@ import (
 type Config struct {
 	ServerURL string        `json:"server_url"`
 	Timeout   time.Duration `json:"timeout"`
+	Nodes     []string      `json:"nodes,omitempty"`
 }
 
 var (
 	configFile   string
 	setServerURL string
 	setTimeout   time.Duration
+	setNodes     []string
 )
 
 var configCmd = &cobra.Command{
@@ -31,7 +34,8 @@ var configSetCmd = &cobra.Command{
 	Use:   "set",
 	Short: "Set configuration values",
 	Example: `  sicli config set --server-url http://localhost:8081
-  sicli config set --timeout 60s`,
+  sicli config set --timeout 60s
+  sicli config set --nodes kv-0:5001,kv-1:5001,kv-2:5001`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		config, err := loadConfig()
 		if err != nil {
@@ -47,6 +51,9 @@ var configSetCmd = &cobra.Command{
 		if setTimeout > 0 {
 			config.Timeout = setTimeout
 		}
+		if len(setNodes) > 0 {
+			config.Nodes = setNodes
+		}
 
 		err = saveConfig(config)
 		if err != nil {
@@ -73,6 +80,10 @@ var configShowCmd = &cobra.Command{
 
 		fmt.Printf("Server URL: %s\n", config.ServerURL)
 		fmt.Printf("Timeout: %s\n", config.Timeout)
+		if len(config.Nodes) == 0 {
+			config.Nodes = defaultNodes
+		}
+		fmt.Printf("Nodes: %s\n", strings.Join(config.Nodes, ","))
 		fmt.Printf("Config file: %s\n", getConfigPath())
 		return nil
 	},
@@ -81,6 +92,7 @@ var configShowCmd = &cobra.Command{
 func init() {
 	configSetCmd.Flags().StringVar(&setServerURL, "server-url", "", "Set server URL")
 	configSetCmd.Flags().DurationVar(&setTimeout, "timeout", 0, "Set request timeout")
+	configSetCmd.Flags().StringSliceVar(&setNodes, "nodes", nil, "Set the gRPC addresses of the cluster nodes")
 
 	configCmd.AddCommand(configSetCmd)
 	configCmd.AddCommand(configShowCmd)
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"net/url"
 
 	"github.com/spf13/cobra"
 )
@@ -12,16 +11,19 @@ var deleteCmd = &cobra.Command{
 	Short: "Delete a key from the KV store",
 	Long:  `Remove a key and its associated value from the KV store.`,
 	Example: `  sicli delete mykey
-  sicli delete mykey --addr http://localhost:8081`,
+  sicli delete mykey --nodes localhost:5002`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		key := args[0]
-		requestURL := fmt.Sprintf("%s/delete?key=%s", baseURL, url.QueryEscape(key))
-
-		_, err := doRequest("DELETE", requestURL)
+		c, err := newClient()
 		if err != nil {
 			return err
 		}
+		defer c.Close()
+
+		if err := c.Delete(cmd.Context(), key); err != nil {
+			return err
+		}
 
 		fmt.Println("----Deleted---")
 		return nil
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"net/url"
 
 	"github.com/spf13/cobra"
 )
@@ -10,20 +9,27 @@ import (
 var getCmd = &cobra.Command{
 	Use:   "get <key>",
 	Short: "Get a value from the KV store",
-	Long:  `Retrieve a value from the KV store by its key.`,
+	Long:  `Retrieve a value from the KV store by its key. The read goes through the leader, so it sees every acknowledged write.`,
 	Example: `  sicli get mykey
-  sicli get mykey --addr http://localhost:8081`,
+  sicli get mykey --nodes localhost:5002`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		key := args[0]
-		requestURL := fmt.Sprintf("%s/get?key=%s", baseURL, url.QueryEscape(key))
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer c.Close()
 
-		val, err := doRequest("GET", requestURL)
+		val, found, err := c.Get(cmd.Context(), key)
 		if err != nil {
 			return err
 		}
+		if !found {
+			return fmt.Errorf("key %q not found", key)
+		}
 
-		fmt.Println(val)
+		fmt.Println(string(val))
 		return nil
 	},
 }
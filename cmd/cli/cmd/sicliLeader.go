@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+var leaderCmd = &cobra.Command{
+	Use:   "leader",
+	Short: "Manage cluster leadership",
+	Long:  `Commands for inspecting and moving Raft leadership.`,
+}
+
+var leaderTransferCmd = &cobra.Command{
+	Use:   "transfer <id>",
+	Short: "Transfer leadership to another node",
+	Long:  `Hand Raft leadership to the given node, e.g. before draining the current leader for an upgrade.`,
+	Example: `  sicli leader transfer 2
+  sicli leader transfer 1 --addr http://localhost:8081`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid node id %q", args[0])
+		}
+		requestURL := fmt.Sprintf("%s/admin/leader/transfer?id=%d", baseURL, id)
+
+		_, err = doRequest("POST", requestURL)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("---Leadership transferred to node %d---\n", id)
+		return nil
+	},
+}
+
+func init() {
+	leaderCmd.AddCommand(leaderTransferCmd)
+	rootCmd.AddCommand(leaderCmd)
+}
@@ -62,7 +62,7 @@ func init() {
 func displayFormattedMetrics(metrics, filter string) error {
 	lines := strings.Split(metrics, "\n")
 	
-	fmt.Println("=== KV-Store Cluster Metrics ===\n")
+	fmt.Print("=== KV-Store Cluster Metrics ===\n\n")
 	
 	categories := map[string][]string{
 		"Raft Metrics": {},
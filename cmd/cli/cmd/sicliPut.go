@@ -2,7 +2,7 @@ package cmd
 
 import (
 	"fmt"
-	"net/url"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -12,30 +12,31 @@ var putCmd = &cobra.Command{
 	Short: "Put a key-value pair into the KV store",
 	Long:  `Store a key-value pair in the KV store.`,
 	Example: `  sicli put mykey myvalue
-  sicli put mykey myvalue --addr http://localhost:8081
-  sicli put "my key" "my value"`,
+  sicli put mykey myvalue --nodes localhost:5002
+  sicli put "my key" "my value"
+  sicli put session:42 token --ttl 30m`,
 	Args: cobra.ExactArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		key := args[0]
 		value := args[1]
-		
-		requestURL := fmt.Sprintf(
-			"%s/put?key=%s&val=%s",
-			baseURL,
-			url.QueryEscape(key),
-			url.QueryEscape(value),
-		)
-
-		_, err := doRequest("POST", requestURL)
+		c, err := newClient()
 		if err != nil {
 			return err
 		}
+		defer c.Close()
+
+		if err := c.PutWithTTL(cmd.Context(), key, []byte(value), putTTL); err != nil {
+			return err
+		}
 
 		fmt.Println("---Success---")
 		return nil
 	},
 }
 
+var putTTL time.Duration
+
 func init() {
+	putCmd.Flags().DurationVar(&putTTL, "ttl", 0, "Expire the key after this long (e.g. 30s, 10m)")
 	rootCmd.AddCommand(putCmd)
 }
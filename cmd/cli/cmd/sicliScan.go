@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"KV-Store/pkg/client"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	scanPrefix string
+	scanStart  string
+	scanEnd    string
+	scanLimit  int
+	scanCursor string
+	scanAll    bool
+)
+
+var scanCmd = &cobra.Command{
+	Use:   "scan",
+	Short: "List key-value pairs by prefix or key range",
+	Long:  `List live key-value pairs in key order, selected by prefix or by a [start, end) key range.`,
+	Example: `  sicli scan --prefix user:42:
+  sicli scan --start a --end m --limit 10
+  sicli scan --prefix session: --all`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		start, end := scanStart, scanEnd
+		if scanPrefix != "" {
+			if start != "" || end != "" {
+				return errors.New("--prefix cannot be combined with --start or --end")
+			}
+			start, end = scanPrefix, client.PrefixEnd(scanPrefix)
+		}
+		// The cursor is the last key of the previous page, resume right after it
+		if scanCursor != "" {
+			last, err := base64.RawURLEncoding.DecodeString(scanCursor)
+			if err != nil {
+				return errors.New("invalid cursor")
+			}
+			if resume := string(last) + "\x00"; resume > start {
+				start = resume
+			}
+		}
+
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+
+		for {
+			items, more, err := c.Scan(cmd.Context(), start, end, scanLimit)
+			if err != nil {
+				return err
+			}
+
+			for _, item := range items {
+				fmt.Printf("%s\t%s\n", item.Key, item.Value)
+			}
+
+			if !more || len(items) == 0 {
+				return nil
+			}
+			last := items[len(items)-1].Key
+			if !scanAll {
+				fmt.Printf("---More results: --cursor %s---\n", base64.RawURLEncoding.EncodeToString([]byte(last)))
+				return nil
+			}
+			start = last + "\x00"
+		}
+	},
+}
+
+func init() {
+	scanCmd.Flags().StringVar(&scanPrefix, "prefix", "", "Only list keys starting with this prefix")
+	scanCmd.Flags().StringVar(&scanStart, "start", "", "First key of the range (inclusive)")
+	scanCmd.Flags().StringVar(&scanEnd, "end", "", "Last key of the range (exclusive)")
+	scanCmd.Flags().IntVar(&scanLimit, "limit", 100, "Maximum number of keys per page")
+	scanCmd.Flags().StringVar(&scanCursor, "cursor", "", "Resume from the cursor printed by a previous scan")
+	scanCmd.Flags().BoolVar(&scanAll, "all", false, "Follow cursors and print every page")
+	rootCmd.AddCommand(scanCmd)
+}
@@ -1,44 +1,87 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
+	"strconv"
+	"time"
 
 	"KV-Store/kv"
+	"KV-Store/raft"
 )
 
-func handleGet(store *kv.Store) http.HandlerFunc {
+// handleGet serves local reads by default; consistency=linearizable goes through the leader (lease or ReadIndex).
+// X-Version carries the raft index that wrote the value, for /cas?version=.
+func handleGet(store *kv.Store, nodeID int, peerTemplate string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		key := r.URL.Query().Get("key")
-		val, found := store.Get(key)
+
+		switch r.URL.Query().Get("consistency") {
+		case "", "local":
+		case "linearizable":
+			err := store.ReadBarrier()
+			if errors.Is(err, raft.ErrNotLeader) {
+				proxyToLeader(w, r, store, nodeID, peerTemplate)
+				return
+			}
+			if errors.Is(err, raft.ErrLeaderNotReady) {
+				http.Error(w, "Cluster in leadership transition", http.StatusServiceUnavailable)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		default:
+			http.Error(w, "consistency must be local or linearizable", http.StatusBadRequest)
+			return
+		}
+		val, version, found, err := store.GetVersion(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 		if !found {
 			http.Error(w, "Key not found", http.StatusNotFound)
 			return
 		}
+		w.Header().Set("X-Version", strconv.FormatUint(version, 10))
 		w.Write([]byte(val))
 	}
 }
 
+// handlePut writes val for the key: /put?key=k&val=v, with an optional ttl such as 30s after which
+// the key reads as deleted
 func handlePut(store *kv.Store, nodeID int, peerTemplate string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		key := r.URL.Query().Get("key")
 		val := r.URL.Query().Get("val")
 
-		err := store.Put(key, val, false)
+		var err error
+		if r.URL.Query().Has("ttl") {
+			ttl, perr := time.ParseDuration(r.URL.Query().Get("ttl"))
+			if perr != nil || ttl <= 0 {
+				http.Error(w, "ttl must be a positive duration such as 30s", http.StatusBadRequest)
+				return
+			}
+			err = store.PutWithTTL(key, val, ttl)
+		} else {
+			err = store.Put(key, val, false)
+		}
 		if err != nil {
 			if err.Error() == "not leader" {
-				leaderID := store.Raft.GetLeader()
-				if leaderID == -1 {
-					http.Error(w, "Leader not found", http.StatusNotFound)
-					return
-				}
-				if leaderID == nodeID {
-					http.Error(w, "Cluster in leadership transition", http.StatusServiceUnavailable)
-					return
-				}
-				leaderURL := fmt.Sprintf(peerTemplate, leaderID)
-				targetURL := fmt.Sprintf("%s/put?key=%s&val=%s", leaderURL, key, val)
-				forwardToLeader(w, r, targetURL)
+				proxyToLeader(w, r, store, nodeID, peerTemplate)
+				return
+			}
+			if errors.Is(err, kv.ErrKeyTooLarge) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -48,6 +91,71 @@ func handlePut(store *kv.Store, nodeID int, peerTemplate string) http.HandlerFun
 	}
 }
 
+const (
+	defaultScanLimit = 100
+	maxScanLimit     = 1000
+
+	maxBatchBody = 16 * 1024 * 1024 // JSON encoding of a batch, kv.PutBatch enforces the real limit
+)
+
+type scanResponse struct {
+	Items      []kv.KV `json:"items"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// handleScan lists live keys from the local store in key order.
+// Either prefix or a [start, end) range selects the keys; pass next_cursor back as cursor for the next page.
+func handleScan(store *kv.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		start, end := q.Get("start"), q.Get("end")
+		if prefix := q.Get("prefix"); prefix != "" {
+			if start != "" || end != "" {
+				http.Error(w, "prefix cannot be combined with start or end", http.StatusBadRequest)
+				return
+			}
+			start, end = prefix, kv.PrefixEnd(prefix)
+		}
+
+		limit := defaultScanLimit
+		if l := q.Get("limit"); l != "" {
+			n, err := strconv.Atoi(l)
+			if err != nil || n <= 0 {
+				http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			limit = min(n, maxScanLimit)
+		}
+
+		// The cursor is the last key of the previous page, resume right after it
+		if c := q.Get("cursor"); c != "" {
+			last, err := base64.RawURLEncoding.DecodeString(c)
+			if err != nil {
+				http.Error(w, "invalid cursor", http.StatusBadRequest)
+				return
+			}
+			if resume := string(last) + "\x00"; resume > start {
+				start = resume
+			}
+		}
+
+		items, more, err := store.Scan(start, end, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp := scanResponse{Items: items}
+		if resp.Items == nil {
+			resp.Items = []kv.KV{}
+		}
+		if more {
+			resp.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(items[len(items)-1].Key))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
 func handleDelete(store *kv.Store, nodeID int, peerTemplate string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		key := r.URL.Query().Get("key")
@@ -59,18 +167,11 @@ func handleDelete(store *kv.Store, nodeID int, peerTemplate string) http.Handler
 		err := store.Put(key, "", true)
 		if err != nil {
 			if err.Error() == "not leader" {
-				leaderID := store.Raft.GetLeader()
-				if leaderID == -1 {
-					http.Error(w, "Leader not found", http.StatusNotFound)
-					return
-				}
-				if leaderID == nodeID {
-					http.Error(w, "Cluster in leadership transition", http.StatusServiceUnavailable)
-					return
-				}
-				leaderURL := fmt.Sprintf(peerTemplate, leaderID)
-				targetURL := fmt.Sprintf("%s/delete?key=%s", leaderURL, key)
-				forwardToLeader(w, r, targetURL)
+				proxyToLeader(w, r, store, nodeID, peerTemplate)
+				return
+			}
+			if errors.Is(err, kv.ErrKeyTooLarge) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -79,3 +180,329 @@ func handleDelete(store *kv.Store, nodeID int, peerTemplate string) http.Handler
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
+
+// casResponse reports the outcome of a conditional write and the key as it is afterwards
+type casResponse struct {
+	Succeeded bool   `json:"succeeded"`
+	Found     bool   `json:"found"`
+	Value     string `json:"value,omitempty"`
+	Version   uint64 `json:"version,omitempty"`
+}
+
+// handleCAS writes val only if the key holds expected, or is at version:
+// /cas?key=k&val=new&expected=old or /cas?key=k&val=new&version=42
+func handleCAS(store *kv.Store, nodeID int, peerTemplate string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		key, val := q.Get("key"), q.Get("val")
+		if q.Has("expected") == q.Has("version") {
+			http.Error(w, "exactly one of expected and version is required", http.StatusBadRequest)
+			return
+		}
+		var res kv.OpResult
+		var err error
+		if q.Has("version") {
+			version, perr := strconv.ParseUint(q.Get("version"), 10, 64)
+			if perr != nil || version == 0 {
+				http.Error(w, "version must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			res, err = store.CompareAndSwapVersion(key, version, val)
+		} else {
+			res, err = store.CompareAndSwap(key, q.Get("expected"), val)
+		}
+		writeConditionalResult(w, r, store, nodeID, peerTemplate, res, err)
+	}
+}
+
+// handlePutIfAbsent writes val only if the key does not exist: /put-if-absent?key=k&val=v
+func handlePutIfAbsent(store *kv.Store, nodeID int, peerTemplate string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		res, err := store.PutIfAbsent(r.URL.Query().Get("key"), r.URL.Query().Get("val"))
+		writeConditionalResult(w, r, store, nodeID, peerTemplate, res, err)
+	}
+}
+
+// handleDeleteIfEquals deletes the key only if it holds expected: /delete-if-equals?key=k&expected=v
+func handleDeleteIfEquals(store *kv.Store, nodeID int, peerTemplate string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !r.URL.Query().Has("expected") {
+			http.Error(w, "expected is required", http.StatusBadRequest)
+			return
+		}
+		res, err := store.DeleteIfEquals(r.URL.Query().Get("key"), r.URL.Query().Get("expected"))
+		writeConditionalResult(w, r, store, nodeID, peerTemplate, res, err)
+	}
+}
+
+// writeConditionalResult answers 200 when the write was applied and 409 with the current value when
+// its condition did not hold; both bodies are a casResponse
+func writeConditionalResult(w http.ResponseWriter, r *http.Request, store *kv.Store, nodeID int, peerTemplate string, res kv.OpResult, err error) {
+	status := http.StatusOK
+	switch {
+	case err == nil:
+	case errors.Is(err, kv.ErrConditionFailed):
+		status = http.StatusConflict
+	case errors.Is(err, raft.ErrNotLeader):
+		proxyToLeader(w, r, store, nodeID, peerTemplate)
+		return
+	case errors.Is(err, kv.ErrEmptyKey), errors.Is(err, kv.ErrKeyTooLarge):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(casResponse{
+		Succeeded: err == nil,
+		Found:     res.Found,
+		Value:     res.Value,
+		Version:   res.Version,
+	})
+}
+
+// batchOp is one element of the JSON list /batch accepts
+type batchOp struct {
+	Op    string `json:"op"` // "put" or "delete"
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+// handleBatch applies a JSON list of puts and deletes atomically through a single raft entry:
+// [{"op":"put","key":"a","value":"1"},{"op":"delete","key":"b"}]
+func handleBatch(store *kv.Store, nodeID int, peerTemplate string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "batch must be a POST", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBatchBody))
+		if err != nil {
+			http.Error(w, "batch too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		var req []batchOp
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, "batch must be a JSON list of {op, key, value}: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		ops := make([]kv.BatchOp, len(req))
+		for i, op := range req {
+			switch op.Op {
+			case "put":
+				ops[i] = kv.BatchOp{Key: op.Key, Value: op.Value}
+			case "delete":
+				ops[i] = kv.BatchOp{Key: op.Key, Delete: true}
+			default:
+				http.Error(w, fmt.Sprintf("op %d: op must be put or delete", i), http.StatusBadRequest)
+				return
+			}
+		}
+
+		err = store.PutBatch(ops)
+		switch {
+		case err == nil:
+			w.Write([]byte("Success"))
+		case errors.Is(err, raft.ErrNotLeader):
+			// The body was consumed above, hand the leader a fresh copy
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			proxyToLeader(w, r, store, nodeID, peerTemplate)
+		case errors.Is(err, kv.ErrEmptyKey), errors.Is(err, kv.ErrKeyTooLarge), errors.Is(err, kv.ErrBatchTooLarge):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// proxyToLeader forwards a request that only the leader can serve, keeping its path and query
+// as the client escaped them
+func proxyToLeader(w http.ResponseWriter, r *http.Request, store *kv.Store, nodeID int, peerTemplate string) {
+	leaderID := store.Raft.GetLeader()
+	if leaderID == -1 {
+		http.Error(w, "Leader not found", http.StatusNotFound)
+		return
+	}
+	if leaderID == nodeID || r.Header.Get(forwardedHeader) != "" {
+		http.Error(w, "Cluster in leadership transition", http.StatusServiceUnavailable)
+		return
+	}
+	if err := forwardToLeader(w, r, fmt.Sprintf(peerTemplate, leaderID)+r.URL.RequestURI()); err != nil {
+		http.Error(w, "Failed to forward request to leader", http.StatusServiceUnavailable)
+	}
+}
+
+func handleListMembers(store *kv.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		config := store.Raft.Members()
+		for _, group := range []struct {
+			role    string
+			members map[int]string
+		}{{"voter", config.Voters}, {"learner", config.Learners}} {
+			ids := make([]int, 0, len(group.members))
+			for id := range group.members {
+				ids = append(ids, id)
+			}
+			sort.Ints(ids)
+			for _, id := range ids {
+				fmt.Fprintf(w, "%d %s %s\n", id, group.members[id], group.role)
+			}
+		}
+	}
+}
+
+func handleAddMember(store *kv.Store, nodeID int, peerTemplate string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		addr := r.URL.Query().Get("addr")
+		if err != nil || addr == "" {
+			http.Error(w, "id and addr are required", http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Get("learner") == "true" {
+			err = store.Raft.AddLearner(id, addr)
+		} else {
+			err = store.Raft.AddMember(id, addr)
+		}
+		writeAdminResult(w, r, store, nodeID, peerTemplate, err)
+	}
+}
+
+// handlePromoteMember turns a caught-up learner into a voter
+func handlePromoteMember(store *kv.Store, nodeID int, peerTemplate string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			http.Error(w, "id is required", http.StatusBadRequest)
+			return
+		}
+		err = store.Raft.PromoteLearner(id)
+		writeAdminResult(w, r, store, nodeID, peerTemplate, err)
+	}
+}
+
+func handleRemoveMember(store *kv.Store, nodeID int, peerTemplate string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			http.Error(w, "id is required", http.StatusBadRequest)
+			return
+		}
+		err = store.Raft.RemoveMember(id)
+		writeAdminResult(w, r, store, nodeID, peerTemplate, err)
+	}
+}
+
+// handleTransferLeader hands leadership to another member, e.g. before draining this node
+func handleTransferLeader(store *kv.Store, nodeID int, peerTemplate string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			http.Error(w, "id is required", http.StatusBadRequest)
+			return
+		}
+		err = store.Raft.TransferLeadership(id)
+		writeAdminResult(w, r, store, nodeID, peerTemplate, err)
+	}
+}
+
+func writeAdminResult(w http.ResponseWriter, r *http.Request, store *kv.Store, nodeID int, peerTemplate string, err error) {
+	switch {
+	case err == nil:
+		w.Write([]byte("Success"))
+	case errors.Is(err, raft.ErrNotLeader):
+		proxyToLeader(w, r, store, nodeID, peerTemplate)
+	case errors.Is(err, raft.ErrMemberExists), errors.Is(err, raft.ErrUnknownMember), errors.Is(err, raft.ErrTooFewVoters),
+		errors.Is(err, raft.ErrNotLearner):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, raft.ErrConfigPending), errors.Is(err, raft.ErrLeaderNotReady), errors.Is(err, raft.ErrTransferPending),
+		errors.Is(err, raft.ErrLearnerBehind):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+const watchKeepAlive = 15 * time.Second
+
+// handleWatch streams changes as Server-Sent Events, one event per raft entry with the index as its id.
+// key= watches one key, otherwise prefix= (empty for every key). from= or a Last-Event-ID header resumes the stream;
+// a resume point the history no longer covers answers 410 Gone and the client has to re-read its keys.
+// Values are sent as JSON strings, binary values should be watched over gRPC instead.
+func handleWatch(store *kv.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		key, isPrefix := q.Get("prefix"), true
+		if q.Has("key") {
+			if q.Has("prefix") {
+				http.Error(w, "key cannot be combined with prefix", http.StatusBadRequest)
+				return
+			}
+			key, isPrefix = q.Get("key"), false
+		}
+
+		var from uint64
+		if f := q.Get("from"); f != "" {
+			n, err := strconv.ParseUint(f, 10, 64)
+			if err != nil {
+				http.Error(w, "from must be a raft index", http.StatusBadRequest)
+				return
+			}
+			from = n
+		} else if id := r.Header.Get("Last-Event-ID"); id != "" {
+			n, err := strconv.ParseUint(id, 10, 64)
+			if err != nil {
+				http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+				return
+			}
+			from = n + 1
+		}
+
+		watcher, err := store.Watch(key, isPrefix, from)
+		if errors.Is(err, kv.ErrWatchCompacted) {
+			http.Error(w, err.Error(), http.StatusGone)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer watcher.Close()
+
+		rc := http.NewResponseController(w)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		// Set the last event id right away so a reconnect before the first change still resumes without a gap
+		fmt.Fprintf(w, "id: %d\n\n", watcher.From()-1)
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		for {
+			ctx, cancel := context.WithTimeout(r.Context(), watchKeepAlive)
+			events, err := watcher.Next(ctx)
+			cancel()
+			switch {
+			case err == nil:
+				data, _ := json.Marshal(events)
+				fmt.Fprintf(w, "id: %d\ndata: %s\n\n", events[0].Index, data)
+			case errors.Is(err, context.DeadlineExceeded) && r.Context().Err() == nil:
+				// An SSE comment keeps proxies from closing an idle stream
+				io.WriteString(w, ": keep-alive\n\n")
+			case r.Context().Err() != nil:
+				return
+			default:
+				// The watch ended on the server side; the client may resume after the last id it saw
+				fmt.Fprintf(w, "event: error\ndata: %s\n\n", err.Error())
+				rc.Flush()
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"KV-Store/kv"
+	"KV-Store/raft"
+)
+
+// The v2 API addresses a key by its (percent-encoded) path, /v2/keys/{key}, and carries values as raw
+// request and response bodies, so any bytes and any length up to maxValueBody round-trip unchanged.
+// Errors are JSON: {"error": {"code": "not_found", "message": "key not found"}}.
+
+const maxValueBody = 4 * 1024 * 1024 // a value has to fit in a fresh memtable next to its key
+
+// Error codes of the v2 API, stable for clients to match on
+const (
+	codeInvalidArgument  = "invalid_argument"
+	codeNotFound         = "not_found"
+	codeMethodNotAllowed = "method_not_allowed"
+	codeValueTooLarge    = "value_too_large"
+	codeUnavailable      = "unavailable" // no leader, or it could not be reached; retry
+	codeTimeout          = "timeout"     // the write may or may not have been applied
+	codeInternal         = "internal"
+)
+
+type v2Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func writeV2Error(w http.ResponseWriter, status int, code, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(struct {
+		Error v2Error `json:"error"`
+	}{v2Error{Code: code, Message: msg}})
+}
+
+// writeV2StoreError answers with the error of a store call; a follower forwards the request instead
+func writeV2StoreError(w http.ResponseWriter, r *http.Request, store *kv.Store, nodeID int, peerTemplate string, err error) {
+	switch {
+	case errors.Is(err, raft.ErrNotLeader):
+		proxyV2ToLeader(w, r, store, nodeID, peerTemplate)
+	case errors.Is(err, raft.ErrLeaderNotReady), errors.Is(err, raft.ErrReadTimeout):
+		writeV2Error(w, http.StatusServiceUnavailable, codeUnavailable, err.Error())
+	case errors.Is(err, kv.ErrTimeout):
+		writeV2Error(w, http.StatusGatewayTimeout, codeTimeout, err.Error())
+	case errors.Is(err, kv.ErrEmptyKey), errors.Is(err, kv.ErrKeyTooLarge), errors.Is(err, kv.ErrInvalidTTL):
+		writeV2Error(w, http.StatusBadRequest, codeInvalidArgument, err.Error())
+	default:
+		writeV2Error(w, http.StatusInternalServerError, codeInternal, err.Error())
+	}
+}
+
+// proxyV2ToLeader is proxyToLeader with JSON errors. r.Body must still hold the request body.
+func proxyV2ToLeader(w http.ResponseWriter, r *http.Request, store *kv.Store, nodeID int, peerTemplate string) {
+	leaderID := store.Raft.GetLeader()
+	if leaderID == -1 || leaderID == nodeID || r.Header.Get(forwardedHeader) != "" {
+		writeV2Error(w, http.StatusServiceUnavailable, codeUnavailable, "no leader, the cluster is electing one")
+		return
+	}
+	if err := forwardToLeader(w, r, fmt.Sprintf(peerTemplate, leaderID)+r.URL.RequestURI()); err != nil {
+		writeV2Error(w, http.StatusServiceUnavailable, codeUnavailable, "failed to forward request to leader")
+	}
+}
+
+const v2KeysPrefix = "/v2/keys/"
+
+// v2KeyRoutes serves /v2/keys/ by method and hands every other request to mux. It sits in front of
+// the mux because the mux cleans paths and would redirect keys holding "//", "/./" or "/../" to another key.
+func v2KeyRoutes(get, put, del, other http.Handler, mux http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.EscapedPath(), v2KeysPrefix) {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			get.ServeHTTP(w, r)
+		case http.MethodPut:
+			put.ServeHTTP(w, r)
+		case http.MethodDelete:
+			del.ServeHTTP(w, r)
+		default:
+			other.ServeHTTP(w, r)
+		}
+	})
+}
+
+// v2Key returns the key of a /v2/keys/{key} request, decoded from the path exactly as the client
+// escaped it, answering 400 itself if it is missing or too long
+func v2Key(w http.ResponseWriter, r *http.Request) (string, bool) {
+	key, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), v2KeysPrefix))
+	if err != nil {
+		writeV2Error(w, http.StatusBadRequest, codeInvalidArgument, "key is not a valid escaped path")
+		return "", false
+	}
+	if key == "" {
+		writeV2Error(w, http.StatusBadRequest, codeInvalidArgument, kv.ErrEmptyKey.Error())
+		return "", false
+	}
+	if len(key) > kv.MaxKeyLen {
+		writeV2Error(w, http.StatusBadRequest, codeInvalidArgument, kv.ErrKeyTooLarge.Error())
+		return "", false
+	}
+	return key, true
+}
+
+// handleV2Get answers the value as the response body with X-Version set to the raft index that wrote it.
+// Like /get it reads locally unless consistency=linearizable.
+func handleV2Get(store *kv.Store, nodeID int, peerTemplate string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, ok := v2Key(w, r)
+		if !ok {
+			return
+		}
+		switch r.URL.Query().Get("consistency") {
+		case "", "local":
+		case "linearizable":
+			if err := store.ReadBarrier(); err != nil {
+				writeV2StoreError(w, r, store, nodeID, peerTemplate, err)
+				return
+			}
+		default:
+			writeV2Error(w, http.StatusBadRequest, codeInvalidArgument, "consistency must be local or linearizable")
+			return
+		}
+
+		val, version, found, err := store.GetVersion(key)
+		if err != nil {
+			writeV2StoreError(w, r, store, nodeID, peerTemplate, err)
+			return
+		}
+		if !found {
+			writeV2Error(w, http.StatusNotFound, codeNotFound, "key not found")
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(len(val)))
+		w.Header().Set("X-Version", strconv.FormatUint(version, 10))
+		if r.Method != http.MethodHead {
+			io.WriteString(w, val)
+		}
+	}
+}
+
+// handleV2Put stores the request body as the value, whatever its content type. ttl=30s makes the key
+// read as deleted after that long.
+func handleV2Put(store *kv.Store, nodeID int, peerTemplate string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, ok := v2Key(w, r)
+		if !ok {
+			return
+		}
+		var ttl time.Duration
+		if t := r.URL.Query().Get("ttl"); t != "" {
+			d, err := time.ParseDuration(t)
+			if err != nil || d <= 0 {
+				writeV2Error(w, http.StatusBadRequest, codeInvalidArgument, "ttl must be a positive duration such as 30s")
+				return
+			}
+			ttl = d
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxValueBody))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeV2Error(w, http.StatusRequestEntityTooLarge, codeValueTooLarge, fmt.Sprintf("value exceeds %d bytes", maxValueBody))
+			return
+		}
+		if err != nil {
+			writeV2Error(w, http.StatusBadRequest, codeInvalidArgument, "failed to read value: "+err.Error())
+			return
+		}
+
+		if ttl > 0 {
+			err = store.PutWithTTL(key, string(body), ttl)
+		} else {
+			err = store.Put(key, string(body), false)
+		}
+		if err != nil {
+			// The body was consumed above, hand the leader a fresh copy
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			writeV2StoreError(w, r, store, nodeID, peerTemplate, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handleV2Delete(store *kv.Store, nodeID int, peerTemplate string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, ok := v2Key(w, r)
+		if !ok {
+			return
+		}
+		if err := store.Put(key, "", true); err != nil {
+			writeV2StoreError(w, r, store, nodeID, peerTemplate, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleV2Fallback answers every other /v2 request with a JSON error instead of the mux's plain text
+func handleV2Fallback(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/v2/keys/") {
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		writeV2Error(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, r.Method+" is not supported on keys")
+		return
+	}
+	writeV2Error(w, http.StatusNotFound, codeNotFound, "no such endpoint")
+}
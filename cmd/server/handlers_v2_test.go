@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newV2KeysServer answers every /v2/keys/ request with its method and decoded key
+func newV2KeysServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key, ok := v2Key(w, r); ok {
+			_, _ = io.WriteString(w, r.Method+" "+key)
+		}
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/", handleV2Fallback)
+	mux.HandleFunc("/get", func(w http.ResponseWriter, r *http.Request) { _, _ = io.WriteString(w, "get") })
+	srv := httptest.NewServer(v2KeyRoutes(echo, echo, echo, http.HandlerFunc(handleV2Fallback), mux))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func doV2(t *testing.T, method, url string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader("v"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+// Paths the mux would clean and redirect are keys like any other
+func TestV2KeysAreNotCleaned(t *testing.T) {
+	srv := newV2KeysServer(t)
+	for path, key := range map[string]string{
+		"a//b":       "a//b",
+		"a/./b":      "a/./b",
+		"a/../b":     "a/../b",
+		"x/.":        "x/.",
+		"x/..":       "x/..",
+		"../get":     "../get",
+		"dir/":       "dir/",
+		"a%2F%2Fb":   "a//b",
+		"%2E%2E":     "..",
+		"sp%20ce%26": "sp ce&",
+	} {
+		for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+			status, body := doV2(t, method, srv.URL+"/v2/keys/"+path)
+			if status != http.StatusOK || body != method+" "+key {
+				t.Errorf("%s /v2/keys/%s = %d %q, want 200 %q", method, path, status, body, method+" "+key)
+			}
+		}
+	}
+
+	if status, body := doV2(t, http.MethodPost, srv.URL+"/v2/keys/a//b"); status != http.StatusMethodNotAllowed || !strings.Contains(body, codeMethodNotAllowed) {
+		t.Errorf("POST = %d %q, want a JSON 405", status, body)
+	}
+	if status, body := doV2(t, http.MethodGet, srv.URL+"/v2/keys/"); status != http.StatusBadRequest || !strings.Contains(body, codeInvalidArgument) {
+		t.Errorf("GET without a key = %d %q, want a JSON 400", status, body)
+	}
+	// Everything else still goes through the mux
+	if status, body := doV2(t, http.MethodGet, srv.URL+"/get"); status != http.StatusOK || body != "get" {
+		t.Errorf("GET /get = %d %q", status, body)
+	}
+	if status, _ := doV2(t, http.MethodGet, srv.URL+"/v2/nothing"); status != http.StatusNotFound {
+		t.Errorf("GET /v2/nothing = %d, want 404", status)
+	}
+}
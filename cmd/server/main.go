@@ -11,10 +11,10 @@ import (
 	"KV-Store/api"
 	"KV-Store/kv"
 	pb "KV-Store/proto"
+	"KV-Store/raft"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
 func main() {
@@ -23,24 +23,33 @@ func main() {
 	rpcPort := flag.String("port", "5001", "gRPC port")
 	httpPort := flag.String("http", "8001", "HTTP port")
 	peerTemplate := flag.String("peer-template", "http://kv-%d:8001", "Peer URL template")
+	join := flag.Bool("join", false, "Start without a configuration and wait to be added via /admin/members/add")
+	blockCacheMB := flag.Int("block-cache-mb", 64, "SSTable block cache size in MB")
+	compression := flag.String("compression", "none,flate", "Block compression per level from L0 (none|flate), the last one applies to deeper levels")
+	levelSizeMB := flag.Float64("level-size-mb", 64, "Target size of L1 in MB, every deeper level targets 10x the one above")
+	tableSizeMB := flag.Float64("sst-size-mb", 8, "Size in MB at which compaction starts a new SSTable")
 	flag.Parse()
 
-	// Initialize Raft clients
-	peerList := strings.Split(*peerAddrs, ",")
-	raftClients := make([]pb.RaftServiceClient, len(peerList))
-	for i, addr := range peerList {
-		if i == *id {
-			continue
+	// Bootstrap membership: node id is the position in -peers
+	members := make(map[int]string)
+	if !*join {
+		for i, addr := range strings.Split(*peerAddrs, ",") {
+			members[i] = addr
 		}
-		conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
-		if err != nil {
-			log.Fatalf("Failed to connect to peer %s: %v", addr, err)
-		}
-		raftClients[i] = pb.NewRaftServiceClient(conn)
 	}
 
+	opts := kv.DefaultOptions()
+	opts.BlockCacheSize = int64(*blockCacheMB) * 1024 * 1024
+	codecs, err := kv.ParseLevelCodecs(*compression)
+	if err != nil {
+		log.Fatalf("Invalid -compression: %v", err)
+	}
+	opts.LevelCodecs = codecs
+	opts.BaseLevelSize = int64(*levelSizeMB * 1024 * 1024)
+	opts.TargetFileSize = int64(*tableSizeMB * 1024 * 1024)
+
 	// Initialize store
-	store, err := kv.NewKVStore(raftClients, *id)
+	store, err := kv.NewKVStore(members, *id, opts)
 	if err != nil {
 		log.Fatalf("Failed to initialize store: %v", err)
 	}
@@ -49,13 +58,33 @@ func main() {
 	go startGRPCServer(*rpcPort, store)
 
 	// Register HTTP handlers
-	http.HandleFunc("/get", httpLogger(withMetrics(handleGet(store), "GET", "/get")))
+	http.HandleFunc("/get", httpLogger(withMetrics(handleGet(store, *id, *peerTemplate), "GET", "/get")))
 	http.HandleFunc("/put", httpLogger(withMetrics(handlePut(store, *id, *peerTemplate), "PUT", "/put")))
+	http.HandleFunc("/scan", httpLogger(withMetrics(handleScan(store), "GET", "/scan")))
 	http.HandleFunc("/delete", httpLogger(withMetrics(handleDelete(store, *id, *peerTemplate), "DELETE", "/delete")))
+	http.HandleFunc("/batch", httpLogger(withMetrics(handleBatch(store, *id, *peerTemplate), "POST", "/batch")))
+	http.HandleFunc("/cas", httpLogger(withMetrics(handleCAS(store, *id, *peerTemplate), "POST", "/cas")))
+	http.HandleFunc("/put-if-absent", httpLogger(withMetrics(handlePutIfAbsent(store, *id, *peerTemplate), "POST", "/put-if-absent")))
+	http.HandleFunc("/delete-if-equals", httpLogger(withMetrics(handleDeleteIfEquals(store, *id, *peerTemplate), "POST", "/delete-if-equals")))
+	http.HandleFunc("/watch", httpLogger(withMetrics(handleWatch(store), "GET", "/watch")))
+	v2Fallback := httpLogger(withMetrics(handleV2Fallback, "OTHER", "/v2"))
+	http.HandleFunc("/v2/", v2Fallback)
+	http.HandleFunc("/admin/members", httpLogger(withMetrics(handleListMembers(store), "GET", "/admin/members")))
+	http.HandleFunc("/admin/members/add", httpLogger(withMetrics(handleAddMember(store, *id, *peerTemplate), "POST", "/admin/members/add")))
+	http.HandleFunc("/admin/members/promote", httpLogger(withMetrics(handlePromoteMember(store, *id, *peerTemplate), "POST", "/admin/members/promote")))
+	http.HandleFunc("/admin/members/remove", httpLogger(withMetrics(handleRemoveMember(store, *id, *peerTemplate), "POST", "/admin/members/remove")))
+	http.HandleFunc("/admin/leader/transfer", httpLogger(withMetrics(handleTransferLeader(store, *id, *peerTemplate), "POST", "/admin/leader/transfer")))
 	http.Handle("/metrics", promhttp.Handler())
 
 	fmt.Printf("HTTP server listening on :%s\n", *httpPort)
-	log.Fatal(http.ListenAndServe(":"+*httpPort, nil))
+	v2Keys := v2KeyRoutes(
+		httpLogger(withMetrics(handleV2Get(store, *id, *peerTemplate), "GET", "/v2/keys")),
+		httpLogger(withMetrics(handleV2Put(store, *id, *peerTemplate), "PUT", "/v2/keys")),
+		httpLogger(withMetrics(handleV2Delete(store, *id, *peerTemplate), "DELETE", "/v2/keys")),
+		v2Fallback,
+		http.DefaultServeMux,
+	)
+	log.Fatal(http.ListenAndServe(":"+*httpPort, v2Keys))
 }
 
 func startGRPCServer(port string, store *kv.Store) {
@@ -64,8 +93,11 @@ func startGRPCServer(port string, store *kv.Store) {
 		log.Fatalf("Failed to listen: %v", err)
 	}
 
-	server := grpc.NewServer()
+	// Snapshots can be far larger than gRPC's default 4MB message limit
+	server := grpc.NewServer(grpc.MaxRecvMsgSize(raft.MaxSnapshotSize))
 	pb.RegisterRaftServiceServer(server, api.NewRaftServer(store.Raft))
+	pb.RegisterKVServiceServer(server, api.NewKVServer(store))
+	pb.RegisterWatchServiceServer(server, api.NewWatchServer(store))
 
 	fmt.Printf("gRPC server listening on :%s\n", port)
 	if err := server.Serve(lis); err != nil {
@@ -19,6 +19,11 @@ func (ww *responseWriterWrapper) WriteHeader(code int) {
 	ww.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap lets http.ResponseController reach the real writer, e.g. to flush a /watch stream
+func (ww *responseWriterWrapper) Unwrap() http.ResponseWriter {
+	return ww.ResponseWriter
+}
+
 // httpLogger logs HTTP requests in the format: [HTTP] METHOD PATH STATUS_CODE STATUS_TEXT DURATION_MS
 func httpLogger(handler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -3,7 +3,9 @@ package main
 import (
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -16,27 +18,50 @@ var proxyClient = &http.Client{
 	},
 }
 
-func forwardToLeader(w http.ResponseWriter, r *http.Request, leaderURL string) {
-	req, err := http.NewRequest(r.Method, leaderURL, r.Body)
+// forwardedHeader marks a request a follower forwarded; the receiver answers it itself instead of
+// forwarding again, so two nodes that both think the other leads cannot bounce it between them
+const forwardedHeader = "X-Sisyphus-Forwarded"
+
+// hopHeaders only apply to one connection and are not passed through the proxy
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// forwardToLeader replays r against targetURL with its method, body and headers, and copies the
+// leader's answer back. It returns an error, having written nothing, if the leader could not be reached.
+func forwardToLeader(w http.ResponseWriter, r *http.Request, targetURL string) error {
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, targetURL, r.Body)
 	if err != nil {
-		http.Error(w, "Failed to create forwarding request", http.StatusInternalServerError)
-		return
+		return err
 	}
+	req.Header = r.Header.Clone()
+	for _, h := range hopHeaders {
+		req.Header.Del(h)
+	}
+	req.ContentLength = r.ContentLength
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		req.Header.Set("X-Forwarded-For", strings.Trim(strings.Join([]string{req.Header.Get("X-Forwarded-For"), host}, ", "), ", "))
+	}
+	req.Header.Set(forwardedHeader, "1")
 
 	resp, err := proxyClient.Do(req)
 	if err != nil {
 		log.Printf("Proxy error: %v", err)
-		http.Error(w, "Failed to forward request to leader", http.StatusServiceUnavailable)
-		return
+		return err
 	}
 	defer resp.Body.Close()
 
 	for k, v := range resp.Header {
 		w.Header()[k] = v
 	}
+	for _, h := range hopHeaders {
+		w.Header().Del(h)
+	}
 	w.WriteHeader(resp.StatusCode)
 
 	if _, err := io.Copy(w, resp.Body); err != nil {
 		log.Printf("Error copying response: %v", err)
 	}
+	return nil
 }
@@ -32,12 +32,7 @@ func setupBenchmarkStore(b *testing.B) *kv.Store {
 
 	store := &kv.Store{
 		// Manually create the activeMap with 1GB limit
-		ActiveMap: &kv.MemTable{
-			Index: make(map[string]int),
-			Arena: arena.NewArena(limit),
-			Wal:   currentWal,
-			Size:  0,
-		},
+		ActiveMap: kv.NewMemTable(limit, currentWal),
 		WalDir:    walDir,
 		SstDir:    sstDir,
 		FlushChan: make(chan struct{}, 1),
@@ -65,7 +60,7 @@ func BenchmarkPut(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		key := keys[i%poolSize]
 
-		_, err := store.ActiveMap.Arena.Put(key, val, false)
+		_, err := store.ActiveMap.Arena.Put(key, val, false, uint64(i), 0)
 
 		// --- FIX STARTS HERE ---
 		if err != nil {
@@ -76,9 +71,36 @@ func BenchmarkPut(b *testing.B) {
 
 			b.StartTimer()
 
-			store.ActiveMap.Arena.Put(key, val, false)
+			store.ActiveMap.Arena.Put(key, val, false, uint64(i), 0)
 		}
 
 		// store.ActiveMap.Index[key] = offset
 	}
 }
+
+// BenchmarkMemTablePut measures the full memtable write path: arena entry + skiplist insert
+func BenchmarkMemTablePut(b *testing.B) {
+	store := setupBenchmarkStore(b)
+	defer os.RemoveAll("Storage_Bench")
+
+	const poolSize = 10000
+	keys := make([]string, poolSize)
+	for i := 0; i < poolSize; i++ {
+		keys[i] = fmt.Sprintf("k-%d", i)
+	}
+	val := "v-1234567890"
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		key := keys[i%poolSize]
+
+		if err := store.ActiveMap.Index.Put(key, val, false, uint64(i), 0); err != nil {
+			b.StopTimer()
+			store.ActiveMap = kv.NewMemTable(1024*1024*1024, store.ActiveMap.Wal)
+			b.StartTimer()
+
+			_ = store.ActiveMap.Index.Put(key, val, false, uint64(i), 0)
+		}
+	}
+}
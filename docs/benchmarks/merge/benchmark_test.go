@@ -0,0 +1,103 @@
+package benchmarks
+
+import (
+	"KV-Store/sstable"
+	"fmt"
+	"testing"
+)
+
+// sliceSource is an in-memory sorted run, so the benchmarks measure the merge and not disk I/O
+type sliceSource struct {
+	keys []string
+	pos  int
+}
+
+func (s *sliceSource) Valid() bool       { return s.pos < len(s.keys) }
+func (s *sliceSource) Key() string       { return s.keys[s.pos] }
+func (s *sliceSource) Value() []byte     { return nil }
+func (s *sliceSource) Seq() uint64       { return 0 }
+func (s *sliceSource) ExpiresAt() int64  { return 0 }
+func (s *sliceSource) IsTombstone() bool { return false }
+func (s *sliceSource) Next()             { s.pos++ }
+func (s *sliceSource) Err() error        { return nil }
+func (s *sliceSource) Close()            {}
+
+const keysPerSource = 2000
+
+// makeRuns builds k sorted runs whose keys interleave, like overlapping L0 files
+func makeRuns(k int) [][]string {
+	runs := make([][]string, k)
+	for i := range runs {
+		runs[i] = make([]string, keysPerSource)
+		for j := range runs[i] {
+			runs[i][j] = fmt.Sprintf("key_%08d", j*k+i)
+		}
+	}
+	return runs
+}
+
+func newSources(runs [][]string) []*sliceSource {
+	sources := make([]*sliceSource, len(runs))
+	for i, r := range runs {
+		sources[i] = &sliceSource{keys: r}
+	}
+	return sources
+}
+
+// linearMerge is the loop compaction used before the merging iterator: scan every source for the
+// minimum key, then advance every source holding it
+func linearMerge(sources []*sliceSource) int {
+	n := 0
+	for {
+		var minKey string
+		first := true
+		for _, s := range sources {
+			if s.Valid() && (first || s.Key() < minKey) {
+				minKey = s.Key()
+				first = false
+			}
+		}
+		if first {
+			return n
+		}
+		for _, s := range sources {
+			if s.Valid() && s.Key() == minKey {
+				s.Next()
+			}
+		}
+		n++
+	}
+}
+
+func heapMerge(sources []*sliceSource) int {
+	srcs := make([]sstable.Source, len(sources))
+	for i, s := range sources {
+		srcs[i] = s
+	}
+	n := 0
+	for it := sstable.NewMergingIterator(srcs); it.Valid(); it.Next() {
+		n++
+	}
+	return n
+}
+
+func benchmarkMerge(b *testing.B, merge func([]*sliceSource) int) {
+	for _, k := range []int{4, 16, 64} {
+		runs := makeRuns(k)
+		b.Run(fmt.Sprintf("K=%d", k), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if n := merge(newSources(runs)); n != k*keysPerSource {
+					b.Fatalf("merged %d keys, want %d", n, k*keysPerSource)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkLinearMerge(b *testing.B) {
+	benchmarkMerge(b, linearMerge)
+}
+
+func BenchmarkHeapMerge(b *testing.B) {
+	benchmarkMerge(b, heapMerge)
+}
@@ -0,0 +1,78 @@
+package kv
+
+import "errors"
+
+// ErrConditionFailed is returned by a conditional write whose condition did not hold when it was
+// applied. The OpResult that comes with it describes the key's current value.
+var ErrConditionFailed = errors.New("condition failed")
+
+// CompareAndSwap writes val only if key currently holds expected
+func (s *Store) CompareAndSwap(key, expected, val string) (OpResult, error) {
+	return s.proposeConditional(raftCmd{Op: CmdCompareAndSwap, Key: key, Value: val, Expected: expected})
+}
+
+// CompareAndSwapVersion writes val only if the newest version of key was written at raft index version
+func (s *Store) CompareAndSwapVersion(key string, version uint64, val string) (OpResult, error) {
+	if version == 0 {
+		return OpResult{}, errors.New("version must be positive")
+	}
+	return s.proposeConditional(raftCmd{Op: CmdCompareAndSwap, Key: key, Value: val, Version: version})
+}
+
+// PutIfAbsent writes val only if key does not exist
+func (s *Store) PutIfAbsent(key, val string) (OpResult, error) {
+	return s.proposeConditional(raftCmd{Op: CmdPutIfAbsent, Key: key, Value: val})
+}
+
+// DeleteIfEquals deletes key only if it currently holds expected
+func (s *Store) DeleteIfEquals(key, expected string) (OpResult, error) {
+	return s.proposeConditional(raftCmd{Op: CmdDeleteIfEquals, Key: key, Expected: expected})
+}
+
+func (s *Store) proposeConditional(cmd raftCmd) (OpResult, error) {
+	if cmd.Key == "" {
+		return OpResult{}, ErrEmptyKey
+	}
+	res := s.propose(cmd)
+	return res, res.Err
+}
+
+// applyConditional checks the condition of cmd against its key as of the entry before seq and applies
+// the write if it holds. Every replica applies the same log on top of the same state, so they all agree
+// on the outcome, and so does a replay after a restart onto tables that already hold later writes. The result describes the key after the command: its value, whether it exists and
+// the raft index of its newest version.
+func (s *Store) applyConditional(cmd raftCmd, seq uint64) OpResult {
+	// The apply loop is the only writer, nothing can change the key between the check and the write.
+	// Expiry is judged by the store's clock alone, which every replica has advanced to the same point.
+	cur, version, found, err := s.getVersion(cmd.Key, seq-1, 0)
+	if err != nil {
+		return OpResult{Err: err}
+	}
+	var held bool
+	switch cmd.Op {
+	case CmdCompareAndSwap:
+		if cmd.Version != 0 {
+			held = found && version == cmd.Version
+		} else {
+			held = found && cur == cmd.Expected
+		}
+	case CmdPutIfAbsent:
+		held = !found
+	case CmdDeleteIfEquals:
+		held = found && cur == cmd.Expected
+	}
+	if !held {
+		return OpResult{Value: cur, Found: found, Version: version, Err: ErrConditionFailed}
+	}
+
+	if cmd.Op == CmdDeleteIfEquals {
+		if err := s.applyInternal(cmd.Key, "", true, seq, 0); err != nil {
+			return OpResult{Err: err}
+		}
+		return OpResult{}
+	}
+	if err := s.applyInternal(cmd.Key, cmd.Value, false, seq, 0); err != nil {
+		return OpResult{Err: err}
+	}
+	return OpResult{Value: cmd.Value, Found: true, Version: seq}
+}
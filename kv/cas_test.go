@@ -0,0 +1,43 @@
+package kv
+
+import (
+	"errors"
+	"testing"
+)
+
+// Replaying the log after a restart, with tables that already hold later writes, must reach the
+// same outcome for every conditional write as the first run did
+func TestConditionalReplay(t *testing.T) {
+	log := []raftCmd{
+		{Op: CmdPutIfAbsent, Key: "k", Value: "a"},
+		{Op: CmdCompareAndSwap, Key: "k", Expected: "a", Value: "b"},
+		{Op: CmdCompareAndSwap, Key: "k", Expected: "a", Value: "x"},
+		{Op: CmdCompareAndSwap, Key: "k", Version: 2, Value: "c"},
+		{Op: CmdPutIfAbsent, Key: "k", Value: "x"},
+		{Op: CmdDeleteIfEquals, Key: "k", Expected: "c"},
+		{Op: CmdPutIfAbsent, Key: "k", Value: "d"},
+	}
+	wantFailed := map[uint64]bool{3: true, 5: true}
+
+	s := newTestStore(t, DefaultOptions())
+	apply := func(run string) {
+		for i, cmd := range log {
+			seq := uint64(i + 1)
+			res := s.applyConditional(cmd, seq)
+			if failed := errors.Is(res.Err, ErrConditionFailed); failed != wantFailed[seq] || (!failed && res.Err != nil) {
+				t.Fatalf("%s: entry %d = %+v, want failed=%v", run, seq, res, wantFailed[seq])
+			}
+		}
+	}
+	apply("first run")
+	// The flush keeps only the newest version of k
+	s.flushForTest(t)
+	apply("replay")
+
+	for seq, want := range map[uint64]string{1: "a", 3: "b", 4: "c", 6: "", 7: "d"} {
+		val, found, err := s.GetAt("k", seq)
+		if err != nil || found != (want != "") || val != want {
+			t.Errorf("GetAt(k, %d) = %q found=%v err=%v, want %q", seq, val, found, err, want)
+		}
+	}
+}
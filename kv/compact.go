@@ -3,190 +3,345 @@ package kv
 import (
 	"KV-Store/pkg/metrics"
 	"KV-Store/sstable"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
-	"strings"
-	"time"
+	"strconv"
 )
 
-const maxLevelFiles = 4 //Pyramid width
+// numLevels: L0 holds overlapping flushes, L1 and below are sorted runs of non-overlapping tables.
+// The last level is never compacted further.
+const numLevels = 7
 
-func (s *Store) getFilesForLevel(level int) []string {
-	files, _ := os.ReadDir(s.SstDir)
-	var matchedFiles []string
+// compaction merges inputs from level with the tables of level+1 that overlap them
+type compaction struct {
+	level   int
+	inputs  []tableMeta // from level, newest first
+	overlap []tableMeta // from level+1
+	deeper  []tableMeta // levels below level+1, they decide whether a tombstone can be dropped
+	lo, hi  string      // key range of the inputs and the overlap
 
-	prefix := fmt.Sprintf("L%d_", level)
+	snapshots []uint64 // open snapshots when the compaction was picked, their versions are kept
+	now       int64    // the store's clock when the compaction was picked, values expired by then are dropped
+}
 
-	for _, f := range files {
-		if strings.HasPrefix(f.Name(), prefix) && strings.HasSuffix(f.Name(), ".sst") {
-			matchedFiles = append(matchedFiles, f.Name())
+// isBaseLevelFor reports whether no level below the output can hold key, so its tombstone can go
+func (c *compaction) isBaseLevelFor(key string) bool {
+	for _, t := range c.deeper {
+		if t.overlaps(key, key) {
+			return false
 		}
 	}
+	return true
+}
 
-	// Sort Reverse (Newest First) for correctly resolving key conflicts
-	sort.Sort(sort.Reverse(sort.StringSlice(matchedFiles)))
+// MaybeCompact runs compactions until every level is within its target:
+// L0 by file count, L1 and below by total size against a target growing by LevelSizeMultiplier per level.
+func (s *Store) MaybeCompact() error {
+	s.compactionMu.Lock()
+	defer s.compactionMu.Unlock()
 
-	return matchedFiles
+	for {
+		s.mu.RLock()
+		c := s.pickCompaction()
+		s.mu.RUnlock()
+		if c == nil {
+			return nil
+		}
+		if err := s.runCompaction(c); err != nil {
+			return err
+		}
+	}
 }
 
-//Recursive function that compacts level by level
-//CheckAndCompact(0) -> checkAndCompact(1) -> checkAndCompact(2)
-// if any level contains > 4 files
+// pickCompaction chooses the level furthest over its target; nil when none is over.
+// Compactions that would read a quarantined table are passed over, the next level in line is tried instead.
+// It must be called with s.mu held.
+func (s *Store) pickCompaction() *compaction {
+	levels := make([][]tableMeta, numLevels)
+	for _, t := range s.manifest.live() {
+		level := min(t.level, numLevels-1)
+		levels[level] = append(levels[level], t)
+	}
 
-func (s *Store) CheckAndCompact(level int) error {
-	s.compactionMu.Lock()
-	defer s.compactionMu.Unlock()
+	type candidate struct {
+		level int
+		score float64
+	}
+	var over []candidate
+	for level := 0; level < numLevels-1; level++ {
+		var score float64
+		if level == 0 {
+			score = float64(len(levels[0])) / float64(s.opts.L0CompactionTrigger)
+		} else {
+			var size int64
+			for _, t := range levels[level] {
+				size += t.size
+			}
+			score = float64(size) / s.opts.maxBytesForLevel(level)
+		}
+		if score >= 1 {
+			over = append(over, candidate{level, score})
+		}
+	}
+	// Furthest over first, the deeper level on a tie
+	sort.Slice(over, func(i, j int) bool {
+		if over[i].score != over[j].score {
+			return over[i].score > over[j].score
+		}
+		return over[i].level > over[j].level
+	})
 
-	s.mu.Lock()
-	levelFiles := s.getFilesForLevel(level)
-	//if we have fewer than 4 files, do nothing
-	if len(levelFiles) < maxLevelFiles {
-		s.mu.Unlock()
-		return nil
-	}
-	filesToCompact := levelFiles
-	nextLevel := level + 1
-	isBottomLevel := nextLevel >= maxLevelFiles
-	fmt.Printf("[Compaction] Merging %d files from L%d to L%d...\n", len(filesToCompact), level, nextLevel)
-	s.mu.Unlock()
-	var iterators []*sstable.SSTableIterator
-	for _, filename := range filesToCompact {
-		it, err := sstable.NewIterator(filepath.Join(s.SstDir, filename))
+	corrupt := s.quarantinedTables()
+	for _, cand := range over {
+		if c := s.compactionFor(levels, cand.level, corrupt); c != nil {
+			return c
+		}
+	}
+	return nil
+}
+
+// compactionFor builds a compaction of level that reads no table in corrupt, nil if there is none
+func (s *Store) compactionFor(levels [][]tableMeta, level int, corrupt map[uint64]bool) *compaction {
+	var candidates [][]tableMeta
+	if level == 0 {
+		// L0 tables overlap each other, so they all go down together (already newest first)
+		candidates = [][]tableMeta{levels[0]}
+	} else {
+		// One table at a time, round robin through the key space
+		tables := levels[level]
+		sort.Slice(tables, func(i, j int) bool { return tables[i].smallest < tables[j].smallest })
+		start := 0
+		for i, t := range tables {
+			if t.smallest > s.manifest.pointer(level) {
+				start = i
+				break
+			}
+		}
+		for i := range tables {
+			candidates = append(candidates, []tableMeta{tables[(start+i)%len(tables)]})
+		}
+	}
+
+next:
+	for _, inputs := range candidates {
+		c := &compaction{level: level, inputs: inputs}
+		c.lo, c.hi = c.inputs[0].smallest, c.inputs[0].largest
+		for _, t := range c.inputs[1:] {
+			c.lo, c.hi = min(c.lo, t.smallest), max(c.hi, t.largest)
+		}
+		// Every next-level table touching [lo, hi] joins, so the outputs cannot overlap the tables left behind
+		for _, t := range levels[level+1] {
+			if t.overlaps(c.lo, c.hi) {
+				c.overlap = append(c.overlap, t)
+				c.lo, c.hi = min(c.lo, t.smallest), max(c.hi, t.largest)
+			}
+		}
+		for _, tables := range [][]tableMeta{c.inputs, c.overlap} {
+			for _, t := range tables {
+				if corrupt[t.num] {
+					continue next
+				}
+			}
+		}
+		for _, lvl := range levels[level+2:] {
+			c.deeper = append(c.deeper, lvl...)
+		}
+		c.snapshots = s.snapshotSeqs()
+		c.now = s.clock
+		return c
+	}
+	return nil
+}
+
+// runCompaction merges the tables of c into level+1, starting a new output table every TargetFileSize bytes.
+// It must be called with s.compactionMu held.
+func (s *Store) runCompaction(c *compaction) error {
+	nextLevel := c.level + 1
+	fmt.Printf("[Compaction] Merging %d files from L%d with %d files from L%d, keys [%q, %q]...\n",
+		len(c.inputs), c.level, len(c.overlap), nextLevel, c.lo, c.hi)
+
+	var sources []sstable.Source
+	for _, t := range append(append([]tableMeta{}, c.inputs...), c.overlap...) {
+		it, err := sstable.NewIterator(filepath.Join(s.SstDir, t.fileName()))
 		if err != nil {
 			// If error, cleanup opened ones
-			for _, openIt := range iterators {
-				openIt.Close()
+			for _, src := range sources {
+				src.Close()
 			}
 			return err
 		}
-		if it.Valid {
-			iterators = append(iterators, it)
-		}
+		sources = append(sources, it.AsSource())
 	}
-	// create output builder (Level + 1)
-	newFilename := fmt.Sprintf("%s/L%d_%d.sst", s.SstDir, nextLevel, time.Now().UnixNano())
-	builder, err := sstable.NewBuilder(newFilename, 10000)
-	if err != nil {
+	// Every version comes out of the merge, the filter keeps the newest and those open snapshots read
+	merged := sstable.NewVersionIterator(sources)
+	defer merged.Close()
+	filter := newVersionFilter(c.snapshots)
+
+	var outputs []tableMeta
+	var builder *sstable.Builder
+	var stats sstable.CompressionStats
+	finishOutput := func() error {
+		err := builder.Close()
+		st := builder.Stats()
+		stats.RawBytes += st.RawBytes
+		stats.StoredBytes += st.StoredBytes
+		out := &outputs[len(outputs)-1]
+		out.size = builder.EstimatedSize()
+		out.smallest, out.largest = builder.KeyRange()
+		out.smallestSeq, out.largestSeq = builder.SeqRange()
+		builder = nil
 		return err
 	}
-	// K-Way merge loop - similar to merge K sorted lists in Leetcode (just we do not use heap here)
-	for {
-		var minKey string
-		first := true
-		activeCount := 0
-		// Find min key
-		for _, it := range iterators {
-			if it.Valid {
-				if first || it.Key < minKey {
-					minKey = it.Key
-					first = false
-				}
-				activeCount++
-			}
+	abort := func(err error) error {
+		// Never drop the inputs for an incomplete merge
+		if builder != nil {
+			_ = builder.Close()
 		}
-		if activeCount == 0 {
-			break
-		}
-		// Resolve collisions (Pick newest) since we sorted file list by timestamp in getFilesForLevel, we just need to iterate in that order
-		var winnerVal []byte
-		var winnerTomb bool
-		foundWinner := false
-		for _, it := range iterators {
-			if it.Valid && it.Key == minKey {
-				// If this is the FIRST (newest) match, capture its data
-				if !foundWinner {
-					winnerVal = it.Value
-					winnerTomb = it.IsTombstone
-					foundWinner = true
-				}
-				// NOW it is safe to advance
-				it.Next()
-			}
+		for _, t := range outputs {
+			_ = os.Remove(filepath.Join(s.SstDir, t.fileName()))
+		}
+		return err
+	}
+
+	var lastKey string
+	for ; merged.Valid(); merged.Next() {
+		key, seq := merged.Key(), merged.Seq()
+		val, expiresAt, isTombstone := merged.Value(), merged.ExpiresAt(), merged.IsTombstone()
+		if !filter.keep(key, seq) {
+			continue
+		}
+		// An expired value must keep hiding the versions below it, so it goes on as a tombstone
+		if expired(expiresAt, c.now) {
+			val, expiresAt, isTombstone = nil, 0, true
 		}
-		if !foundWinner {
+		if isTombstone && filter.noSnapshotBefore(seq) && c.isBaseLevelFor(key) {
 			continue
-		} // Should never happen
-		if winnerTomb {
-			if isBottomLevel {
-				continue
+		}
+		// Versions of a key never straddle two outputs, the tables of a level must not overlap
+		if builder != nil && key != lastKey && builder.EstimatedSize() >= s.opts.TargetFileSize {
+			if err := finishOutput(); err != nil {
+				return abort(err)
 			}
 		}
-		if err := builder.Add([]byte(minKey), winnerVal, winnerTomb); err != nil {
-			return err
+		if builder == nil {
+			out := tableMeta{num: s.manifest.newFileNum(), level: nextLevel}
+			b, err := sstable.NewCompressedBuilder(filepath.Join(s.SstDir, out.fileName()), 10000, s.opts.codecFor(nextLevel))
+			if err != nil {
+				return abort(err)
+			}
+			builder = b
+			outputs = append(outputs, out)
+		}
+		if err := builder.Add([]byte(key), val, seq, expiresAt, isTombstone); err != nil {
+			return abort(err)
+		}
+		lastKey = key
+	}
+	if err := merged.Err(); err != nil {
+		s.quarantine(err)
+		return abort(err)
+	}
+	if builder != nil {
+		if err := finishOutput(); err != nil {
+			return abort(err)
 		}
 	}
-	_ = builder.Close()
-	for _, it := range iterators {
-		it.Close()
+	merged.Close()
+	s.reportCompression(nextLevel, stats)
+	metrics.Compactions.WithLabelValues(strconv.Itoa(s.Me), strconv.Itoa(c.level)).Inc()
+
+	// Swap the outputs in for the inputs in one manifest edit, then clean up the old files.
+	// A crash before the edit leaves orphaned outputs, after it orphaned inputs; both are removed at startup.
+	edit := versionEdit{added: outputs}
+	for _, t := range append(c.inputs, c.overlap...) {
+		edit.deleted = append(edit.deleted, t.num)
+	}
+	if c.level > 0 {
+		edit.compactPointer = map[int]string{c.level: c.inputs[0].largest}
 	}
-	// for cleanup of old sst files
 	s.mu.Lock()
 	defer s.mu.Unlock()
-
-	for _, f := range filesToCompact {
-		_ = os.Remove(filepath.Join(s.SstDir, f))
+	if err := s.manifest.apply(edit); err != nil {
+		return abort(err)
+	}
+	for _, t := range append(c.inputs, c.overlap...) {
+		_ = os.Remove(filepath.Join(s.SstDir, t.fileName()))
 	}
 	s.refreshSSTables()
-	go func() {
-		_ = s.CheckAndCompact(nextLevel)
-	}()
+	fmt.Printf("[Compaction] L%d -> L%d wrote %d files\n", c.level, nextLevel, len(outputs))
 	return nil
 }
 
+// refreshSSTables rebuilds the reader set from the manifest; it must be called with s.mu held.
+// Readers of tables that are still live are kept, so their index, filter and cached blocks stay warm.
 func (s *Store) refreshSSTables() {
-	// Close old readers
+	open := make(map[string]*sstable.Reader, len(s.ssTables))
 	for _, r := range s.ssTables {
-		_ = r.Close()
+		open[r.Filename()] = r
 	}
 
-	// Scan all levels
-	files, _ := os.ReadDir(s.SstDir)
-	var sstFiles []string
-	for _, f := range files {
-		if strings.HasSuffix(f.Name(), ".sst") {
-			sstFiles = append(sstFiles, filepath.Join(s.SstDir, f.Name()))
-		}
-	}
-
-	// Global Sort by Timestamp DESCENDING.
-	// Since our naming is L{lvl}_{timestamp}, sorting by file name descending might mix levels
-	// but typically newer timestamps (higher numbers) appear first, which is what we want.
-	sort.Sort(sort.Reverse(sort.StringSlice(sstFiles)))
-
+	// Newest first: L0 before L1 and so on, higher sequence numbers first within a level
 	var readers []*sstable.Reader
-	for _, f := range sstFiles {
-		r, err := sstable.OpenSSTable(f)
-		if err == nil {
+	var seqs []uint64
+	for _, t := range s.manifest.live() {
+		f := filepath.Join(s.SstDir, t.fileName())
+		if r, ok := open[f]; ok {
 			readers = append(readers, r)
+			seqs = append(seqs, t.largestSeq)
+			delete(open, f)
+			continue
 		}
+		r, err := sstable.OpenCachedSSTable(f, s.blockCache)
+		var ce *sstable.CorruptionError
+		if errors.As(err, &ce) {
+			// Keep its key range covered, older tables must not answer for it
+			s.noteQuarantined(err)
+			r = sstable.NewQuarantinedReader(f, t.smallest, t.largest, ce)
+		} else if err != nil {
+			fmt.Printf("[Manifest] cannot open live table %s: %v\n", f, err)
+			continue
+		}
+		readers = append(readers, r)
+		seqs = append(seqs, t.largestSeq)
+	}
+	// Drop our reference to tables that are gone; in-flight reads keep theirs
+	for _, r := range open {
+		_ = r.Close()
+	}
+	// seqBound[i] is the highest sequence number in ssTables[i:]
+	for i := len(seqs) - 2; i >= 0; i-- {
+		seqs[i] = max(seqs[i], seqs[i+1])
 	}
 	s.ssTables = readers
+	s.seqBound = seqs
 	s.reportLevelMetrics()
 }
 
-func (s *Store) reportLevelMetrics() {
-	files, _ := os.ReadDir(s.SstDir)
-
-	levelCounts := make(map[int]float64)
-	levelSizes := make(map[int]float64)
+// parseTableName extracts the level and file number from an L{lvl}_{num}.sst path.
+// Tables written before the manifest used a timestamp as their number.
+func parseTableName(path string) (int, uint64, bool) {
+	var level int
+	var num uint64
+	_, err := fmt.Sscanf(filepath.Base(path), "L%d_%d.sst", &level, &num)
+	return level, num, err == nil
+}
 
-	for _, f := range files {
-		if strings.HasSuffix(f.Name(), ".sst") {
-			var level int
-			_, _ = fmt.Sscanf(f.Name(), "L%d_", &level)
-			levelCounts[level]++
-			info, _ := f.Info()
-			levelSizes[level] += float64(info.Size())
-		}
+func (s *Store) reportLevelMetrics() {
+	var counts, sizes [numLevels]float64
+	for _, t := range s.manifest.live() {
+		level := min(t.level, numLevels-1)
+		counts[level]++
+		sizes[level] += float64(t.size)
 	}
 
 	idStr := fmt.Sprintf("%d", s.Me)
 
-	for lvl, count := range levelCounts {
+	for lvl := range counts {
 		lvlStr := fmt.Sprintf("%d", lvl)
-		metrics.LevelFileCount.WithLabelValues(idStr, lvlStr).Set(count)
-		metrics.LevelSize.WithLabelValues(idStr, lvlStr).Set(levelSizes[lvl])
+		metrics.LevelFileCount.WithLabelValues(idStr, lvlStr).Set(counts[lvl])
+		metrics.LevelSize.WithLabelValues(idStr, lvlStr).Set(sizes[lvl])
 	}
 }
@@ -2,37 +2,127 @@ package kv
 
 import (
 	"KV-Store/pkg/arena"
+	"KV-Store/pkg/metrics"
 	"KV-Store/pkg/wal"
 	"KV-Store/sstable"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"math"
 	"os"
-	"sort"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"time"
+	"unicode/utf8"
 )
 
 const mapLimit = 10 * 1024 * 1024 // 10MB per map
 
+const snapshotThreshold = 10000 // raft log entries kept in memory before we snapshot
+
 type Commands byte
 
 const (
-	CmdPut    Commands = 1
-	CmdDelete Commands = 2
+	CmdPut        Commands = 1
+	CmdDelete     Commands = 2
+	CmdWriteBatch Commands = 3 // Batch is applied atomically at one raft index
+
+	// Conditional writes, checked against the key as of the entry before theirs when applied
+	CmdCompareAndSwap Commands = 4 // put Value if the key holds Expected, or is at Version when set
+	CmdPutIfAbsent    Commands = 5 // put Value if the key does not exist
+	CmdDeleteIfEquals Commands = 6 // delete the key if it holds Expected
+)
+
+// MaxKeyLen is the longest key the store accepts; memtable and table entries store key lengths in 16 bits
+const MaxKeyLen = math.MaxUint16
+
+// maxBatchBytes caps the memtable space one write batch takes (see batchSize), so it always fits in a fresh memtable
+const maxBatchBytes = mapLimit / 2
+
+var (
+	ErrEmptyKey      = errors.New("key must not be empty")
+	ErrKeyTooLarge   = fmt.Errorf("key exceeds %d bytes", MaxKeyLen)
+	ErrBatchTooLarge = fmt.Errorf("write batch exceeds %d bytes of memtable space (keys, values and %d bytes per op)", maxBatchBytes, arena.EntryHeaderSize+arena.MaxNodeSize)
+	ErrInvalidTTL    = errors.New("ttl must be positive")
+	ErrTimeout       = errors.New("timeout waiting for consensus")
 )
 
 type raftCmd struct {
-	Op    Commands
-	Key   string
-	Value string
+	Op       Commands
+	Key      string
+	Value    string
+	Batch    []BatchOp `json:",omitempty"`
+	Expected string    `json:",omitempty"`
+	Version  uint64    `json:",omitempty"`
+	// Time is the leader's clock when it proposed the command, in unix nanoseconds.
+	// A put with a TTL expires at Time+TTL, so every replica stores the same expiry.
+	Time int64         `json:",omitempty"`
+	TTL  time.Duration `json:",omitempty"`
+	// Binary marks a command whose keys and values are base64 encoded, since encoding/json
+	// would replace bytes that are not valid UTF-8
+	Binary bool `json:",omitempty"`
+}
+
+func (cmd *raftCmd) binaryFields() []*string {
+	fields := []*string{&cmd.Key, &cmd.Value, &cmd.Expected}
+	for i := range cmd.Batch {
+		fields = append(fields, &cmd.Batch[i].Key, &cmd.Batch[i].Value)
+	}
+	return fields
+}
+
+// encodeBinary base64 encodes the keys and values of cmd if any of them is not valid UTF-8
+func (cmd *raftCmd) encodeBinary() {
+	if !slices.ContainsFunc(cmd.binaryFields(), func(f *string) bool { return !utf8.ValidString(*f) }) {
+		return
+	}
+	cmd.Batch = slices.Clone(cmd.Batch) // the ops belong to the caller
+	for _, f := range cmd.binaryFields() {
+		*f = base64.StdEncoding.EncodeToString([]byte(*f))
+	}
+	cmd.Binary = true
+}
+
+// decodeBinary undoes encodeBinary after the command was read from the log
+func (cmd *raftCmd) decodeBinary() error {
+	if !cmd.Binary {
+		return nil
+	}
+	for _, f := range cmd.binaryFields() {
+		b, err := base64.StdEncoding.DecodeString(*f)
+		if err != nil {
+			return err
+		}
+		*f = string(b)
+	}
+	cmd.Binary = false
+	return nil
+}
+
+// BatchOp is one put or delete of a write batch
+type BatchOp struct {
+	Key    string
+	Value  string
+	Delete bool
 }
 type OpResult struct {
 	Value string
 	Err   error
+	// Conditional writes report the key as it is after the command
+	Found   bool
+	Version uint64 // raft index of the key's newest version, 0 if it does not exist
 }
 
 func NewMemTable(size int, newWal *wal.WAL) *MemTable {
+	a := arena.NewArena(size)
+	index, err := arena.NewSkipList(a)
+	if err != nil {
+		panic(fmt.Sprintf("NewSkipList failed in NewMemTable(): %v", err))
+	}
 	return &MemTable{
-		Index: make(map[string]int),
-		Arena: arena.NewArena(size),
+		Index: index,
+		Arena: a,
 		Wal:   newWal,
 	}
 }
@@ -46,6 +136,7 @@ func (s *Store) RotateTable() {
 		}
 	}
 	s.frozenMap = s.ActiveMap
+	s.frozenMap.applied = uint64(s.appliedIndex)
 	s.walSeq++
 	newWal, err := wal.OpenWAL(s.WalDir, s.walSeq)
 	if err != nil {
@@ -59,65 +150,64 @@ func (s *Store) RotateTable() {
 	}
 }
 
-func checkTable(table *MemTable, key string) (string, bool, bool) {
+// checkTable looks up the newest version of key in table written at or before seq
+func checkTable(table *MemTable, key string, seq uint64) (val string, version uint64, expiresAt int64, isTombstone bool, found bool) {
 	if table == nil {
-		return "", false, false
+		return "", 0, 0, false, false
 	}
-	offset, ok := table.Index[key]
+	valBytes, version, expiresAt, isTombstone, ok := table.Index.GetAt(key, seq)
 	if !ok {
-		return "", false, false
-	}
-	valBytes, isTombstone, err := table.Arena.Get(offset)
-	if err != nil {
-		return "", false, false
+		return "", 0, 0, false, false
 	}
 	if isTombstone {
-		return "", true, true
+		return "", version, 0, true, true
 	}
-	return string(valBytes), false, true
+	return string(valBytes), version, expiresAt, false, true
 }
 
-func CreateSSTable(frozenMem *MemTable, sstDir string, level int) error { // Added walDir arg for cleaner path handling
-	// sort
-	keys := make([]string, 0, len(frozenMem.Index))
-	for k := range frozenMem.Index {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
+// expired reports whether a value expiring at expiresAt is gone at now (both unix nanoseconds).
+// An expired value hides older versions of its key just like a tombstone.
+func expired(expiresAt, now int64) bool {
+	return expiresAt != 0 && expiresAt <= now
+}
 
-	filename := fmt.Sprintf("%s/L%d_%d.sst", sstDir, level, time.Now().UnixNano()) // Use walDir path
-	builder, err := sstable.NewBuilder(filename, len(keys))
+// createSSTable writes a frozen memtable into the new table t, keeping only the versions that are newest
+// or read by one of the snapshots; the key range and size are filled in from the result
+func createSSTable(frozenMem *MemTable, sstDir string, t *tableMeta, codec sstable.Codec, snapshots []uint64) (sstable.CompressionStats, error) {
+	filename := filepath.Join(sstDir, t.fileName())
+	builder, err := sstable.NewCompressedBuilder(filename, frozenMem.Index.Len(), codec)
 	if err != nil {
-		return fmt.Errorf("failed to create sstable file: %w", err)
+		return sstable.CompressionStats{}, fmt.Errorf("failed to create sstable file: %w", err)
 	}
 
-	// add to builder
-	for _, k := range keys {
-		offset := frozenMem.Index[k]
-		val, isTombstone, _ := frozenMem.Arena.Get(offset)
+	// the skiplist is already sorted, stream it into the builder
+	filter := newVersionFilter(snapshots)
+	it := frozenMem.Index.NewIterator()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		key := it.Key()
+		val, seq, isTombstone := it.Value()
+		if !filter.keep(key, seq) {
+			continue
+		}
 
 		// Convert string to []byte for the Builder
-		err := builder.Add([]byte(k), val, isTombstone)
+		err := builder.Add([]byte(key), val, seq, it.ExpiresAt(), isTombstone)
 		if err != nil {
 			// If write fails, we should probably close and delete the corrupt file
 			_ = builder.File.Close()
 			_ = os.Remove(filename)
-			return fmt.Errorf("failed to add key to sstable: %w", err)
+			return sstable.CompressionStats{}, fmt.Errorf("failed to add key to sstable: %w", err)
 		}
 	}
 
 	if err := builder.Close(); err != nil {
-		return fmt.Errorf("failed to close sstable: %w", err)
-	}
-
-	// delete wal
-	if frozenMem.Wal != nil {
-		if err := frozenMem.Wal.Remove(); err != nil {
-			fmt.Printf("Warning: failed to delete old WAL: %v\n", err)
-		}
+		_ = os.Remove(filename)
+		return sstable.CompressionStats{}, fmt.Errorf("failed to close sstable: %w", err)
 	}
-
-	return nil
+	t.size = builder.EstimatedSize()
+	t.smallest, t.largest = builder.KeyRange()
+	t.smallestSeq, t.largestSeq = builder.SeqRange()
+	return builder.Stats(), nil
 }
 
 func (s *Store) FlushWorker() {
@@ -130,6 +220,7 @@ func (s *Store) FlushWorker() {
 		for {
 			s.mu.Lock()
 			frozenMem := s.frozenMap
+			snapshots := s.snapshotSeqs()
 			s.mu.Unlock()
 
 			if frozenMem == nil {
@@ -137,24 +228,47 @@ func (s *Store) FlushWorker() {
 			}
 
 			//  Do the heavy lifting
-			err := CreateSSTable(frozenMem, s.SstDir, 0)
+			table := tableMeta{num: s.manifest.newFileNum(), level: 0}
+			stats, err := createSSTable(frozenMem, s.SstDir, &table, s.opts.codecFor(0), snapshots)
+			if err == nil {
+				s.reportCompression(0, stats)
+			}
 
 			s.mu.Lock()
+			if err == nil {
+				err = s.manifest.apply(versionEdit{added: []tableMeta{table}, appliedIndex: frozenMem.applied})
+			}
 			if err != nil {
 				// LOG ERROR but DO NOT DEADLOCK.
 				// We clear the map anyway to allow new writes.
 				fmt.Printf("CRITICAL FLUSH ERROR: %v\n", err)
+			} else if frozenMem.Wal != nil {
+				// The table is in the manifest, the WAL is no longer needed
+				if err := frozenMem.Wal.Remove(); err != nil {
+					fmt.Printf("Warning: failed to delete old WAL: %v\n", err)
+				}
 			}
 
+			// Publish the new table before dropping the frozen map so reads never miss the flushed keys
+			s.refreshSSTables()
+
 			//  CLEAR THE MAP (Crucial!)
 			s.frozenMap = nil
 			s.cond.Signal()
 			s.mu.Unlock()
 
-			s.refreshSSTables()
-
 			// Trigger compaction asynchronously
-			go func() { _ = s.CheckAndCompact(0) }()
+			go func() { _ = s.MaybeCompact() }()
 		}
 	}
 }
+
+// reportCompression publishes how well the data blocks of a table written to level compressed
+func (s *Store) reportCompression(level int, stats sstable.CompressionStats) {
+	id, lvl := strconv.Itoa(s.Me), strconv.Itoa(level)
+	metrics.SSTableRawBytes.WithLabelValues(id, lvl).Add(float64(stats.RawBytes))
+	metrics.SSTableStoredBytes.WithLabelValues(id, lvl).Add(float64(stats.StoredBytes))
+	if stats.StoredBytes > 0 {
+		metrics.CompressionRatio.WithLabelValues(id, lvl).Set(float64(stats.RawBytes) / float64(stats.StoredBytes))
+	}
+}
@@ -0,0 +1,432 @@
+package kv
+
+import (
+	"KV-Store/sstable"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+	MANIFEST: the append-only log of version edits that says which SSTables are live.
+	Record:  [CRC(4)][Len(4)][Edit]   the CRC covers the edit bytes
+	Edit:    a sequence of tagged fields
+		tagAddTable       [Level][FileNum][Size][SmallestLen][Smallest][LargestLen][Largest][SmallestSeq][LargestSeq]
+		tagDeleteTable    [FileNum]
+		tagNextFileNum    [FileNum]
+		tagCompactPointer [Level][KeyLen][Key]
+		tagAppliedIndex   [Index]   every write up to this raft index is in the live tables
+	All numbers are uvarints. Replaying every edit in order rebuilds the live table set;
+	a table on disk that is not in the set is an orphan (e.g. the output of an interrupted compaction).
+*/
+
+const (
+	manifestName = "MANIFEST"
+	// rewriteManifestSize: past this size the log is replaced by a single edit describing the live set
+	rewriteManifestSize = 1024 * 1024
+
+	manifestHeaderSize = 8
+)
+
+const (
+	tagAddTable byte = iota + 1
+	tagDeleteTable
+	tagNextFileNum
+	tagCompactPointer
+	tagAppliedIndex
+)
+
+// tableMeta is what the manifest records about a live table
+type tableMeta struct {
+	num         uint64 // file number, larger is newer
+	level       int
+	size        int64
+	smallest    string
+	largest     string
+	smallestSeq uint64 // sequence numbers (raft indexes) of the writes the table holds
+	largestSeq  uint64
+}
+
+// tableName is the file name of table num at level
+func tableName(level int, num uint64) string {
+	return fmt.Sprintf("L%d_%06d.sst", level, num)
+}
+
+func (t tableMeta) fileName() string {
+	return tableName(t.level, t.num)
+}
+
+func (t tableMeta) overlaps(lo, hi string) bool {
+	return t.largest >= lo && t.smallest <= hi
+}
+
+// versionEdit is one atomic change to the live table set
+type versionEdit struct {
+	added          []tableMeta
+	deleted        []uint64
+	compactPointer map[int]string // level -> largest key of the last table compacted out of it
+	nextFileNum    uint64         // file numbers below it may be in use, never hand them out again
+	appliedIndex   uint64         // raft index the live tables hold every write up to, 0 = unchanged
+}
+
+type manifest struct {
+	mu             sync.Mutex
+	dir            string
+	file           *os.File
+	size           int64
+	tables         map[uint64]tableMeta
+	nextFileNum    uint64
+	compactPointer [numLevels]string
+	appliedIndex   uint64
+}
+
+// openManifest replays dir/MANIFEST and starts a fresh log holding only the live set.
+// The second result is false when there was no manifest yet.
+func openManifest(dir string) (*manifest, bool, error) {
+	m := &manifest{
+		dir:         dir,
+		tables:      make(map[uint64]tableMeta),
+		nextFileNum: 1,
+	}
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	existed := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return nil, false, err
+	}
+	for off := 0; off < len(data); {
+		if len(data)-off < manifestHeaderSize {
+			fmt.Printf("[Manifest] ignoring torn record at offset %d\n", off)
+			break
+		}
+		crc := binary.LittleEndian.Uint32(data[off : off+4])
+		n := int(binary.LittleEndian.Uint32(data[off+4 : off+8]))
+		if n > len(data)-off-manifestHeaderSize {
+			fmt.Printf("[Manifest] ignoring torn record at offset %d\n", off)
+			break
+		}
+		payload := data[off+manifestHeaderSize : off+manifestHeaderSize+n]
+		if crc32.ChecksumIEEE(payload) != crc {
+			fmt.Printf("[Manifest] ignoring record with bad checksum at offset %d\n", off)
+			break
+		}
+		edit, err := decodeEdit(payload)
+		if err != nil {
+			return nil, false, fmt.Errorf("manifest record at offset %d: %w", off, err)
+		}
+		m.applyLocked(edit)
+		off += manifestHeaderSize + n
+	}
+	if err := m.rewrite(); err != nil {
+		return nil, false, err
+	}
+	return m, existed, nil
+}
+
+// newFileNum reserves the number of a table about to be written
+func (m *manifest) newFileNum() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	num := m.nextFileNum
+	m.nextFileNum++
+	return num
+}
+
+// apply makes edit durable, then applies it to the live set
+func (m *manifest) apply(edit versionEdit) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	edit.nextFileNum = m.nextFileNum
+	if err := m.append(encodeEdit(edit)); err != nil {
+		return err
+	}
+	m.applyLocked(edit)
+	if m.size > rewriteManifestSize {
+		// The edit is already durable in the old log, a failed rewrite only postpones the cleanup
+		if err := m.rewrite(); err != nil {
+			fmt.Printf("[Manifest] rewrite failed: %v\n", err)
+		}
+	}
+	return nil
+}
+
+func (m *manifest) applyLocked(edit versionEdit) {
+	for _, num := range edit.deleted {
+		delete(m.tables, num)
+	}
+	for _, t := range edit.added {
+		m.tables[t.num] = t
+		m.nextFileNum = max(m.nextFileNum, t.num+1)
+	}
+	for level, key := range edit.compactPointer {
+		if level >= 0 && level < numLevels {
+			m.compactPointer[level] = key
+		}
+	}
+	m.nextFileNum = max(m.nextFileNum, edit.nextFileNum)
+	m.appliedIndex = max(m.appliedIndex, edit.appliedIndex)
+}
+
+// live returns the live tables newest first: by level, then by highest sequence number and file number
+func (m *manifest) live() []tableMeta {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tables := make([]tableMeta, 0, len(m.tables))
+	for _, t := range m.tables {
+		tables = append(tables, t)
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		if tables[i].level != tables[j].level {
+			return tables[i].level < tables[j].level
+		}
+		if tables[i].largestSeq != tables[j].largestSeq {
+			return tables[i].largestSeq > tables[j].largestSeq
+		}
+		return tables[i].num > tables[j].num
+	})
+	return tables
+}
+
+// applied returns the raft index the live tables hold every write up to
+func (m *manifest) applied() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.appliedIndex
+}
+
+func (m *manifest) pointer(level int) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.compactPointer[level]
+}
+
+// rewrite atomically replaces the log with one edit describing the current state
+func (m *manifest) rewrite() error {
+	edit := versionEdit{compactPointer: make(map[int]string), nextFileNum: m.nextFileNum, appliedIndex: m.appliedIndex}
+	for _, t := range m.tables {
+		edit.added = append(edit.added, t)
+	}
+	for level, key := range m.compactPointer {
+		if key != "" {
+			edit.compactPointer[level] = key
+		}
+	}
+	tmp := filepath.Join(m.dir, manifestName+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	record := frameRecord(encodeEdit(edit))
+	if _, err := f.Write(record); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(m.dir, manifestName)); err != nil {
+		_ = f.Close()
+		return err
+	}
+	syncDir(m.dir)
+	if m.file != nil {
+		_ = m.file.Close()
+	}
+	m.file = f
+	m.size = int64(len(record))
+	return nil
+}
+
+func (m *manifest) append(payload []byte) error {
+	record := frameRecord(payload)
+	if _, err := m.file.Write(record); err != nil {
+		return err
+	}
+	if err := m.file.Sync(); err != nil {
+		return err
+	}
+	m.size += int64(len(record))
+	return nil
+}
+
+// syncDir makes a rename in dir durable
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+}
+
+func frameRecord(payload []byte) []byte {
+	record := make([]byte, manifestHeaderSize, manifestHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(record[0:4], crc32.ChecksumIEEE(payload))
+	binary.LittleEndian.PutUint32(record[4:8], uint32(len(payload)))
+	return append(record, payload...)
+}
+
+func encodeEdit(edit versionEdit) []byte {
+	var buf []byte
+	appendString := func(s string) {
+		buf = binary.AppendUvarint(buf, uint64(len(s)))
+		buf = append(buf, s...)
+	}
+	for _, t := range edit.added {
+		buf = append(buf, tagAddTable)
+		buf = binary.AppendUvarint(buf, uint64(t.level))
+		buf = binary.AppendUvarint(buf, t.num)
+		buf = binary.AppendUvarint(buf, uint64(t.size))
+		appendString(t.smallest)
+		appendString(t.largest)
+		buf = binary.AppendUvarint(buf, t.smallestSeq)
+		buf = binary.AppendUvarint(buf, t.largestSeq)
+	}
+	for _, num := range edit.deleted {
+		buf = append(buf, tagDeleteTable)
+		buf = binary.AppendUvarint(buf, num)
+	}
+	for level, key := range edit.compactPointer {
+		buf = append(buf, tagCompactPointer)
+		buf = binary.AppendUvarint(buf, uint64(level))
+		appendString(key)
+	}
+	if edit.nextFileNum > 0 {
+		buf = append(buf, tagNextFileNum)
+		buf = binary.AppendUvarint(buf, edit.nextFileNum)
+	}
+	if edit.appliedIndex > 0 {
+		buf = append(buf, tagAppliedIndex)
+		buf = binary.AppendUvarint(buf, edit.appliedIndex)
+	}
+	return buf
+}
+
+var errBadEdit = errors.New("malformed version edit")
+
+func decodeEdit(p []byte) (versionEdit, error) {
+	var edit versionEdit
+	var err error
+	uvarint := func() uint64 {
+		v, n := binary.Uvarint(p)
+		if n <= 0 {
+			err = errBadEdit
+			return 0
+		}
+		p = p[n:]
+		return v
+	}
+	str := func() string {
+		n := uvarint()
+		if err != nil || n > uint64(len(p)) {
+			err = errBadEdit
+			return ""
+		}
+		s := string(p[:n])
+		p = p[n:]
+		return s
+	}
+	for len(p) > 0 && err == nil {
+		tag := p[0]
+		p = p[1:]
+		switch tag {
+		case tagAddTable:
+			t := tableMeta{level: int(uvarint())}
+			t.num = uvarint()
+			t.size = int64(uvarint())
+			t.smallest = str()
+			t.largest = str()
+			t.smallestSeq = uvarint()
+			t.largestSeq = uvarint()
+			edit.added = append(edit.added, t)
+		case tagDeleteTable:
+			edit.deleted = append(edit.deleted, uvarint())
+		case tagNextFileNum:
+			edit.nextFileNum = uvarint()
+		case tagAppliedIndex:
+			edit.appliedIndex = uvarint()
+		case tagCompactPointer:
+			if edit.compactPointer == nil {
+				edit.compactPointer = make(map[int]string)
+			}
+			level := int(uvarint())
+			edit.compactPointer[level] = str()
+		default:
+			return edit, fmt.Errorf("%w: unknown tag %d", errBadEdit, tag)
+		}
+	}
+	return edit, err
+}
+
+// loadTables opens the manifest, adopting the tables of a directory written before it existed,
+// and deletes every table file the manifest does not list
+func (s *Store) loadTables() error {
+	m, existed, err := openManifest(s.SstDir)
+	if err != nil {
+		return err
+	}
+	s.manifest = m
+	if !existed {
+		if err := s.importTables(); err != nil {
+			return err
+		}
+	}
+	s.removeOrphans()
+	s.refreshSSTables()
+	return nil
+}
+
+// importTables adds the L{lvl}_{timestamp}.sst tables of a pre-manifest directory to the manifest
+func (s *Store) importTables() error {
+	files, err := os.ReadDir(s.SstDir)
+	if err != nil {
+		return err
+	}
+	var edit versionEdit
+	for _, f := range files {
+		level, num, ok := parseTableName(f.Name())
+		if f.IsDir() || !ok {
+			continue
+		}
+		r, err := sstable.OpenSSTable(filepath.Join(s.SstDir, f.Name()))
+		if err != nil {
+			// Without its key range there is no telling which keys it would shadow, so refuse to serve any
+			return fmt.Errorf("cannot import %s, wipe this node's storage to resync it from the leader: %w", f.Name(), err)
+		}
+		smallest, largest := r.KeyRange()
+		edit.added = append(edit.added, tableMeta{
+			num:      num,
+			level:    level,
+			size:     r.Size(),
+			smallest: smallest,
+			largest:  largest,
+		})
+		_ = r.Close()
+	}
+	if len(edit.added) == 0 {
+		return nil
+	}
+	fmt.Printf("[Manifest] imported %d existing tables\n", len(edit.added))
+	return s.manifest.apply(edit)
+}
+
+// removeOrphans deletes table files left behind by a crash: compaction outputs that never made it
+// into the manifest, and inputs or flushed tables the manifest already dropped
+func (s *Store) removeOrphans() {
+	live := make(map[string]bool)
+	for _, t := range s.manifest.live() {
+		live[t.fileName()] = true
+	}
+	files, _ := os.ReadDir(s.SstDir)
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".sst") || live[f.Name()] {
+			continue
+		}
+		fmt.Printf("[Manifest] removing orphaned table %s\n", f.Name())
+		_ = os.Remove(filepath.Join(s.SstDir, f.Name()))
+	}
+}
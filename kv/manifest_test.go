@@ -0,0 +1,187 @@
+package kv
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func openTestManifest(t *testing.T, dir string) *manifest {
+	t.Helper()
+	m, _, err := openManifest(dir)
+	if err != nil {
+		t.Fatalf("openManifest: %v", err)
+	}
+	t.Cleanup(func() { _ = m.file.Close() })
+	return m
+}
+
+// liveNums lists the live tables as level and file number pairs, newest first
+func liveNums(m *manifest) [][2]uint64 {
+	var nums [][2]uint64
+	for _, t := range m.live() {
+		nums = append(nums, [2]uint64{uint64(t.level), t.num})
+	}
+	return nums
+}
+
+// applyTestEdits flushes two tables and compacts them into a third, like a store would
+func applyTestEdits(t *testing.T, m *manifest) {
+	t.Helper()
+	edits := []versionEdit{
+		{added: []tableMeta{{num: m.newFileNum(), level: 0, size: 100, smallest: "a", largest: "m", smallestSeq: 1, largestSeq: 10}}},
+		{added: []tableMeta{{num: m.newFileNum(), level: 0, size: 100, smallest: "c", largest: "z", smallestSeq: 11, largestSeq: 20}}},
+		{
+			added:          []tableMeta{{num: m.newFileNum(), level: 1, size: 180, smallest: "a", largest: "z", smallestSeq: 1, largestSeq: 20}},
+			deleted:        []uint64{1, 2},
+			compactPointer: map[int]string{0: "z"},
+		},
+	}
+	for _, edit := range edits {
+		if err := m.apply(edit); err != nil {
+			t.Fatalf("apply: %v", err)
+		}
+	}
+}
+
+func TestManifestReplay(t *testing.T) {
+	dir := t.TempDir()
+	m, existed, err := openManifest(dir)
+	if err != nil || existed {
+		t.Fatalf("openManifest on an empty dir = existed %v, err %v", existed, err)
+	}
+	applyTestEdits(t, m)
+	// A number handed out but never recorded, e.g. for a flush that crashed before its edit
+	m.newFileNum()
+	if err := m.apply(versionEdit{added: []tableMeta{{num: m.newFileNum(), level: 0, smallest: "q", largest: "r", smallestSeq: 21, largestSeq: 21}}, appliedIndex: 25}); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	// Edits that do not flush, or flush less during a replay, leave the applied index alone
+	if err := m.apply(versionEdit{appliedIndex: 22}); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	want := liveNums(m)
+	_ = m.file.Close()
+
+	replayed := openTestManifest(t, dir)
+	if got := liveNums(replayed); !reflect.DeepEqual(got, want) {
+		t.Errorf("live after replay = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(replayed.tables, m.tables) {
+		t.Errorf("tables after replay = %+v, want %+v", replayed.tables, m.tables)
+	}
+	if got := replayed.applied(); got != 25 {
+		t.Errorf("applied index after replay = %d, want 25", got)
+	}
+	if got := replayed.pointer(0); got != "z" {
+		t.Errorf("compact pointer = %q, want %q", got, "z")
+	}
+	// Deleted and skipped numbers are never handed out again
+	if num := replayed.newFileNum(); num != 6 {
+		t.Errorf("next file number = %d, want 6", num)
+	}
+}
+
+// A crash while appending an edit leaves a torn or unchecksummed tail; replay stops before it,
+// so the edit is either fully applied or not at all
+func TestManifestReplayTornEdit(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		corrupt func(data []byte, lastRecord int) []byte
+	}{
+		{"truncated header", func(data []byte, last int) []byte { return data[:last+5] }},
+		{"truncated payload", func(data []byte, last int) []byte { return data[:len(data)-3] }},
+		{"bad checksum", func(data []byte, last int) []byte { data[len(data)-1] ^= 0xff; return data }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			m := openTestManifest(t, dir)
+			applyTestEdits(t, m)
+			before := liveNums(m)
+
+			path := filepath.Join(dir, manifestName)
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lastRecord := int(info.Size())
+			edit := versionEdit{
+				added:   []tableMeta{{num: m.newFileNum(), level: 2, size: 180, smallest: "a", largest: "z", smallestSeq: 1, largestSeq: 20}},
+				deleted: []uint64{3},
+			}
+			if err := m.apply(edit); err != nil {
+				t.Fatalf("apply: %v", err)
+			}
+			_ = m.file.Close()
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, tc.corrupt(data, lastRecord), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			replayed := openTestManifest(t, dir)
+			if got := liveNums(replayed); !reflect.DeepEqual(got, before) {
+				t.Fatalf("live after a torn edit = %v, want the state before it %v", got, before)
+			}
+			// Replay rewrote the log without the torn tail, so new edits survive the next restart
+			if err := replayed.apply(versionEdit{deleted: []uint64{3}}); err != nil {
+				t.Fatalf("apply after replay: %v", err)
+			}
+			_ = replayed.file.Close()
+			if got := liveNums(openTestManifest(t, dir)); len(got) != 0 {
+				t.Errorf("live after the next restart = %v, want none", got)
+			}
+		})
+	}
+}
+
+// A crash during a rewrite leaves MANIFEST.tmp behind and the old log in place
+func TestManifestReplayInterruptedRewrite(t *testing.T) {
+	dir := t.TempDir()
+	m := openTestManifest(t, dir)
+	applyTestEdits(t, m)
+	want := liveNums(m)
+	_ = m.file.Close()
+
+	if err := os.WriteFile(filepath.Join(dir, manifestName+".tmp"), []byte("half written"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := liveNums(openTestManifest(t, dir)); !reflect.DeepEqual(got, want) {
+		t.Errorf("live after an interrupted rewrite = %v, want %v", got, want)
+	}
+}
+
+func TestManifestRejectsMalformedEdit(t *testing.T) {
+	dir := t.TempDir()
+	// A record whose checksum matches but whose edit does not decode is not a torn write
+	if err := os.WriteFile(filepath.Join(dir, manifestName), frameRecord([]byte{tagAddTable, 0x80}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := openManifest(dir); err == nil {
+		t.Fatal("opened a manifest with a malformed edit")
+	}
+}
+
+func TestVersionEditRoundTrip(t *testing.T) {
+	edit := versionEdit{
+		added: []tableMeta{
+			{num: 7, level: 3, size: 1 << 40, smallest: "", largest: "\x00\xff", smallestSeq: 1, largestSeq: 1 << 62},
+			{num: 8, level: 0, size: 1, smallest: "k", largest: "k", smallestSeq: 5, largestSeq: 5},
+		},
+		deleted:        []uint64{1, 2, 3},
+		compactPointer: map[int]string{1: "m", 4: ""},
+		nextFileNum:    9,
+		appliedIndex:   1 << 50,
+	}
+	got, err := decodeEdit(encodeEdit(edit))
+	if err != nil {
+		t.Fatalf("decodeEdit: %v", err)
+	}
+	if !reflect.DeepEqual(got, edit) {
+		t.Errorf("decoded %+v, want %+v", got, edit)
+	}
+}
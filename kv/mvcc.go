@@ -0,0 +1,111 @@
+package kv
+
+import (
+	"KV-Store/pkg/metrics"
+	"errors"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"sync/atomic"
+)
+
+// ErrSnapshotTooOld is returned for reads at a sequence number older than the last raft snapshot
+// installed on this node: installing one replaces the local history with a single version per key.
+var ErrSnapshotTooOld = errors.New("snapshot is older than the restored raft snapshot")
+
+// Snapshot is a consistent read-only view of the store as of one raft index.
+// Writes applied after it was taken are invisible to it, and compaction keeps every version it
+// can read until Release.
+type Snapshot struct {
+	store    *Store
+	seq      uint64
+	released atomic.Bool
+}
+
+// NewSnapshot opens a snapshot at the last applied raft index. It must be released when done.
+func (s *Store) NewSnapshot() *Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seq := uint64(s.appliedIndex)
+	if s.snapshots == nil {
+		s.snapshots = make(map[uint64]int)
+	}
+	s.snapshots[seq]++
+	metrics.OpenSnapshots.WithLabelValues(strconv.Itoa(s.Me)).Inc()
+	return &Snapshot{store: s, seq: seq}
+}
+
+// Seq returns the raft index the snapshot reads at
+func (sn *Snapshot) Seq() uint64 {
+	return sn.seq
+}
+
+// Get reads key as it was when the snapshot was taken
+func (sn *Snapshot) Get(key string) (string, bool, error) {
+	return sn.store.GetAt(key, sn.seq)
+}
+
+// Scan is Store.Scan as of the snapshot
+func (sn *Snapshot) Scan(start, end string, limit int) ([]KV, bool, error) {
+	return sn.store.ScanAt(start, end, limit, sn.seq)
+}
+
+// Release lets compaction drop the versions only this snapshot could read; calling it again is a no-op
+func (sn *Snapshot) Release() {
+	if sn.released.Swap(true) {
+		return
+	}
+	s := sn.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.snapshots[sn.seq]--; s.snapshots[sn.seq] == 0 {
+		delete(s.snapshots, sn.seq)
+	}
+	metrics.OpenSnapshots.WithLabelValues(strconv.Itoa(s.Me)).Dec()
+}
+
+// snapshotSeqs returns the sequence numbers of the open snapshots in ascending order.
+// It must be called with s.mu held.
+func (s *Store) snapshotSeqs() []uint64 {
+	seqs := make([]uint64, 0, len(s.snapshots))
+	for seq := range s.snapshots {
+		seqs = append(seqs, seq)
+	}
+	slices.Sort(seqs)
+	return seqs
+}
+
+// versionFilter decides which versions a flush or compaction writes out. It is fed the versions
+// of each key newest first and keeps the newest one plus any older one an open snapshot reads.
+// Snapshots opened later read at least the newest version, so a filter may outlive its snapshot list.
+type versionFilter struct {
+	snapshots []uint64 // ascending
+	key       string
+	newer     uint64 // sequence number of the previous version of key, MaxUint64 before the first
+}
+
+func newVersionFilter(snapshots []uint64) *versionFilter {
+	return &versionFilter{snapshots: snapshots, newer: math.MaxUint64}
+}
+
+// keep reports whether the version of key written at seq is still readable: it is the newest
+// version seen, or a snapshot reads at a sequence number in [seq, next newer version)
+func (f *versionFilter) keep(key string, seq uint64) bool {
+	if key != f.key {
+		f.key, f.newer = key, math.MaxUint64
+	}
+	newer := f.newer
+	f.newer = seq
+	if newer == math.MaxUint64 {
+		return true
+	}
+	i := sort.Search(len(f.snapshots), func(i int) bool { return f.snapshots[i] >= seq })
+	return i < len(f.snapshots) && f.snapshots[i] < newer
+}
+
+// noSnapshotBefore reports whether every open snapshot reads at seq or later. A tombstone written
+// at seq then hides nothing anyone can read, so it can go once no deeper level holds its key.
+func (f *versionFilter) noSnapshotBefore(seq uint64) bool {
+	return len(f.snapshots) == 0 || f.snapshots[0] >= seq
+}
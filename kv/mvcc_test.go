@@ -0,0 +1,184 @@
+package kv
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestVersionFilter(t *testing.T) {
+	tests := []struct {
+		name      string
+		snapshots []uint64
+		seqs      []uint64 // versions of one key, newest first
+		want      []bool
+	}{
+		{"no snapshots keeps the newest", nil, []uint64{9, 5, 2}, []bool{true, false, false}},
+		{"snapshot between versions", []uint64{6}, []uint64{9, 5, 2}, []bool{true, true, false}},
+		{"snapshot at a version", []uint64{5}, []uint64{9, 5, 2}, []bool{true, true, false}},
+		{"snapshot just before a version", []uint64{4}, []uint64{9, 5, 2}, []bool{true, false, true}},
+		{"snapshot older than every version", []uint64{1}, []uint64{9, 5, 2}, []bool{true, false, false}},
+		{"snapshot newer than every version", []uint64{20}, []uint64{9, 5, 2}, []bool{true, false, false}},
+		{"several snapshots", []uint64{3, 6, 7}, []uint64{9, 5, 2}, []bool{true, true, true}},
+		{"two snapshots read one version", []uint64{6, 7}, []uint64{9, 5, 2}, []bool{true, true, false}},
+	}
+	for _, tt := range tests {
+		f := newVersionFilter(tt.snapshots)
+		var got []bool
+		for _, seq := range tt.seqs {
+			got = append(got, f.keep("k", seq))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: kept %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Each key starts over at its newest version
+	f := newVersionFilter(nil)
+	for _, v := range []struct {
+		key  string
+		seq  uint64
+		want bool
+	}{{"a", 4, true}, {"a", 3, false}, {"b", 2, true}, {"b", 1, false}, {"c", 7, true}} {
+		if got := f.keep(v.key, v.seq); got != v.want {
+			t.Errorf("keep(%s, %d) = %v, want %v", v.key, v.seq, got, v.want)
+		}
+	}
+
+	if !newVersionFilter(nil).noSnapshotBefore(5) || !newVersionFilter([]uint64{5, 9}).noSnapshotBefore(5) ||
+		newVersionFilter([]uint64{4, 9}).noSnapshotBefore(5) {
+		t.Error("noSnapshotBefore disagrees with the oldest snapshot")
+	}
+}
+
+type modelVersion struct {
+	seq     uint64
+	val     string
+	deleted bool
+}
+
+// modelGet is the reference answer: the newest version of key written at or before seq
+func modelGet(history map[string][]modelVersion, key string, seq uint64) (string, bool) {
+	versions := history[key]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].seq <= seq && versions[i].deleted {
+			return "", false
+		}
+		if versions[i].seq <= seq {
+			return versions[i].val, true
+		}
+	}
+	return "", false
+}
+
+// newTestStore opens a store on dir without raft; writes go straight to its memtable
+func newTestStore(t *testing.T, opts Options) *Store {
+	t.Helper()
+	s := &Store{SstDir: t.TempDir(), opts: opts, ActiveMap: NewMemTable(mapLimit, nil)}
+	if err := s.loadTables(); err != nil {
+		t.Fatalf("loadTables: %v", err)
+	}
+	t.Cleanup(func() { _ = s.manifest.file.Close() })
+	return s
+}
+
+// flush writes the active memtable to an L0 table the way FlushWorker does
+func (s *Store) flushForTest(t *testing.T) {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	table := tableMeta{num: s.manifest.newFileNum(), level: 0}
+	if _, err := createSSTable(s.ActiveMap, s.SstDir, &table, s.opts.codecFor(0), s.snapshotSeqs()); err != nil {
+		t.Fatalf("createSSTable: %v", err)
+	}
+	if err := s.manifest.apply(versionEdit{added: []tableMeta{table}, appliedIndex: uint64(s.appliedIndex)}); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	s.refreshSSTables()
+	s.ActiveMap = NewMemTable(mapLimit, nil)
+}
+
+// Snapshots must read the same values after flushes and compactions dropped the versions nobody reads
+func TestReadsAtOlderSeqs(t *testing.T) {
+	opts := DefaultOptions()
+	opts.L0CompactionTrigger = 2
+	s := newTestStore(t, opts)
+
+	history := make(map[string][]modelVersion)
+	var snapshots []*Snapshot
+	seq := uint64(0)
+	for round := 0; round < 4; round++ {
+		for i := 0; i < 60; i++ {
+			seq++
+			key := fmt.Sprintf("key%02d", (i*7+round)%20)
+			v := modelVersion{seq: seq, val: fmt.Sprintf("%s@%d", key, seq), deleted: seq%9 == 0}
+			if err := s.ActiveMap.Index.Put(key, v.val, v.deleted, seq, 0); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			history[key] = append(history[key], v)
+			if seq%25 == 0 {
+				s.appliedIndex = int(seq)
+				snapshots = append(snapshots, s.NewSnapshot())
+			}
+		}
+		s.flushForTest(t)
+		if err := s.MaybeCompact(); err != nil {
+			t.Fatalf("MaybeCompact: %v", err)
+		}
+	}
+
+	check := func(stage string, seqs []uint64) {
+		for _, at := range seqs {
+			for k := 0; k < 20; k++ {
+				key := fmt.Sprintf("key%02d", k)
+				want, wantFound := modelGet(history, key, at)
+				got, found, err := s.GetAt(key, at)
+				if err != nil || found != wantFound || got != want {
+					t.Fatalf("%s: GetAt(%s, %d) = %q found=%v err=%v, want %q found=%v", stage, key, at, got, found, err, want, wantFound)
+				}
+			}
+		}
+	}
+	var open []uint64
+	for _, sn := range snapshots {
+		open = append(open, sn.Seq())
+	}
+	check("snapshots", append(open, math.MaxUint64))
+
+	// Once every snapshot is gone compaction keeps only the newest version of each key.
+	// Rewriting every key makes the next compaction merge all the tables.
+	for _, sn := range snapshots {
+		sn.Release()
+	}
+	for k := 0; k < 20; k++ {
+		seq++
+		key := fmt.Sprintf("key%02d", k)
+		v := modelVersion{seq: seq, val: fmt.Sprintf("%s@%d", key, seq)}
+		if err := s.ActiveMap.Index.Put(key, v.val, false, seq, 0); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		history[key] = append(history[key], v)
+	}
+	s.flushForTest(t)
+	s.opts.L0CompactionTrigger = 1
+	if err := s.MaybeCompact(); err != nil {
+		t.Fatalf("MaybeCompact: %v", err)
+	}
+	check("after release", []uint64{math.MaxUint64})
+
+	sources, err := s.openSources("", math.MaxUint64)
+	if err != nil {
+		t.Fatalf("openSources: %v", err)
+	}
+	versions := 0
+	for _, src := range sources {
+		for ; src.Valid(); src.Next() {
+			versions++
+		}
+		src.Close()
+	}
+	if versions != len(history) {
+		t.Errorf("%d versions left after compacting without snapshots, want %d", versions, len(history))
+	}
+}
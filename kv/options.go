@@ -0,0 +1,62 @@
+package kv
+
+import (
+	"KV-Store/sstable"
+	"strings"
+)
+
+// Options tunes the storage engine
+type Options struct {
+	BlockCacheSize int64 // byte budget of the SSTable block cache (uncompressed blocks)
+	// LevelCodecs is the block compression of tables written to each level;
+	// levels past the end use the last entry
+	LevelCodecs []sstable.Codec
+
+	L0CompactionTrigger int     // number of L0 files that triggers an L0 -> L1 compaction
+	BaseLevelSize       int64   // target size of L1 in bytes
+	LevelSizeMultiplier float64 // each level below L1 targets this many times the size of the one above
+	TargetFileSize      int64   // compaction starts a new output file once this many bytes are written
+}
+
+// DefaultOptions keeps short-lived L0 flushes uncompressed and compresses everything compaction writes
+func DefaultOptions() Options {
+	return Options{
+		BlockCacheSize: 64 * 1024 * 1024,
+		LevelCodecs:    []sstable.Codec{sstable.CodecNone, sstable.CodecFlate},
+
+		L0CompactionTrigger: 4,
+		BaseLevelSize:       64 * 1024 * 1024,
+		LevelSizeMultiplier: 10,
+		TargetFileSize:      8 * 1024 * 1024,
+	}
+}
+
+// ParseLevelCodecs parses a comma-separated codec list, one per level starting at L0 (e.g. "none,flate")
+func ParseLevelCodecs(list string) ([]sstable.Codec, error) {
+	var codecs []sstable.Codec
+	for _, name := range strings.Split(list, ",") {
+		codec, err := sstable.ParseCodec(name)
+		if err != nil {
+			return nil, err
+		}
+		codecs = append(codecs, codec)
+	}
+	return codecs, nil
+}
+
+// codecFor returns the compression for tables written to level
+func (o Options) codecFor(level int) sstable.Codec {
+	if len(o.LevelCodecs) == 0 {
+		return sstable.CodecNone
+	}
+	return o.LevelCodecs[min(level, len(o.LevelCodecs)-1)]
+}
+
+// maxBytesForLevel is the size level (>= 1) may grow to before it is compacted into the next one
+func (o Options) maxBytesForLevel(level int) float64 {
+	size := float64(o.BaseLevelSize)
+	for l := 1; l < level; l++ {
+		size *= o.LevelSizeMultiplier
+	}
+	return size
+}
@@ -0,0 +1,49 @@
+package kv
+
+import (
+	"KV-Store/pkg/metrics"
+	"KV-Store/sstable"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// A corrupt SSTable is quarantined in place: it stays in the manifest and in the read set, and its
+// reader fails every read of its key range with the CorruptionError. Dropping it instead would let
+// older tables answer for its keys with stale or deleted values. Compaction leaves it alone, and
+// installing a snapshot from the leader replaces it along with every other table.
+
+// quarantine records the corrupt table named by err. Errors that are not corruption are ignored.
+func (s *Store) quarantine(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.noteQuarantined(err)
+}
+
+// noteQuarantined logs and counts a corrupt table the first time it is seen; it must be called with s.mu held
+func (s *Store) noteQuarantined(err error) {
+	var ce *sstable.CorruptionError
+	if !errors.As(err, &ce) || s.quarantined[ce.File] {
+		return
+	}
+	if s.quarantined == nil {
+		s.quarantined = make(map[string]bool)
+	}
+	s.quarantined[ce.File] = true
+	fmt.Printf("[Quarantine] %v, failing reads of its keys until a snapshot replaces it\n", ce)
+	metrics.QuarantinedTables.WithLabelValues(strconv.Itoa(s.Me)).Inc()
+}
+
+// quarantinedTables returns the file numbers of the live tables that are quarantined; it must be called with s.mu held
+func (s *Store) quarantinedTables() map[uint64]bool {
+	nums := make(map[uint64]bool)
+	for _, r := range s.ssTables {
+		if r.Quarantined() == nil {
+			continue
+		}
+		if _, num, ok := parseTableName(r.Filename()); ok {
+			nums[num] = true
+		}
+	}
+	return nums
+}
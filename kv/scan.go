@@ -0,0 +1,138 @@
+package kv
+
+import (
+	"KV-Store/pkg/arena"
+	"KV-Store/sstable"
+)
+
+// KV is a live key-value pair returned by Scan
+type KV struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// memSource walks every version in a memtable's skiplist as a merge source; the skiplist stays readable while writers insert
+type memSource struct {
+	it          *arena.Iterator
+	k           string
+	val         []byte
+	seq         uint64
+	expiresAt   int64
+	isTombstone bool
+}
+
+func newMemSource(table *MemTable, start string) *memSource {
+	src := &memSource{}
+	if table == nil {
+		return src
+	}
+	src.it = table.Index.NewIterator()
+	src.it.Seek(start)
+	src.load()
+	return src
+}
+
+// load caches the current version so the merge can compare it without going back to the arena
+func (m *memSource) load() {
+	if m.it.Valid() {
+		m.k = m.it.Key()
+		m.val, m.seq, m.isTombstone = m.it.Value()
+		m.expiresAt = m.it.ExpiresAt()
+	}
+}
+
+func (m *memSource) Valid() bool       { return m.it != nil && m.it.Valid() }
+func (m *memSource) Key() string       { return m.k }
+func (m *memSource) Value() []byte     { return m.val }
+func (m *memSource) Seq() uint64       { return m.seq }
+func (m *memSource) ExpiresAt() int64  { return m.expiresAt }
+func (m *memSource) IsTombstone() bool { return m.isTombstone }
+func (m *memSource) Next()             { m.it.Next(); m.load() }
+func (m *memSource) Err() error        { return nil }
+func (m *memSource) Close()            {}
+
+// openSources opens every memtable and SSTable positioned at start, newest first, to be read as of seq.
+// It runs under the read lock so compaction cannot delete a file from under us;
+// open file handles stay readable after the file is unlinked.
+func (s *Store) openSources(start string, seq uint64) ([]sstable.Source, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if seq < s.historyFloor {
+		return nil, ErrSnapshotTooOld
+	}
+
+	sources := []sstable.Source{
+		newMemSource(s.ActiveMap, start),
+		newMemSource(s.frozenMap, start),
+	}
+	for _, r := range s.ssTables {
+		it, err := r.NewIteratorAt(start)
+		if err != nil {
+			for _, src := range sources {
+				src.Close()
+			}
+			return nil, err
+		}
+		sources = append(sources, it.AsSource())
+	}
+	return sources, nil
+}
+
+// Scan returns up to limit live keys in [start, end) in key order, merging the memtables and
+// every SSTable: the newest version of a key wins and deleted or expired keys are skipped.
+// An empty end means no upper bound, limit <= 0 means no limit.
+// more reports whether live keys remain after the last one returned.
+func (s *Store) Scan(start, end string, limit int) (items []KV, more bool, err error) {
+	// Read at the applied index so a write batch being applied shows up all at once or not at all
+	s.mu.RLock()
+	seq := uint64(s.appliedIndex)
+	s.mu.RUnlock()
+	return s.ScanAt(start, end, limit, seq)
+}
+
+// ScanAt is Scan as of sequence number seq: every key shows its newest version written at or before seq
+func (s *Store) ScanAt(start, end string, limit int, seq uint64) (items []KV, more bool, err error) {
+	sources, err := s.openSources(start, seq)
+	if err != nil {
+		return nil, false, err
+	}
+	merged := sstable.NewMergingIteratorAt(sources, seq)
+	defer merged.Close()
+
+	now := s.readTime()
+	for ; merged.Valid(); merged.Next() {
+		if end != "" && merged.Key() >= end {
+			break
+		}
+		if merged.IsTombstone() || expired(merged.ExpiresAt(), now) {
+			continue
+		}
+		if limit > 0 && len(items) == limit {
+			return items, true, nil
+		}
+		items = append(items, KV{Key: merged.Key(), Value: string(merged.Value())})
+	}
+	if err := merged.Err(); err != nil {
+		s.quarantine(err)
+		return nil, false, err
+	}
+	return items, false, nil
+}
+
+// ScanPrefix returns up to limit live keys starting with prefix
+func (s *Store) ScanPrefix(prefix string, limit int) ([]KV, bool, error) {
+	return s.Scan(prefix, PrefixEnd(prefix), limit)
+}
+
+// PrefixEnd returns the smallest key greater than every key starting with prefix,
+// or "" when there is none (the prefix is empty or all 0xff bytes)
+func PrefixEnd(prefix string) string {
+	b := []byte(prefix)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1])
+		}
+	}
+	return ""
+}
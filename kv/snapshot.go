@@ -0,0 +1,213 @@
+package kv
+
+import (
+	"KV-Store/sstable"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// maybeSnapshot hands raft a snapshot once its in-memory log grows past snapshotThreshold
+func (s *Store) maybeSnapshot(index int) {
+	if s.Raft.LogSize() < snapshotThreshold {
+		return
+	}
+	data, err := s.snapshotState()
+	if err != nil {
+		fmt.Printf("Failed to snapshot state at index %d: %v\n", index, err)
+		return
+	}
+	s.Raft.Snapshot(index, data)
+
+	// Flush what the snapshot covers, so a restart finds it in the tables instead of rebuilding them from the snapshot
+	s.mu.Lock()
+	if s.frozenMap == nil && s.ActiveMap.Index.Len() > 0 {
+		s.RotateTable()
+	}
+	s.mu.Unlock()
+}
+
+// snapshotMagic starts every snapshot, the last byte is the format version
+const snapshotMagic = "SISYSNP\x01"
+
+// snapshotState serializes every live key in the store with its version and expiry.
+// Format: [Magic(8)][Clock(8)] then for each entry [KeyLen(4)][ValLen(4)][Seq(8)][ExpiresAt(8)][KeyBytes][ValBytes], keys sorted.
+// Versions, expiries and the clock must survive a snapshot install: conditional writes compare them and every replica has to agree.
+func (s *Store) snapshotState() ([]byte, error) {
+	// Runs on the apply loop, so no write can slip in between the sources
+	sources, err := s.openSources("", math.MaxUint64)
+	if err != nil {
+		return nil, err
+	}
+	merged := sstable.NewMergingIterator(sources)
+	defer merged.Close()
+
+	s.mu.RLock()
+	clock := s.clock
+	s.mu.RUnlock()
+	buf := []byte(snapshotMagic)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(clock))
+	var lenBuf [24]byte
+	for ; merged.Valid(); merged.Next() {
+		if merged.IsTombstone() || expired(merged.ExpiresAt(), clock) {
+			continue
+		}
+		k, v := merged.Key(), merged.Value()
+		binary.LittleEndian.PutUint32(lenBuf[0:4], uint32(len(k)))
+		binary.LittleEndian.PutUint32(lenBuf[4:8], uint32(len(v)))
+		binary.LittleEndian.PutUint64(lenBuf[8:16], merged.Seq())
+		binary.LittleEndian.PutUint64(lenBuf[16:24], uint64(merged.ExpiresAt()))
+		buf = append(buf, lenBuf[:]...)
+		buf = append(buf, k...)
+		buf = append(buf, v...)
+	}
+	if err := merged.Err(); err != nil {
+		s.quarantine(err)
+		return nil, err
+	}
+	return buf, nil
+}
+
+// restoreSnapshot throws away the local state and replaces it with the snapshot contents taken at index.
+// Raft hands its on-disk snapshot over on every restart: when the tables already hold every write up to
+// index they are kept, and raft replays the log after it on top of them.
+func (s *Store) restoreSnapshot(data []byte, index uint64) error {
+	s.compactionMu.Lock()
+	defer s.compactionMu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if index <= s.manifest.applied() {
+		clock, err := snapshotClock(data)
+		if err != nil {
+			return err
+		}
+		// Replayed entries must judge expiry as they did the first time, starting from the clock at index
+		s.clock = max(s.clock, clock)
+		s.historyFloor = max(s.historyFloor, index)
+		fmt.Printf("[Snapshot] Tables already hold index %d, keeping them\n", index)
+		return nil
+	}
+
+	// Let an in-progress flush finish so it does not resurrect old data
+	for s.frozenMap != nil {
+		s.cond.Wait()
+	}
+
+	// One manifest edit swaps every current table for the snapshot table
+	old := s.manifest.live()
+	edit := versionEdit{appliedIndex: index}
+	for _, t := range old {
+		edit.deleted = append(edit.deleted, t.num)
+	}
+	entries, clock, err := parseSnapshot(data)
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		table := tableMeta{num: s.manifest.newFileNum(), level: 0}
+		if err := writeSnapshotTable(entries, s.SstDir, &table, s.opts.codecFor(0)); err != nil {
+			return err
+		}
+		edit.added = append(edit.added, table)
+	}
+	if err := s.manifest.apply(edit); err != nil {
+		for _, t := range edit.added {
+			_ = os.Remove(filepath.Join(s.SstDir, t.fileName()))
+		}
+		return err
+	}
+	for _, t := range old {
+		_ = os.Remove(filepath.Join(s.SstDir, t.fileName()))
+	}
+	s.ActiveMap = NewMemTable(mapLimit, s.ActiveMap.Wal)
+	// The snapshot keeps one version per key, MVCC snapshots taken before it can no longer be served
+	s.historyFloor = index
+	s.clock = clock
+	s.refreshSSTables()
+	fmt.Printf("[Snapshot] Restored %d bytes of state\n", len(data))
+	return nil
+}
+
+// snapshotEntry is one live key of a snapshot
+type snapshotEntry struct {
+	key       []byte
+	val       []byte
+	seq       uint64
+	expiresAt int64
+}
+
+// snapshotClock reads the clock from the header of a snapshot without decoding its entries
+func snapshotClock(data []byte) (int64, error) {
+	if !hasMagic(data, snapshotMagic) {
+		return 0, errors.New("corrupt snapshot: unknown format")
+	}
+	if len(data) < len(snapshotMagic)+8 {
+		return 0, errors.New("corrupt snapshot: truncated clock")
+	}
+	return int64(binary.LittleEndian.Uint64(data[len(snapshotMagic):])), nil
+}
+
+// parseSnapshot decodes the entries and the clock of a snapshot, see snapshotState for the format
+func parseSnapshot(data []byte) ([]snapshotEntry, int64, error) {
+	const headerSize = 24
+	clock, err := snapshotClock(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	data = data[len(snapshotMagic)+8:]
+
+	var entries []snapshotEntry
+	for cursor := 0; cursor < len(data); {
+		if cursor+headerSize > len(data) {
+			return nil, 0, errors.New("corrupt snapshot: truncated header")
+		}
+		kLen := int(binary.LittleEndian.Uint32(data[cursor : cursor+4]))
+		vLen := int(binary.LittleEndian.Uint32(data[cursor+4 : cursor+8]))
+		e := snapshotEntry{
+			seq:       binary.LittleEndian.Uint64(data[cursor+8 : cursor+16]),
+			expiresAt: int64(binary.LittleEndian.Uint64(data[cursor+16 : cursor+24])),
+		}
+		cursor += headerSize
+		if cursor+kLen+vLen > len(data) {
+			return nil, 0, errors.New("corrupt snapshot: truncated entry")
+		}
+		e.key = data[cursor : cursor+kLen]
+		e.val = data[cursor+kLen : cursor+kLen+vLen]
+		entries = append(entries, e)
+		cursor += kLen + vLen
+	}
+	return entries, clock, nil
+}
+
+func hasMagic(data []byte, magic string) bool {
+	return len(data) >= len(magic) && string(data[:len(magic)]) == magic
+}
+
+// writeSnapshotTable writes the (already sorted) snapshot entries into the new L0 table t
+func writeSnapshotTable(entries []snapshotEntry, sstDir string, t *tableMeta, codec sstable.Codec) error {
+	filename := filepath.Join(sstDir, t.fileName())
+	builder, err := sstable.NewCompressedBuilder(filename, len(entries), codec)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot sstable: %w", err)
+	}
+	for _, e := range entries {
+		if err := builder.Add(e.key, e.val, e.seq, e.expiresAt, false); err != nil {
+			_ = builder.File.Close()
+			_ = os.Remove(filename)
+			return fmt.Errorf("failed to add key to snapshot sstable: %w", err)
+		}
+	}
+	if err := builder.Close(); err != nil {
+		_ = os.Remove(filename)
+		return err
+	}
+	t.size = builder.EstimatedSize()
+	t.smallest, t.largest = builder.KeyRange()
+	t.smallestSeq, t.largestSeq = builder.SeqRange()
+	return nil
+}
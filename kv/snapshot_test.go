@@ -0,0 +1,113 @@
+package kv
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// encodeSnapshot lays entries out the way snapshotState does
+func encodeSnapshot(clock int64, entries []snapshotEntry) []byte {
+	buf := []byte(snapshotMagic)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(clock))
+	for _, e := range entries {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(e.key)))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(e.val)))
+		buf = binary.LittleEndian.AppendUint64(buf, e.seq)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(e.expiresAt))
+		buf = append(buf, e.key...)
+		buf = append(buf, e.val...)
+	}
+	return buf
+}
+
+func TestParseSnapshot(t *testing.T) {
+	want := []snapshotEntry{
+		{key: []byte("a"), val: []byte("1"), seq: 7},
+		{key: []byte("b\x00\xff"), val: []byte{}, seq: 9, expiresAt: 1700000000000000000},
+		{key: []byte("c"), val: []byte("three"), seq: 3},
+	}
+	data := encodeSnapshot(42, want)
+
+	entries, clock, err := parseSnapshot(data)
+	if err != nil {
+		t.Fatalf("parseSnapshot: %v", err)
+	}
+	if clock != 42 || len(entries) != len(want) {
+		t.Fatalf("clock %d with %d entries, want 42 with %d", clock, len(entries), len(want))
+	}
+	for i, e := range entries {
+		w := want[i]
+		if string(e.key) != string(w.key) || string(e.val) != string(w.val) || e.seq != w.seq || e.expiresAt != w.expiresAt {
+			t.Errorf("entry %d = %+v, want %+v", i, e, w)
+		}
+	}
+
+	if entries, _, err := parseSnapshot(encodeSnapshot(0, nil)); err != nil || len(entries) != 0 {
+		t.Errorf("empty snapshot = %d entries, err %v", len(entries), err)
+	}
+}
+
+func TestParseSnapshotRejectsBadInput(t *testing.T) {
+	good := encodeSnapshot(1, []snapshotEntry{{key: []byte("key"), val: []byte("value"), seq: 1}})
+	bad := map[string][]byte{
+		"no magic":          good[len(snapshotMagic):],
+		"other version":     append([]byte("SISYSNP\x02"), good[len(snapshotMagic):]...),
+		"truncated clock":   good[:len(snapshotMagic)+4],
+		"truncated header":  good[:len(snapshotMagic)+8+10],
+		"truncated entry":   good[:len(good)-1],
+		"entry length lies": append(append([]byte{}, good...), 0xff, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0),
+	}
+	for name, data := range bad {
+		if _, _, err := parseSnapshot(data); err == nil {
+			t.Errorf("%s: parsed without error", name)
+		}
+	}
+}
+
+// Raft hands its snapshot over on every restart; tables that already hold its index must be kept
+func TestRestoreSnapshotKeepsTablesThatHoldIt(t *testing.T) {
+	s := newTestStore(t, DefaultOptions())
+	for seq := uint64(1); seq <= 5; seq++ {
+		if err := s.applyInternal(fmt.Sprintf("k%d", seq), "v", false, seq, 0); err != nil {
+			t.Fatalf("applyInternal: %v", err)
+		}
+	}
+	s.appliedIndex = 5
+	s.flushForTest(t)
+	before := liveNums(s.manifest)
+	snap := encodeSnapshot(42, []snapshotEntry{{key: []byte("other"), val: []byte("x"), seq: 4}})
+
+	if err := s.restoreSnapshot(snap, 4); err != nil {
+		t.Fatalf("restoreSnapshot at 4: %v", err)
+	}
+	if got := liveNums(s.manifest); !reflect.DeepEqual(got, before) {
+		t.Errorf("live tables after a snapshot the tables hold = %v, want them kept %v", got, before)
+	}
+	if _, found, _ := s.GetAt("k5", math.MaxUint64); !found {
+		t.Error("k5 is gone after a snapshot the tables hold")
+	}
+	if _, found, _ := s.GetAt("other", math.MaxUint64); found {
+		t.Error("a snapshot the tables hold was loaded anyway")
+	}
+	if s.clock != 42 {
+		t.Errorf("clock = %d, want the snapshot's 42", s.clock)
+	}
+
+	// A snapshot past the tables, e.g. from InstallSnapshot, replaces them
+	if err := s.restoreSnapshot(snap, 6); err != nil {
+		t.Fatalf("restoreSnapshot at 6: %v", err)
+	}
+	if _, found, _ := s.GetAt("k5", math.MaxUint64); found {
+		t.Error("k5 survived a snapshot past the tables")
+	}
+	if val, found, _ := s.GetAt("other", math.MaxUint64); !found || val != "x" {
+		t.Errorf("GetAt(other) = %q found=%v after restoring, want \"x\"", val, found)
+	}
+	// After a restart the manifest still knows which index the tables hold
+	if got := openTestManifest(t, s.SstDir).applied(); got != 6 {
+		t.Errorf("applied index after reopening = %d, want 6", got)
+	}
+}
@@ -2,17 +2,16 @@ package kv
 
 import (
 	"KV-Store/pkg/arena"
+	"KV-Store/pkg/metrics"
 	"KV-Store/pkg/wal"
-	pb "KV-Store/proto"
 	"KV-Store/raft"
 	"KV-Store/sstable"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"os"
-	"path/filepath"
-	"sort"
-	"strings"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -25,31 +24,50 @@ var opResultPool = sync.Pool{
 }
 
 type MemTable struct {
-	Index map[string]int
+	Index *arena.SkipList // ordered key -> versions newest first, nodes live in Arena
 	Arena *arena.Arena
 	Size  uint32
 	Wal   *wal.WAL
+	// applied is the raft index every write up to which is in this memtable or an older table, set when it is frozen
+	applied uint64
 }
 
 type Store struct {
-	ActiveMap *MemTable
-	frozenMap *MemTable
-	ssTables  []*sstable.Reader
-	WalDir    string
-	SstDir    string
-	walSeq    int64
-	FlushChan chan struct{} // FrozenMem -> Active Mem
-	Me        int           // same as raft.me, for prometheus metrics
+	ActiveMap  *MemTable
+	frozenMap  *MemTable
+	ssTables   []*sstable.Reader // newest first, each holding a reference owned by the store
+	seqBound   []uint64          // seqBound[i] is the highest sequence number in ssTables[i:]
+	blockCache *sstable.BlockCache
+	opts       Options
+	WalDir     string
+	SstDir     string
+	walSeq     int64
+	FlushChan  chan struct{} // FrozenMem -> Active Mem
+	Me         int           // same as raft.me, for prometheus metrics
 	// Raft Channels
 	Raft         *raft.Raft
 	notifyChans  map[int]chan OpResult // return client -> success
-	applyCh      chan raft.LogEntry    // applied cmds -> internal storage
+	appliedIndex int                   // last raft index applied to the store
+	applyCh      chan raft.ApplyMsg    // applied cmds -> internal storage
 	mu           sync.RWMutex
 	compactionMu sync.Mutex
 	cond         *sync.Cond
+	manifest     *manifest // source of truth for the live SSTables and their levels
+
+	snapshots    map[uint64]int // open MVCC snapshots: sequence number -> count
+	historyFloor uint64         // index of the last raft snapshot installed, older versions are gone
+
+	// clock is the highest leader timestamp applied so far (unix nanoseconds). Conditional writes and
+	// compaction judge expiry by it, so every replica agrees on which keys have expired at each index.
+	clock int64
+
+	watches *watchHub // streams applied changes to watchers
+
+	quarantined map[string]bool // corrupt tables already reported, by file name
 }
 
-func NewKVStore(peers []pb.RaftServiceClient, me int) (*Store, error) {
+// NewKVStore opens the local storage and starts raft with the bootstrap membership (node id -> gRPC address)
+func NewKVStore(members map[int]string, me int, opts Options) (*Store, error) {
 	walDir := fmt.Sprintf("Storage/wal/wal_%d", me)
 	sstDir := fmt.Sprintf("Storage/data/data_%d", me)
 
@@ -64,7 +82,7 @@ func NewKVStore(peers []pb.RaftServiceClient, me int) (*Store, error) {
 
 	currentWal, _ := wal.OpenWAL(walDir, seqId)
 	entries, _ := currentWal.Recover()
-	applyCh := make(chan raft.LogEntry)
+	applyCh := make(chan raft.ApplyMsg)
 	store := &Store{
 		ActiveMap: NewMemTable(mapLimit, currentWal),
 		frozenMap: nil,
@@ -73,84 +91,136 @@ func NewKVStore(peers []pb.RaftServiceClient, me int) (*Store, error) {
 		FlushChan: make(chan struct{}, 1),
 		applyCh:   applyCh,
 		Me:        me,
+		opts:      opts,
+		watches:   newWatchHub(me),
 	}
+	store.blockCache = sstable.NewBlockCache(opts.BlockCacheSize, strconv.Itoa(me))
 	store.cond = sync.NewCond(&store.mu)
 	for _, entry := range entries {
 		k := string(entry.Key)
 		v := string(entry.Value)
 
-		var offset int
 		var err error
 		switch entry.Cmd {
 		case wal.CmdPut:
-			offset, err = store.ActiveMap.Arena.Put(k, v, false)
-			if err != nil {
-				return nil, err
-			}
+			err = store.ActiveMap.Index.Put(k, v, false, entry.Seq, 0)
 		case wal.CmdDelete:
-			offset, err = store.ActiveMap.Arena.Put(k, v, true) //handles tombstone
-			if err != nil {
-				return nil, err
-			}
+			err = store.ActiveMap.Index.Put(k, v, true, entry.Seq, 0) //handles tombstone
+		}
+		if err != nil {
+			return nil, err
 		}
-		store.ActiveMap.Index[k] = offset
 		store.ActiveMap.Size += uint32(len(k) + len(v))
 	}
-	store.refreshSSTables()
-	store.Raft = raft.Make(peers, me, applyCh)
+	if err := store.loadTables(); err != nil {
+		return nil, fmt.Errorf("failed to load sstables: %w", err)
+	}
+	store.Raft = raft.Make(members, me, applyCh)
 	go store.readAppliedLogs()
 	go store.FlushWorker()
+	// Levels left over target by a crash or by smaller targets than last run
+	go func() { _ = store.MaybeCompact() }()
 	return store, nil
 }
 
 // Loop that pulls data from Raft and writes to Store
 func (s *Store) readAppliedLogs() {
 	for msg := range s.applyCh {
+		if msg.SnapshotValid {
+			if err := s.restoreSnapshot(msg.Snapshot, uint64(msg.SnapshotIndex)); err != nil {
+				fmt.Printf("Failed to restore snapshot at index %d: %v\n", msg.SnapshotIndex, err)
+			}
+			s.setAppliedIndex(msg.SnapshotIndex)
+			// Watchers cannot tell what the snapshot changed
+			s.watches.reset(uint64(msg.SnapshotIndex))
+			continue
+		}
+		// Raft-internal entries only move the applied index forward
+		if !msg.CommandValid {
+			s.setAppliedIndex(msg.Index)
+			s.watches.publish(uint64(msg.Index), nil)
+			continue
+		}
+
 		var cmd raftCmd
-		if err := json.Unmarshal(msg.Command, &cmd); err != nil {
+		err := json.Unmarshal(msg.Command, &cmd)
+		if err == nil {
+			err = cmd.decodeBinary()
+		}
+		if err != nil {
+			s.setAppliedIndex(msg.Index)
+			s.watches.publish(uint64(msg.Index), nil)
 			continue
 		}
 
-		var err error
-		if cmd.Op == CmdPut {
-			err = s.applyInternal(cmd.Key, cmd.Value, false)
-		} else if cmd.Op == CmdDelete {
-			err = s.applyInternal(cmd.Key, "", true)
+		s.advanceClock(cmd.Time)
+		res := OpResult{Value: cmd.Value}
+		switch cmd.Op {
+		case CmdPut:
+			var expiresAt int64
+			if cmd.TTL > 0 {
+				expiresAt = cmd.Time + int64(cmd.TTL)
+			}
+			res.Err = s.applyInternal(cmd.Key, cmd.Value, false, uint64(msg.Index), expiresAt)
+		case CmdDelete:
+			res.Err = s.applyInternal(cmd.Key, "", true, uint64(msg.Index), 0)
+		case CmdWriteBatch:
+			res.Err = s.applyBatch(cmd.Batch, uint64(msg.Index))
+		case CmdCompareAndSwap, CmdPutIfAbsent, CmdDeleteIfEquals:
+			res = s.applyConditional(cmd, uint64(msg.Index))
 		}
 
 		s.mu.Lock()
+		s.appliedIndex = msg.Index
 		// We check if any client is waiting for this specific log index
 		if ch, ok := s.notifyChans[msg.Index]; ok {
-			ch <- OpResult{
-				Value: cmd.Value,
-				Err:   err,
-			}
+			ch <- res
 			delete(s.notifyChans, msg.Index)
 		}
 		s.mu.Unlock()
+
+		s.watches.publish(uint64(msg.Index), changeEvents(cmd, uint64(msg.Index), res))
+		s.maybeSnapshot(msg.Index)
 	}
 }
 
-// Put in storage
-func (s *Store) applyInternal(key string, val string, isDelete bool) error {
+// advanceClock moves the store's clock up to the leader timestamp of the command being applied
+func (s *Store) advanceClock(t int64) {
+	s.mu.Lock()
+	s.clock = max(s.clock, t)
+	s.mu.Unlock()
+}
+
+// readTime is the time reads judge expiry by: the local clock, but never behind the applied log,
+// so a value compaction already dropped as expired never reads as live
+func (s *Store) readTime() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return max(time.Now().UnixNano(), s.clock)
+}
+
+// Put in storage; seq is the raft index of the write and decides which version of a key is newest.
+// expiresAt is when the value expires in unix nanoseconds, 0 for never.
+func (s *Store) applyInternal(key string, val string, isDelete bool, seq uint64, expiresAt int64) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	//  size: Header(1) + KeyLen(2) + ValLen(4) + Key + Val
-	entrySize := 1 + 2 + 4 + len(key) + len(val)
-	if int(s.ActiveMap.Size)+entrySize > mapLimit {
-		if s.frozenMap != nil {
-			return errors.New("write stall: memTable flushing")
-		}
-		s.RotateTable()
+	//  size: Older(4) + Header(1) + KeyLen(2) + ValLen(4) + Seq(8) + Key + Val [+ ExpiresAt(8)]
+	entrySize := arena.EntryHeaderSize + len(key) + len(val)
+	if expiresAt != 0 {
+		entrySize += arena.ExpirySize
+	}
+	// The arena also holds the skiplist nodes, so check what it really has left
+	if err := s.makeRoom(entrySize + arena.MaxNodeSize); err != nil {
+		return err
 	}
 
 	// Write in logs
 	/*
 		var er error
 		if isDelete {
-			er = s.activeMap.Wal.Write(key, val, wal.CmdDelete)
+			er = s.activeMap.Wal.Write(key, val, wal.CmdDelete, seq)
 		} else {
-			er = s.activeMap.Wal.Write(key, val, wal.CmdPut)
+			er = s.activeMap.Wal.Write(key, val, wal.CmdPut, seq)
 
 		}
 		if er != nil {
@@ -158,26 +228,109 @@ func (s *Store) applyInternal(key string, val string, isDelete bool) error {
 		}
 
 	*/
-	offset, err := s.ActiveMap.Arena.Put(key, val, isDelete)
-	if err != nil {
+	if err := s.ActiveMap.Index.Put(key, val, isDelete, seq, expiresAt); err != nil {
 		return errors.New("failed to put key " + key + ":" + err.Error())
 	}
-	s.ActiveMap.Index[key] = offset
 	s.ActiveMap.Size += uint32(entrySize)
 	return nil
 }
 
+// applyBatch puts every op of a write batch at seq under one lock, so readers see all of it or none.
+// Later ops on the same key win.
+func (s *Store) applyBatch(ops []BatchOp, seq uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The whole batch goes into one memtable
+	if err := s.makeRoom(batchSize(ops)); err != nil {
+		return err
+	}
+	for _, op := range ops {
+		val := op.Value
+		if op.Delete {
+			val = ""
+		}
+		if err := s.ActiveMap.Index.Put(op.Key, val, op.Delete, seq, 0); err != nil {
+			return errors.New("failed to put key " + op.Key + ":" + err.Error())
+		}
+		s.ActiveMap.Size += uint32(arena.EntryHeaderSize + len(op.Key) + len(val))
+	}
+	return nil
+}
+
+// batchSize is the most memtable space ops can take: every op may add an entry and a skiplist node
+func batchSize(ops []BatchOp) int {
+	size := 0
+	for _, op := range ops {
+		size += arena.EntryHeaderSize + arena.MaxNodeSize + len(op.Key) + len(op.Value)
+	}
+	return size
+}
+
+// makeRoom rotates the active memtable unless it has size bytes left; it must be called with s.mu held
+func (s *Store) makeRoom(size int) error {
+	if size > mapLimit {
+		return fmt.Errorf("write of %d bytes does not fit in a memtable", size)
+	}
+	if s.ActiveMap.Arena.Size()+size > mapLimit {
+		if s.frozenMap != nil {
+			return errors.New("write stall: memTable flushing")
+		}
+		s.RotateTable()
+	}
+	return nil
+}
+
 func (s *Store) Put(key string, val string, isDelete bool) error {
 	op := CmdPut
 	if isDelete {
 		op = CmdDelete
 	}
-	cmd := raftCmd{Op: op, Key: key, Value: val}
+	return s.propose(raftCmd{Op: op, Key: key, Value: val}).Err
+}
+
+// PutWithTTL writes val for key that reads as deleted once ttl has passed. The expiry is fixed by the
+// leader's clock when the write is proposed.
+func (s *Store) PutWithTTL(key string, val string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+	return s.propose(raftCmd{Op: CmdPut, Key: key, Value: val, TTL: ttl}).Err
+}
+
+// PutBatch applies a list of puts and deletes atomically: the batch is one raft entry, so it costs
+// one consensus round and either every op is applied or none is.
+func (s *Store) PutBatch(ops []BatchOp) error {
+	if len(ops) == 0 {
+		return nil
+	}
+	for _, op := range ops {
+		if op.Key == "" {
+			return ErrEmptyKey
+		}
+		if len(op.Key) > MaxKeyLen {
+			return ErrKeyTooLarge
+		}
+	}
+	// Check the space applyBatch will reserve: a batch that passes here must apply on every replica
+	if batchSize(ops) > maxBatchBytes {
+		return ErrBatchTooLarge
+	}
+	return s.propose(raftCmd{Op: CmdWriteBatch, Batch: ops}).Err
+}
+
+// propose stamps cmd with the leader's clock, replicates it through raft and waits until it is
+// applied locally; Err reports any failure
+func (s *Store) propose(cmd raftCmd) OpResult {
+	if len(cmd.Key) > MaxKeyLen {
+		return OpResult{Err: ErrKeyTooLarge}
+	}
+	cmd.Time = time.Now().UnixNano()
+	cmd.encodeBinary()
 	cmdBytes, _ := json.Marshal(cmd)
 
 	index, _, isLeader := s.Raft.Start(cmdBytes)
 	if !isLeader {
-		return fmt.Errorf("not leader")
+		return OpResult{Err: raft.ErrNotLeader}
 	}
 
 	// Get channel from pool
@@ -191,15 +344,14 @@ func (s *Store) Put(key string, val string, isDelete bool) error {
 	s.mu.Unlock()
 
 	// wait for consensus to replicate
-	var result error
+	var result OpResult
 	select {
-	case res := <-ch:
-		result = res.Err
+	case result = <-ch:
 	case <-time.After(2 * time.Second):
 		s.mu.Lock()
 		delete(s.notifyChans, index)
 		s.mu.Unlock()
-		result = fmt.Errorf("timeout waiting for consensus")
+		result.Err = ErrTimeout
 	}
 
 	// Return channel to pool
@@ -212,60 +364,137 @@ func (s *Store) Put(key string, val string, isDelete bool) error {
 	return result
 }
 
-func (s *Store) Get(key string) (string, bool) {
+func (s *Store) setAppliedIndex(index int) {
+	s.mu.Lock()
+	s.appliedIndex = index
+	s.mu.Unlock()
+}
+
+// GetLinearizable serves a read that reflects every write acknowledged before it started
+func (s *Store) GetLinearizable(key string) (string, bool, error) {
+	if err := s.ReadBarrier(); err != nil {
+		return "", false, err
+	}
+	return s.Get(key)
+}
+
+// ReadBarrier waits until local reads reflect every write acknowledged before it was called.
+// Only the leader can pass it: under a valid leader lease the commit index is used as is,
+// otherwise raft confirms leadership via ReadIndex. Either way we wait until the store
+// has applied up to that index.
+func (s *Store) ReadBarrier() error {
+	id := fmt.Sprintf("%d", s.Me)
+	readIndex, ok := s.Raft.LeaseReadIndex()
+	if ok {
+		metrics.LinearizableReads.WithLabelValues(id, "lease").Inc()
+	} else {
+		var err error
+		readIndex, err = s.Raft.ReadIndex()
+		if err != nil {
+			return err
+		}
+		metrics.LinearizableReads.WithLabelValues(id, "read_index").Inc()
+	}
+	return s.waitApplied(readIndex)
+}
+
+// waitApplied blocks until the state machine has caught up with index
+func (s *Store) waitApplied(index int) error {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		s.mu.RLock()
+		applied := s.appliedIndex
+		s.mu.RUnlock()
+		if applied >= index {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout waiting for index %d to be applied", index)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Get reads the newest local value of key. A corrupt SSTable on the read path returns an error
+// and is quarantined: reads of its keys keep failing instead of letting an older table answer.
+// An expired key is not found.
+func (s *Store) Get(key string) (string, bool, error) {
+	return s.GetAt(key, math.MaxUint64)
+}
+
+// GetAt reads key as of sequence number seq: the newest version written at or before it.
+// Older versions only survive compaction while a snapshot reads them, see NewSnapshot.
+func (s *Store) GetAt(key string, seq uint64) (string, bool, error) {
+	val, _, found, err := s.getVersion(key, seq, time.Now().UnixNano())
+	return val, found, err
+}
+
+// GetVersion reads the newest local value of key and the raft index that wrote it
+func (s *Store) GetVersion(key string) (string, uint64, bool, error) {
+	return s.getVersion(key, math.MaxUint64, time.Now().UnixNano())
+}
+
+// getVersion finds the newest version of key written at or before seq; a deleted key is not found,
+// nor is one that expired at now or at the store's clock, whichever is later
+func (s *Store) getVersion(key string, seq uint64, now int64) (string, uint64, bool, error) {
 	s.mu.RLock()
+	if seq < s.historyFloor {
+		s.mu.RUnlock()
+		return "", 0, false, ErrSnapshotTooOld
+	}
+	now = max(now, s.clock)
 	// 1. Check active table
-	if val, isTomb, found := checkTable(s.ActiveMap, key); found {
+	if val, version, expiresAt, isTomb, found := checkTable(s.ActiveMap, key, seq); found {
 		s.mu.RUnlock()
-		if isTomb {
-			return "", false
+		if isTomb || expired(expiresAt, now) {
+			return "", 0, false, nil
 		}
-		return val, true
+		return val, version, true, nil
 	}
 	// 2. Check frozen table
-	if val, isTomb, found := checkTable(s.frozenMap, key); found {
+	if val, version, expiresAt, isTomb, found := checkTable(s.frozenMap, key, seq); found {
 		s.mu.RUnlock()
-		if isTomb {
-			return "", false
+		if isTomb || expired(expiresAt, now) {
+			return "", 0, false, nil
 		}
-		return val, true
+		return val, version, true, nil
+	}
+	// Pin the current tables: compaction may swap them out while we read.
+	// Every write in a memtable is newer than the tables, so only the tables need sequence numbers compared.
+	tables := make([]*sstable.Reader, len(s.ssTables))
+	copy(tables, s.ssTables)
+	seqBound := s.seqBound
+	for _, r := range tables {
+		r.Ref()
 	}
 	s.mu.RUnlock() // Unlock BEFORE Disk IO to avoid blocking writes!
-
-	// 3. Check SSTables (Disk)
-	files, _ := os.ReadDir(s.SstDir)
-	var sstFiles []string
-	for _, f := range files {
-		if strings.HasSuffix(f.Name(), ".sst") {
-			sstFiles = append(sstFiles, f.Name())
+	defer func() {
+		for _, r := range tables {
+			_ = r.Close()
 		}
-	}
-	// Sort reverse to check newest files first (level0_105.sst before level0_100.sst)
-	sort.Sort(sort.Reverse(sort.StringSlice(sstFiles)))
+	}()
 
-	for _, file := range sstFiles {
-		// Open the reader
-		fullPath := filepath.Join(s.SstDir, file)
-		reader, err := sstable.OpenSSTable(fullPath)
-		if err != nil {
-			continue // Skip bad files
+	// 3. Check SSTables (Disk), newest first. The visible version with the highest sequence number wins;
+	// stop once no table left can hold a newer one than the best so far.
+	var best string
+	var bestSeq uint64
+	var bestExpiry int64
+	var bestTomb, found bool
+	for i, reader := range tables {
+		if found && bestSeq >= seqBound[i] {
+			break
 		}
-
-		// Search
-		val, isTomb, found, err := reader.Get(key)
-		_ = reader.Close()
-
+		val, version, expiresAt, isTomb, ok, err := reader.GetAt(key, seq)
 		if err != nil {
-			continue
+			s.quarantine(err)
+			return "", 0, false, err
 		}
-
-		if found {
-			if isTomb {
-				return "", false
-			}
-			return val, true
+		if ok && (!found || version > bestSeq) {
+			best, bestSeq, bestExpiry, bestTomb, found = val, version, expiresAt, isTomb, true
 		}
 	}
-
-	return "", false
+	if found && !bestTomb && !expired(bestExpiry, now) {
+		return best, bestSeq, true, nil
+	}
+	return "", 0, false, nil
 }
@@ -0,0 +1,78 @@
+package kv
+
+import (
+	"KV-Store/pkg/arena"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// tinyOps returns n ops of one-byte keys and values: a few bytes of data but a full entry and node each
+func tinyOps(n int) []BatchOp {
+	ops := make([]BatchOp, n)
+	for i := range ops {
+		ops[i] = BatchOp{Key: fmt.Sprintf("%c", 'a'+i%26), Value: "v"}
+	}
+	return ops
+}
+
+// Every batch PutBatch accepts must apply on a replica whose memtable is fresh, or a committed
+// batch would fail on every replica after the client was told it succeeded
+func TestBatchSizeBoundary(t *testing.T) {
+	perOp := arena.EntryHeaderSize + arena.MaxNodeSize + 2
+	fits := maxBatchBytes / perOp
+
+	ops := tinyOps(fits)
+	if batchSize(ops) > maxBatchBytes {
+		t.Fatalf("%d ops take %d bytes, over the %d limit", fits, batchSize(ops), maxBatchBytes)
+	}
+	s := newTestStore(t, DefaultOptions())
+	if err := s.applyBatch(ops, 1); err != nil {
+		t.Fatalf("applyBatch of the largest accepted batch: %v", err)
+	}
+
+	// One more op only adds two bytes of data, but its entry and node do not fit
+	over := tinyOps(fits + 1)
+	if err := s.PutBatch(over); !errors.Is(err, ErrBatchTooLarge) {
+		t.Fatalf("PutBatch of %d tiny ops = %v, want ErrBatchTooLarge", len(over), err)
+	}
+
+	// A single large value is measured the same way
+	big := []BatchOp{{Key: "k", Value: strings.Repeat("x", maxBatchBytes-perOp+1)}}
+	if batchSize(big) != maxBatchBytes {
+		t.Fatalf("batchSize = %d, want %d", batchSize(big), maxBatchBytes)
+	}
+	big[0].Value += "x"
+	if err := s.PutBatch(big); !errors.Is(err, ErrBatchTooLarge) {
+		t.Fatalf("PutBatch one byte over = %v, want ErrBatchTooLarge", err)
+	}
+
+	if err := s.PutBatch([]BatchOp{{Key: "a"}, {Key: ""}}); !errors.Is(err, ErrEmptyKey) {
+		t.Fatalf("PutBatch with an empty key = %v, want ErrEmptyKey", err)
+	}
+}
+
+// Keys longer than the 16-bit length field are rejected before they reach raft
+func TestRejectLongKeys(t *testing.T) {
+	s := newTestStore(t, DefaultOptions())
+	long := strings.Repeat("k", MaxKeyLen+1)
+	if err := s.Put(long, "v", false); !errors.Is(err, ErrKeyTooLarge) {
+		t.Errorf("Put = %v, want ErrKeyTooLarge", err)
+	}
+	if _, err := s.PutIfAbsent(long, "v"); !errors.Is(err, ErrKeyTooLarge) {
+		t.Errorf("PutIfAbsent = %v, want ErrKeyTooLarge", err)
+	}
+	if err := s.PutBatch([]BatchOp{{Key: "a"}, {Key: long}}); !errors.Is(err, ErrKeyTooLarge) {
+		t.Errorf("PutBatch = %v, want ErrKeyTooLarge", err)
+	}
+	// The longest allowed key round-trips through the memtable and a table
+	key := strings.Repeat("k", MaxKeyLen)
+	if err := s.applyInternal(key, "v", false, 1, 0); err != nil {
+		t.Fatalf("applyInternal: %v", err)
+	}
+	s.flushForTest(t)
+	if val, found, err := s.GetAt(key, 1); err != nil || !found || val != "v" {
+		t.Errorf("GetAt of a %d byte key = %q found=%v err=%v", len(key), val, found, err)
+	}
+}
@@ -0,0 +1,246 @@
+package kv
+
+import (
+	"KV-Store/pkg/metrics"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	watchHistorySize = 10000 // raft entries with changes kept for watchers resuming from an index
+	watchQueueLimit  = 10000 // raft entries a watcher may have pending before it is dropped
+)
+
+var (
+	// ErrWatchCompacted is returned for a watch resuming from an index the change history no longer holds,
+	// and ends watches when a raft snapshot replaces the local state. The watcher must re-read its keys.
+	ErrWatchCompacted = errors.New("watch history no longer reaches back to the requested index")
+	// ErrWatchLagging ends a watch whose consumer fell watchQueueLimit entries behind;
+	// it can resume from the index after the last one it received.
+	ErrWatchLagging = errors.New("watcher fell too far behind")
+	ErrWatchClosed  = errors.New("watch closed")
+)
+
+type EventType string
+
+const (
+	EventPut    EventType = "put"
+	EventDelete EventType = "delete"
+)
+
+// Event is one change to a key, published once the raft entry that made it is applied.
+// Keys expiring by TTL do not produce events.
+type Event struct {
+	Index uint64    `json:"index"` // raft index of the write
+	Type  EventType `json:"type"`
+	Key   string    `json:"key"`
+	Value string    `json:"value,omitempty"`
+}
+
+// changeEvents lists the changes cmd made when it was applied with result res
+func changeEvents(cmd raftCmd, index uint64, res OpResult) []Event {
+	if res.Err != nil {
+		return nil
+	}
+	switch cmd.Op {
+	case CmdPut, CmdCompareAndSwap, CmdPutIfAbsent:
+		return []Event{{Index: index, Type: EventPut, Key: cmd.Key, Value: cmd.Value}}
+	case CmdDelete, CmdDeleteIfEquals:
+		return []Event{{Index: index, Type: EventDelete, Key: cmd.Key}}
+	case CmdWriteBatch:
+		events := make([]Event, 0, len(cmd.Batch))
+		for _, op := range cmd.Batch {
+			if op.Delete {
+				events = append(events, Event{Index: index, Type: EventDelete, Key: op.Key})
+			} else {
+				events = append(events, Event{Index: index, Type: EventPut, Key: op.Key, Value: op.Value})
+			}
+		}
+		return events
+	}
+	return nil
+}
+
+// watchHub fans applied changes out to watchers and keeps the recent ones for watchers resuming from an index
+type watchHub struct {
+	mu       sync.Mutex
+	history  [][]Event // changes of one raft entry each, oldest first
+	start    uint64    // history holds every change at index >= start, 0 until the first entry is applied
+	applied  uint64    // last index published
+	watchers map[*Watcher]struct{}
+	nodeID   string
+}
+
+func newWatchHub(me int) *watchHub {
+	return &watchHub{watchers: make(map[*Watcher]struct{}), nodeID: strconv.Itoa(me)}
+}
+
+// publish records the changes applied at index (possibly none) and hands them to the matching watchers
+func (h *watchHub) publish(index uint64, events []Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.start == 0 {
+		h.start = index
+	}
+	h.applied = index
+	if len(events) == 0 {
+		return
+	}
+	if len(h.history) == watchHistorySize {
+		h.history = h.history[1:]
+		h.start = h.history[0][0].Index
+	}
+	h.history = append(h.history, events)
+	for w := range h.watchers {
+		w.push(events)
+	}
+}
+
+// reset forgets the history after the local state was replaced at index; every watcher is ended
+func (h *watchHub) reset(index uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.history = nil
+	h.start = index + 1
+	h.applied = index
+	for w := range h.watchers {
+		h.remove(w, ErrWatchCompacted)
+	}
+}
+
+// remove ends w with err; it must be called with h.mu held
+func (h *watchHub) remove(w *Watcher, err error) {
+	if _, ok := h.watchers[w]; !ok {
+		return
+	}
+	delete(h.watchers, w)
+	w.finish(err)
+	metrics.Watchers.WithLabelValues(h.nodeID).Dec()
+}
+
+// Watcher receives the changes to one key, or to every key with a prefix, in raft index order
+type Watcher struct {
+	hub      *watchHub
+	key      string
+	isPrefix bool
+	from     uint64 // changes before this index are not delivered
+
+	mu      sync.Mutex
+	pending [][]Event
+	err     error         // set once the watch has ended
+	notify  chan struct{} // signalled when pending or err change
+}
+
+// Watch streams the changes to key, or to every key starting with key when isPrefix is set.
+// Changes applied at fromIndex and later are delivered, replaying the recent history first;
+// fromIndex 0 starts with the next change. The watch only sees this node's applied log, so a
+// lagging follower delivers changes late but never out of order. It must be closed when done.
+func (s *Store) Watch(key string, isPrefix bool, fromIndex uint64) (*Watcher, error) {
+	h := s.watches
+	w := &Watcher{hub: h, key: key, isPrefix: isPrefix, from: fromIndex, notify: make(chan struct{}, 1)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if fromIndex > 0 {
+		if h.start == 0 || fromIndex < h.start {
+			return nil, ErrWatchCompacted
+		}
+		for _, events := range h.history {
+			w.push(events)
+		}
+	} else {
+		w.from = h.applied + 1
+	}
+	h.watchers[w] = struct{}{}
+	metrics.Watchers.WithLabelValues(h.nodeID).Inc()
+	return w, nil
+}
+
+// From is the first index the watch delivers changes for; a client that saw none yet resumes there
+func (w *Watcher) From() uint64 {
+	return w.from
+}
+
+func (w *Watcher) matches(key string) bool {
+	if w.isPrefix {
+		return strings.HasPrefix(key, w.key)
+	}
+	return key == w.key
+}
+
+// push queues the changes of one raft entry that w is interested in; it is called with the hub locked
+func (w *Watcher) push(events []Event) {
+	if events[0].Index < w.from {
+		return
+	}
+	var matched []Event
+	for _, e := range events {
+		if w.matches(e.Key) {
+			matched = append(matched, e)
+		}
+	}
+	if len(matched) == 0 {
+		return
+	}
+	w.mu.Lock()
+	full := len(w.pending) >= watchQueueLimit
+	if !full {
+		w.pending = append(w.pending, matched)
+	}
+	w.mu.Unlock()
+	if full {
+		w.hub.remove(w, ErrWatchLagging)
+		return
+	}
+	w.signal()
+}
+
+func (w *Watcher) finish(err error) {
+	w.mu.Lock()
+	if w.err == nil {
+		w.err = err
+	}
+	w.mu.Unlock()
+	w.signal()
+}
+
+func (w *Watcher) signal() {
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Next blocks until the changes of the next raft entry arrive and returns them; all share one index.
+// Once the watch has ended it returns why: ErrWatchLagging, ErrWatchCompacted or ErrWatchClosed.
+func (w *Watcher) Next(ctx context.Context) ([]Event, error) {
+	for {
+		w.mu.Lock()
+		if len(w.pending) > 0 {
+			events := w.pending[0]
+			w.pending[0] = nil
+			w.pending = w.pending[1:]
+			w.mu.Unlock()
+			return events, nil
+		}
+		err := w.err
+		w.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		select {
+		case <-w.notify:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Close ends the watch; calling it again is a no-op
+func (w *Watcher) Close() {
+	w.hub.mu.Lock()
+	defer w.hub.mu.Unlock()
+	w.hub.remove(w, ErrWatchClosed)
+}
@@ -3,69 +3,108 @@ package arena
 import (
 	"encoding/binary"
 	"errors"
+	"sync/atomic"
 )
 
 const (
 	typeVal       = 0x00
 	typeTombStone = 0x01
+	typeExpiring  = 0x02 // the value is followed by ExpiresAt(8)
 )
 
+// EntryHeaderSize: Older(4) + Header(1) + KeyLen(2) + ValLen(4) + Seq(8).
+// Older is the offset of the next older version of the same key (0 = none); it is 4-byte aligned
+// and updated atomically by the skiplist.
+const EntryHeaderSize = 4 + 1 + 2 + 4 + 8
+
+// ExpirySize is the extra space taken by an entry with an expiry time
+const ExpirySize = 8
+
+var errArenaFull = errors.New("arena is full")
+
+// Arena is a fixed-size bump allocator. Allocation is atomic so several writers can share it;
+// bytes are never moved or freed, so readers can keep offsets for the arena's lifetime.
 type Arena struct {
 	data   []byte
-	offset int //current write position
+	offset atomic.Uint32 //current write position
 }
 
 func NewArena(size int) *Arena {
 	return &Arena{
-		data:   make([]byte, 0, size),
-		offset: 0,
+		data: make([]byte, size),
 	}
 }
 
-func (a *Arena) Put(key string, val string, isDelete bool) (int, error) {
+// Size returns the number of bytes allocated so far
+func (a *Arena) Size() int {
+	return min(int(a.offset.Load()), len(a.data))
+}
 
-	// Header(1) + KeyLen(2) + ValLen(4) + Key + Val
-	entrySize := 1 + 2 + 4 + len(key) + len(val)
+// alloc reserves size bytes aligned to align (a power of two) and returns their offset
+func (a *Arena) alloc(size int, align int) (int, error) {
+	// Reserve the worst case padding up front, then align inside the reservation
+	padded := size + align - 1
+	end := int(a.offset.Add(uint32(padded)))
+	if end > len(a.data) {
+		return 0, errArenaFull
+	}
+	start := (end - padded + align - 1) &^ (align - 1)
+	return start, nil
+}
+
+// Put appends an entry written at sequence number seq and returns its offset.
+// expiresAt is a unix time in nanoseconds after which the value is gone, 0 if it never expires.
+func (a *Arena) Put(key string, val string, isDelete bool, seq uint64, expiresAt int64) (int, error) {
+
+	// Older(4) + Header(1) + KeyLen(2) + ValLen(4) + Seq(8) + Key + Val [+ ExpiresAt(8)]
+	entrySize := EntryHeaderSize + len(key) + len(val)
 	header := byte(typeVal)
 	if isDelete {
-		entrySize = 1 + 2 + 4 + len(key) //not storing value for deletes
+		entrySize = EntryHeaderSize + len(key) //not storing value for deletes
 		header = byte(typeTombStone)
+		expiresAt = 0 // a delete is permanent
 	}
-	if (a.offset + entrySize) > cap(a.data) {
-		return 0, errors.New("arena is full")
+	if expiresAt != 0 {
+		entrySize += ExpirySize
+		header |= typeExpiring
+	}
+	startOffset, err := a.alloc(entrySize, 4)
+	if err != nil {
+		return 0, err
 	}
-	startOffset := a.offset
-
-	var lenBuff [6]byte
-	binary.LittleEndian.PutUint16(lenBuff[0:2], uint16(len(key)))
-	binary.LittleEndian.PutUint32(lenBuff[2:6], uint32(len(val)))
 
-	a.data = append(a.data, header)
-	a.data = append(a.data, lenBuff[:]...)
-	a.data = append(a.data, key...)
+	buf := a.data[startOffset : startOffset+entrySize]
+	// Fresh arena memory is zeroed, so Older starts out nil
+	buf[4] = header
+	binary.LittleEndian.PutUint16(buf[5:7], uint16(len(key)))
+	binary.LittleEndian.PutUint32(buf[7:11], uint32(len(val)))
+	binary.LittleEndian.PutUint64(buf[11:19], seq)
+	copy(buf[EntryHeaderSize:], key)
 
 	if !isDelete {
-		a.data = append(a.data, val...) // append only when not delete
+		copy(buf[EntryHeaderSize+len(key):], val) // copy only when not delete
+	}
+	if expiresAt != 0 {
+		binary.LittleEndian.PutUint64(buf[entrySize-ExpirySize:], uint64(expiresAt))
 	}
-	a.offset += entrySize
 	return startOffset, nil
 }
 
 func (a *Arena) Get(offset int) ([]byte, bool, error) {
-	if offset >= len(a.data) {
+	if offset+EntryHeaderSize > a.Size() {
 		return nil, false, errors.New("offset out of range")
 	}
-	header := a.data[offset]
+	header := a.data[offset+4]
 	isTombStone := (header & typeTombStone) != 0
 	if isTombStone {
 		return nil, true, nil
 	}
-	cursor := offset + 1
+	cursor := offset + 5
 
 	keyLen := binary.LittleEndian.Uint16(a.data[cursor : cursor+2])
 	valLen := binary.LittleEndian.Uint32(a.data[cursor+2 : cursor+6])
 
-	cursor += 6           //skip lens
+	cursor += 6 + 8       //skip lens and seq
 	cursor += int(keyLen) // skip key
 
 	val := a.data[cursor : cursor+int(valLen)]
@@ -75,3 +114,25 @@ func (a *Arena) Get(offset int) ([]byte, bool, error) {
 
 	return valCopy, false, nil
 }
+
+// key returns the key of the entry at offset without copying it
+func (a *Arena) key(offset int) []byte {
+	keyLen := int(binary.LittleEndian.Uint16(a.data[offset+5 : offset+7]))
+	return a.data[offset+EntryHeaderSize : offset+EntryHeaderSize+keyLen]
+}
+
+// seq returns the sequence number of the entry at offset
+func (a *Arena) seq(offset int) uint64 {
+	return binary.LittleEndian.Uint64(a.data[offset+11 : offset+19])
+}
+
+// expiresAt returns when the entry at offset expires, 0 if it never does
+func (a *Arena) expiresAt(offset int) int64 {
+	if a.data[offset+4]&typeExpiring == 0 {
+		return 0
+	}
+	keyLen := int(binary.LittleEndian.Uint16(a.data[offset+5 : offset+7]))
+	valLen := int(binary.LittleEndian.Uint32(a.data[offset+7 : offset+11]))
+	end := offset + EntryHeaderSize + keyLen + valLen
+	return int64(binary.LittleEndian.Uint64(a.data[end : end+ExpirySize]))
+}
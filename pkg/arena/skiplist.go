@@ -0,0 +1,302 @@
+package arena
+
+import (
+	"math"
+	"math/rand/v2"
+	"sync/atomic"
+	"unsafe"
+)
+
+/*
+	Lock-free skiplist whose nodes live in the arena next to the entries they index.
+	Node layout (4-byte aligned): [Entry(4)][Next(4) x height]
+	Entry is the arena offset of the newest entry for the node's key. Every entry links to the next
+	older version of its key, so an overwrite allocates a new entry and links it into the chain,
+	which stays ordered by sequence number. Links are published with CAS, so any number of
+	writers and readers can work on the list at once. Offset 0 means nil: nothing ever links to the head.
+*/
+
+const maxHeight = 12 // p = 1/4, plenty for the few hundred thousand keys in a memtable
+
+// MaxNodeSize is the most arena space a key's skiplist node needs on top of its entry,
+// including the alignment padding of both
+const MaxNodeSize = 4*(1+maxHeight) + 3 + 3
+
+type SkipList struct {
+	arena  *Arena
+	head   int
+	length atomic.Int64
+}
+
+// NewSkipList creates an empty skiplist allocating its nodes in a
+func NewSkipList(a *Arena) (*SkipList, error) {
+	head, err := a.newNode(0, maxHeight)
+	if err != nil {
+		return nil, err
+	}
+	return &SkipList{arena: a, head: head}, nil
+}
+
+// Put appends the entry written at seq to the arena and points key's node at it, inserting the node if needed.
+// expiresAt is when the value expires in unix nanoseconds, 0 for never.
+func (s *SkipList) Put(key string, val string, isDelete bool, seq uint64, expiresAt int64) error {
+	entry, err := s.arena.Put(key, val, isDelete, seq, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	var prev, next [maxHeight]int
+	if n := s.findSplice(key, &prev, &next); n != 0 {
+		s.insertVersion(n, entry)
+		return nil
+	}
+
+	height := randomHeight()
+	node, err := s.arena.newNode(entry, height)
+	if err != nil {
+		return err
+	}
+	for level := 0; level < height; level++ {
+		for {
+			s.arena.storeNext(node, level, next[level])
+			if s.arena.casNext(prev[level], level, next[level], node) {
+				break
+			}
+			// Lost a race with another writer, recompute where we go
+			if n := s.findSplice(key, &prev, &next); n != 0 && level == 0 {
+				// Someone inserted the same key first, our node is abandoned
+				s.insertVersion(n, entry)
+				return nil
+			}
+		}
+	}
+	s.length.Add(1)
+	return nil
+}
+
+// insertVersion links entry into the version chain of node, which runs from the highest sequence number down
+func (s *SkipList) insertVersion(node int, entry int) {
+	seq := s.arena.seq(entry)
+	for {
+		head := s.arena.loadEntry(node)
+		if seq >= s.arena.seq(head) {
+			s.arena.storeOlder(entry, head)
+			if s.arena.casEntry(node, head, entry) {
+				return
+			}
+			continue
+		}
+		// A write older than the newest version goes further down the chain
+		prev := s.arena.loadOlder(head)
+		for after := head; ; after, prev = prev, s.arena.loadOlder(prev) {
+			if prev == 0 || seq >= s.arena.seq(prev) {
+				s.arena.storeOlder(entry, prev)
+				if s.arena.casOlder(after, prev, entry) {
+					return
+				}
+				break // the chain changed under us, start over
+			}
+		}
+	}
+}
+
+// Get returns a copy of the newest value for key, the sequence number that wrote it and when it expires
+func (s *SkipList) Get(key string) (val []byte, seq uint64, expiresAt int64, isTombstone bool, found bool) {
+	return s.GetAt(key, math.MaxUint64)
+}
+
+// GetAt returns the newest version of key written at or before seq
+func (s *SkipList) GetAt(key string, seq uint64) (val []byte, version uint64, expiresAt int64, isTombstone bool, found bool) {
+	n := s.seek(key)
+	if n == 0 || compareKey(s.keyOf(n), key) != 0 {
+		return nil, 0, 0, false, false
+	}
+	entry := s.arena.loadEntry(n)
+	for entry != 0 && s.arena.seq(entry) > seq {
+		entry = s.arena.loadOlder(entry)
+	}
+	if entry == 0 {
+		return nil, 0, 0, false, false
+	}
+	val, isTombstone, err := s.arena.Get(entry)
+	if err != nil {
+		return nil, 0, 0, false, false
+	}
+	return val, s.arena.seq(entry), s.arena.expiresAt(entry), isTombstone, true
+}
+
+// Len returns the number of distinct keys
+func (s *SkipList) Len() int {
+	return int(s.length.Load())
+}
+
+// seek returns the first node with a key >= key, 0 if there is none
+func (s *SkipList) seek(key string) int {
+	x := s.head
+	for level := maxHeight - 1; level >= 0; level-- {
+		for {
+			n := s.arena.loadNext(x, level)
+			if n == 0 || compareKey(s.keyOf(n), key) >= 0 {
+				break
+			}
+			x = n
+		}
+	}
+	return s.arena.loadNext(x, 0)
+}
+
+// findSplice fills prev/next with the nodes around key at every level.
+// It returns the node holding key, or 0 if key is not in the list.
+func (s *SkipList) findSplice(key string, prev, next *[maxHeight]int) int {
+	found := 0
+	x := s.head
+	for level := maxHeight - 1; level >= 0; level-- {
+		n := s.arena.loadNext(x, level)
+		for n != 0 {
+			c := compareKey(s.keyOf(n), key)
+			if c > 0 {
+				break
+			}
+			if c == 0 {
+				found = n
+				break
+			}
+			x = n
+			n = s.arena.loadNext(x, level)
+		}
+		prev[level] = x
+		next[level] = n
+	}
+	return found
+}
+
+func (s *SkipList) keyOf(node int) []byte {
+	return s.arena.key(s.arena.loadEntry(node))
+}
+
+func randomHeight() int {
+	h := 1
+	for h < maxHeight && rand.Uint32()&3 == 0 {
+		h++
+	}
+	return h
+}
+
+func compareKey(a []byte, b string) int {
+	if string(a) < b {
+		return -1
+	}
+	if string(a) > b {
+		return 1
+	}
+	return 0
+}
+
+// Iterator walks every version in the skiplist: keys in order, the versions of a key newest first.
+// It is safe to use while writers insert.
+type Iterator struct {
+	list  *SkipList
+	node  int
+	entry int // current version of node's key
+}
+
+func (s *SkipList) NewIterator() *Iterator {
+	return &Iterator{list: s}
+}
+
+// SeekToFirst moves to the newest version of the smallest key
+func (it *Iterator) SeekToFirst() {
+	it.setNode(it.list.arena.loadNext(it.list.head, 0))
+}
+
+// Seek moves to the newest version of the first key >= key
+func (it *Iterator) Seek(key string) {
+	it.setNode(it.list.seek(key))
+}
+
+func (it *Iterator) Valid() bool {
+	return it.node != 0
+}
+
+// Next moves to the next older version of the current key, or to the newest version of the next key
+func (it *Iterator) Next() {
+	if older := it.list.arena.loadOlder(it.entry); older != 0 {
+		it.entry = older
+		return
+	}
+	it.setNode(it.list.arena.loadNext(it.node, 0))
+}
+
+func (it *Iterator) setNode(node int) {
+	it.node = node
+	if node != 0 {
+		it.entry = it.list.arena.loadEntry(node)
+	}
+}
+
+func (it *Iterator) Key() string {
+	return string(it.list.arena.key(it.entry))
+}
+
+// Value returns a copy of the value of the current version and the sequence number that wrote it
+func (it *Iterator) Value() (val []byte, seq uint64, isTombstone bool) {
+	val, isTombstone, _ = it.list.arena.Get(it.entry)
+	return val, it.list.arena.seq(it.entry), isTombstone
+}
+
+// ExpiresAt returns when the current version expires in unix nanoseconds, 0 if it never does
+func (it *Iterator) ExpiresAt() int64 {
+	return it.list.arena.expiresAt(it.entry)
+}
+
+// Node and version link accessors, every field is a uint32 accessed atomically
+
+func (a *Arena) newNode(entry int, height int) (int, error) {
+	node, err := a.alloc(4*(1+height), 4)
+	if err != nil {
+		return 0, err
+	}
+	// Fresh arena memory is zeroed, so every link starts out nil
+	a.storeEntry(node, entry)
+	return node, nil
+}
+
+func (a *Arena) word(offset int) *uint32 {
+	return (*uint32)(unsafe.Pointer(&a.data[offset]))
+}
+
+func (a *Arena) loadEntry(node int) int {
+	return int(atomic.LoadUint32(a.word(node)))
+}
+
+func (a *Arena) storeEntry(node int, entry int) {
+	atomic.StoreUint32(a.word(node), uint32(entry))
+}
+
+func (a *Arena) casEntry(node int, old int, entry int) bool {
+	return atomic.CompareAndSwapUint32(a.word(node), uint32(old), uint32(entry))
+}
+
+func (a *Arena) loadOlder(entry int) int {
+	return int(atomic.LoadUint32(a.word(entry)))
+}
+
+func (a *Arena) storeOlder(entry int, older int) {
+	atomic.StoreUint32(a.word(entry), uint32(older))
+}
+
+func (a *Arena) casOlder(entry int, old int, older int) bool {
+	return atomic.CompareAndSwapUint32(a.word(entry), uint32(old), uint32(older))
+}
+
+func (a *Arena) loadNext(node int, level int) int {
+	return int(atomic.LoadUint32(a.word(node + 4 + 4*level)))
+}
+
+func (a *Arena) storeNext(node int, level int, next int) {
+	atomic.StoreUint32(a.word(node+4+4*level), uint32(next))
+}
+
+func (a *Arena) casNext(node int, level int, old int, next int) bool {
+	return atomic.CompareAndSwapUint32(a.word(node+4+4*level), uint32(old), uint32(next))
+}
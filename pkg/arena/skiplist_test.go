@@ -0,0 +1,139 @@
+package arena
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func newTestList(t *testing.T, size int) *SkipList {
+	t.Helper()
+	s, err := NewSkipList(NewArena(size))
+	if err != nil {
+		t.Fatalf("NewSkipList: %v", err)
+	}
+	return s
+}
+
+// Writers race on overlapping keys; every version must land in its key's chain, keys in order
+// and each chain newest first
+func TestSkipListConcurrentInserts(t *testing.T) {
+	const writers, keys = 8, 500
+	s := newTestList(t, 64<<20)
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < keys; i++ {
+				// Interleave the keys so writers collide on the same nodes and splices
+				k := (i*7 + w) % keys
+				seq := uint64(k*writers + w + 1)
+				if err := s.Put(fmt.Sprintf("key%05d", k), fmt.Sprintf("v%d", seq), false, seq, 0); err != nil {
+					t.Errorf("Put: %v", err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if s.Len() != keys {
+		t.Fatalf("Len = %d, want %d", s.Len(), keys)
+	}
+
+	it := s.NewIterator()
+	versions := 0
+	prevKey, prevSeq := "", uint64(0)
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		key := it.Key()
+		val, seq, isTombstone := it.Value()
+		switch {
+		case key < prevKey:
+			t.Fatalf("key %q after %q", key, prevKey)
+		case key == prevKey && seq >= prevSeq:
+			t.Fatalf("%s: version %d after %d, chain not newest first", key, seq, prevSeq)
+		}
+		if string(val) != fmt.Sprintf("v%d", seq) || isTombstone {
+			t.Fatalf("%s@%d = %q tombstone=%v", key, seq, val, isTombstone)
+		}
+		prevKey, prevSeq = key, seq
+		versions++
+	}
+	if versions != writers*keys {
+		t.Fatalf("iterated %d versions, want %d", versions, writers*keys)
+	}
+
+	for k := 0; k < keys; k++ {
+		_, seq, _, _, found := s.Get(fmt.Sprintf("key%05d", k))
+		if want := uint64(k*writers + writers); !found || seq != want {
+			t.Fatalf("Get key%05d = seq %d found=%v, want %d", k, seq, found, want)
+		}
+	}
+}
+
+// Versions may arrive out of order; GetAt must still see exactly what was written at or before seq
+func TestSkipListGetAt(t *testing.T) {
+	s := newTestList(t, 1<<16)
+	for _, seq := range []uint64{5, 2, 9, 7} {
+		if err := s.Put("k", fmt.Sprintf("v%d", seq), seq == 7, seq, 0); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+	if err := s.Put("other", "x", false, 3, 0); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	tests := []struct {
+		at          uint64
+		found       bool
+		version     uint64
+		isTombstone bool
+	}{
+		{at: 1, found: false},
+		{at: 2, found: true, version: 2},
+		{at: 4, found: true, version: 2},
+		{at: 5, found: true, version: 5},
+		{at: 7, found: true, version: 7, isTombstone: true},
+		{at: 8, found: true, version: 7, isTombstone: true},
+		{at: 100, found: true, version: 9},
+	}
+	for _, tt := range tests {
+		val, version, _, isTombstone, found := s.GetAt("k", tt.at)
+		if found != tt.found || version != tt.version || isTombstone != tt.isTombstone {
+			t.Errorf("GetAt(k, %d) = version %d tombstone=%v found=%v, want %d %v %v",
+				tt.at, version, isTombstone, found, tt.version, tt.isTombstone, tt.found)
+			continue
+		}
+		if found && !isTombstone && string(val) != fmt.Sprintf("v%d", version) {
+			t.Errorf("GetAt(k, %d) = %q", tt.at, val)
+		}
+	}
+
+	if _, _, _, _, found := s.GetAt("missing", 100); found {
+		t.Error("GetAt found a key that was never written")
+	}
+}
+
+func TestSkipListExpiry(t *testing.T) {
+	s := newTestList(t, 1<<16)
+	if err := s.Put("k", "v", false, 1, 12345); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	val, _, expiresAt, _, found := s.Get("k")
+	if !found || string(val) != "v" || expiresAt != 12345 {
+		t.Fatalf("Get = %q expiresAt=%d found=%v", val, expiresAt, found)
+	}
+}
+
+func TestSkipListFull(t *testing.T) {
+	s := newTestList(t, 256)
+	var err error
+	for i := 0; err == nil && i < 100; i++ {
+		err = s.Put(fmt.Sprintf("key%d", i), "value", false, uint64(i+1), 0)
+	}
+	if err != errArenaFull {
+		t.Fatalf("Put into a full arena = %v, want errArenaFull", err)
+	}
+}
@@ -0,0 +1,371 @@
+// Package client talks to a SisyphusDB cluster over the gRPC KVService.
+// Writes and reads go to the leader. The client asks the nodes who leads and remembers the answer;
+// a follower's NotLeader answer redirects it, and while the cluster has no reachable leader
+// (a node is down, an election is running) the call is retried with backoff until it succeeds,
+// runs out of attempts or its context ends.
+package client
+
+import (
+	pb "KV-Store/proto"
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+var ErrNoAddrs = errors.New("client needs at least one node address")
+
+// KV is one key with its value, as returned by Scan
+type KV struct {
+	Key   string
+	Value []byte
+}
+
+// Op is one write of a Batch: a put of Value, or a delete
+type Op struct {
+	Key    string
+	Value  []byte
+	Delete bool
+}
+
+// CondResult is the outcome of a conditional write and the key as it is afterwards.
+// A condition that did not hold is not an error, Succeeded is false.
+type CondResult struct {
+	Succeeded bool
+	Found     bool
+	Value     []byte
+	Version   uint64 // raft index of the key's newest version
+}
+
+type Options struct {
+	Timeout     time.Duration // deadline for calls whose context has none, 0 = wait as long as the context does
+	MaxAttempts int           // tries per call, redirects included
+	BaseBackoff time.Duration // wait before the first retry, doubling on every retry
+	MaxBackoff  time.Duration // upper bound of the wait between retries
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Timeout:     10 * time.Second,
+		MaxAttempts: 10,
+		BaseBackoff: 50 * time.Millisecond,
+		MaxBackoff:  time.Second,
+	}
+}
+
+// Client is safe for concurrent use
+type Client struct {
+	addrs []string // gRPC addresses of the nodes, e.g. localhost:5001
+	opts  Options
+
+	mu     sync.Mutex
+	conns  map[string]*grpc.ClientConn
+	leader string // last node known to lead, tried first
+	next   int    // position in addrs to try when no leader is known
+}
+
+// New creates a client for the nodes at addrs; connections are opened on first use
+func New(addrs []string, opts Options) (*Client, error) {
+	if len(addrs) == 0 {
+		return nil, ErrNoAddrs
+	}
+	opts.MaxAttempts = max(opts.MaxAttempts, 1)
+	return &Client{addrs: addrs, opts: opts, conns: make(map[string]*grpc.ClientConn)}, nil
+}
+
+// Close closes every connection the client opened
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var err error
+	for addr, conn := range c.conns {
+		err = errors.Join(err, conn.Close())
+		delete(c.conns, addr)
+	}
+	return err
+}
+
+// Get reads key through the leader, so it sees every write acknowledged before the call
+func (c *Client) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	var resp *pb.GetResponse
+	err := c.call(ctx, func(ctx context.Context, kvc pb.KVServiceClient) (err error) {
+		resp, err = kvc.Get(ctx, &pb.GetRequest{Key: []byte(key), Linearizable: true})
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return resp.Value, resp.Found, nil
+}
+
+func (c *Client) Put(ctx context.Context, key string, value []byte) error {
+	return c.PutWithTTL(ctx, key, value, 0)
+}
+
+// PutWithTTL writes a value that reads as deleted once ttl has passed; 0 never expires.
+// The TTL is sent in whole milliseconds, rounded down but at least 1.
+func (c *Client) PutWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	ms := ttl.Milliseconds()
+	if ttl > 0 && ms == 0 {
+		ms = 1
+	}
+	req := &pb.PutRequest{Key: []byte(key), Value: value, TtlMillis: ms}
+	return c.call(ctx, func(ctx context.Context, kvc pb.KVServiceClient) error {
+		_, err := kvc.Put(ctx, req)
+		return err
+	})
+}
+
+func (c *Client) Delete(ctx context.Context, key string) error {
+	return c.call(ctx, func(ctx context.Context, kvc pb.KVServiceClient) error {
+		_, err := kvc.Delete(ctx, &pb.DeleteRequest{Key: []byte(key)})
+		return err
+	})
+}
+
+// Scan lists up to limit live keys in [start, end) in key order; end "" has no upper bound.
+// more reports keys beyond the page: scan again from the last key plus "\x00".
+func (c *Client) Scan(ctx context.Context, start, end string, limit int) ([]KV, bool, error) {
+	return c.scan(ctx, &pb.ScanRequest{Start: []byte(start), End: []byte(end), Limit: int32(limit)})
+}
+
+// ScanPrefix lists up to limit live keys starting with prefix
+func (c *Client) ScanPrefix(ctx context.Context, prefix string, limit int) ([]KV, bool, error) {
+	return c.scan(ctx, &pb.ScanRequest{Prefix: []byte(prefix), Limit: int32(limit)})
+}
+
+// PrefixEnd returns the smallest key greater than every key starting with prefix, or "" when
+// there is none; Scan(ctx, after, PrefixEnd(prefix), limit) continues a prefix scan after a page
+func PrefixEnd(prefix string) string {
+	b := []byte(prefix)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1])
+		}
+	}
+	return ""
+}
+
+func (c *Client) scan(ctx context.Context, req *pb.ScanRequest) ([]KV, bool, error) {
+	var resp *pb.ScanResponse
+	err := c.call(ctx, func(ctx context.Context, kvc pb.KVServiceClient) (err error) {
+		resp, err = kvc.Scan(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	items := make([]KV, len(resp.Items))
+	for i, item := range resp.Items {
+		items[i] = KV{Key: string(item.Key), Value: item.Value}
+	}
+	return items, resp.More, nil
+}
+
+// Batch applies ops atomically: all of them or none
+func (c *Client) Batch(ctx context.Context, ops []Op) error {
+	req := &pb.BatchRequest{Ops: make([]*pb.BatchOp, len(ops))}
+	for i, op := range ops {
+		req.Ops[i] = &pb.BatchOp{Key: []byte(op.Key), Value: op.Value, Delete: op.Delete}
+	}
+	return c.call(ctx, func(ctx context.Context, kvc pb.KVServiceClient) error {
+		_, err := kvc.Batch(ctx, req)
+		return err
+	})
+}
+
+// CompareAndSwap writes value only if key currently holds expected
+func (c *Client) CompareAndSwap(ctx context.Context, key string, expected, value []byte) (CondResult, error) {
+	req := &pb.CompareAndSwapRequest{Key: []byte(key), Expected: expected, Value: value}
+	return c.conditional(ctx, func(ctx context.Context, kvc pb.KVServiceClient) (*pb.ConditionalResponse, error) {
+		return kvc.CompareAndSwap(ctx, req)
+	})
+}
+
+// CompareAndSwapVersion writes value only if the newest version of key was written at raft index version
+func (c *Client) CompareAndSwapVersion(ctx context.Context, key string, version uint64, value []byte) (CondResult, error) {
+	if version == 0 {
+		return CondResult{}, errors.New("version must be positive")
+	}
+	req := &pb.CompareAndSwapRequest{Key: []byte(key), Version: version, Value: value}
+	return c.conditional(ctx, func(ctx context.Context, kvc pb.KVServiceClient) (*pb.ConditionalResponse, error) {
+		return kvc.CompareAndSwap(ctx, req)
+	})
+}
+
+// PutIfAbsent writes value only if key does not exist
+func (c *Client) PutIfAbsent(ctx context.Context, key string, value []byte) (CondResult, error) {
+	req := &pb.PutIfAbsentRequest{Key: []byte(key), Value: value}
+	return c.conditional(ctx, func(ctx context.Context, kvc pb.KVServiceClient) (*pb.ConditionalResponse, error) {
+		return kvc.PutIfAbsent(ctx, req)
+	})
+}
+
+// DeleteIfEquals deletes key only if it currently holds expected
+func (c *Client) DeleteIfEquals(ctx context.Context, key string, expected []byte) (CondResult, error) {
+	req := &pb.DeleteIfEqualsRequest{Key: []byte(key), Expected: expected}
+	return c.conditional(ctx, func(ctx context.Context, kvc pb.KVServiceClient) (*pb.ConditionalResponse, error) {
+		return kvc.DeleteIfEquals(ctx, req)
+	})
+}
+
+func (c *Client) conditional(ctx context.Context, fn func(context.Context, pb.KVServiceClient) (*pb.ConditionalResponse, error)) (CondResult, error) {
+	var resp *pb.ConditionalResponse
+	err := c.call(ctx, func(ctx context.Context, kvc pb.KVServiceClient) (err error) {
+		resp, err = fn(ctx, kvc)
+		return err
+	})
+	if err != nil {
+		return CondResult{}, err
+	}
+	return CondResult{Succeeded: resp.Succeeded, Found: resp.Found, Value: resp.Value, Version: resp.Version}, nil
+}
+
+// Leader returns the address of the leader, asking the nodes in turn unless it is cached
+func (c *Client) Leader(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	leader := c.leader
+	c.mu.Unlock()
+	if leader != "" {
+		return leader, nil
+	}
+	err := c.call(ctx, func(ctx context.Context, kvc pb.KVServiceClient) error {
+		resp, err := kvc.Leader(ctx, &pb.LeaderRequest{})
+		if err == nil {
+			leader = resp.LeaderAddr
+		}
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	c.setLeader(leader)
+	return leader, nil
+}
+
+// call runs fn on the leader with ctx bounded by Options.Timeout. A NotLeader answer redirects to the leader it names right away;
+// an unreachable node or one that knows no leader is skipped for the next address after a backoff.
+// Other errors, e.g. InvalidArgument, are returned as they are.
+func (c *Client) call(ctx context.Context, fn func(ctx context.Context, kvc pb.KVServiceClient) error) error {
+	if _, ok := ctx.Deadline(); !ok && c.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opts.Timeout)
+		defer cancel()
+	}
+
+	var err error
+	retries := 0
+	for attempt := 0; attempt < c.opts.MaxAttempts; attempt++ {
+		addr := c.target()
+		conn, cerr := c.conn(addr)
+		if cerr != nil {
+			return cerr
+		}
+		err = fn(ctx, pb.NewKVServiceClient(conn))
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		st := status.Convert(err)
+		if leader := redirect(st); leader != "" && leader != addr {
+			c.setLeader(leader)
+			continue
+		}
+		if !retryable(st) {
+			return err
+		}
+		c.skip(addr)
+		if c.backoff(ctx, retries) != nil {
+			return err // the last failure says more than the context running out
+		}
+		retries++
+	}
+	return err
+}
+
+// retryable reports errors another node or a later try may not hit: the node is down,
+// knows no leader, or was deposed while the call ran
+func retryable(st *status.Status) bool {
+	return st.Code() == codes.Unavailable || st.Code() == codes.FailedPrecondition
+}
+
+// backoff waits before retry n, doubling from BaseBackoff up to MaxBackoff with jitter
+// so clients that failed together do not retry together
+func (c *Client) backoff(ctx context.Context, n int) error {
+	d := c.opts.BaseBackoff << min(n, 16)
+	if c.opts.MaxBackoff > 0 {
+		d = min(d, c.opts.MaxBackoff)
+	}
+	if d <= 0 {
+		return nil
+	}
+	d = d/2 + rand.N(d/2+1)
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// redirect returns the leader address a follower's NotLeader detail names, if any
+func redirect(st *status.Status) string {
+	if st.Code() != codes.FailedPrecondition {
+		return ""
+	}
+	for _, d := range st.Details() {
+		if nl, ok := d.(*pb.NotLeader); ok {
+			return nl.LeaderAddr
+		}
+	}
+	return ""
+}
+
+func (c *Client) target() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.leader != "" {
+		return c.leader
+	}
+	return c.addrs[c.next]
+}
+
+func (c *Client) setLeader(addr string) {
+	c.mu.Lock()
+	c.leader = addr
+	c.mu.Unlock()
+}
+
+// skip forgets addr as the leader and moves on to the next address
+func (c *Client) skip(addr string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.leader == addr {
+		c.leader = ""
+	}
+	if c.addrs[c.next] == addr {
+		c.next = (c.next + 1) % len(c.addrs)
+	}
+}
+
+func (c *Client) conn(addr string) (*grpc.ClientConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if conn, ok := c.conns[addr]; ok {
+		return conn, nil
+	}
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	c.conns[addr] = conn
+	return conn, nil
+}
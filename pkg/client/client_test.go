@@ -0,0 +1,253 @@
+package client
+
+import (
+	pb "KV-Store/proto"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeKV is a node whose answers the test scripts: fail returns the error for the n-th call
+// (counting from 0), nil lets the call through to an in-memory map
+type fakeKV struct {
+	pb.UnimplementedKVServiceServer
+	fail func(ctx context.Context, n int) error
+
+	mu    sync.Mutex
+	calls int
+	data  map[string][]byte
+}
+
+func (f *fakeKV) begin(ctx context.Context) error {
+	f.mu.Lock()
+	n := f.calls
+	f.calls++
+	f.mu.Unlock()
+	if f.fail == nil {
+		return nil
+	}
+	return f.fail(ctx, n)
+}
+
+func (f *fakeKV) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func (f *fakeKV) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
+	if err := f.begin(ctx); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	val, ok := f.data[string(req.Key)]
+	return &pb.GetResponse{Found: ok, Value: val}, nil
+}
+
+func (f *fakeKV) Put(ctx context.Context, req *pb.PutRequest) (*pb.PutResponse, error) {
+	if err := f.begin(ctx); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.data == nil {
+		f.data = make(map[string][]byte)
+	}
+	f.data[string(req.Key)] = req.Value
+	return &pb.PutResponse{}, nil
+}
+
+func (f *fakeKV) CompareAndSwap(ctx context.Context, req *pb.CompareAndSwapRequest) (*pb.ConditionalResponse, error) {
+	if err := f.begin(ctx); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cur, ok := f.data[string(req.Key)]
+	if !ok || !bytes.Equal(cur, req.Expected) {
+		return &pb.ConditionalResponse{Found: ok, Value: cur}, nil
+	}
+	f.data[string(req.Key)] = req.Value
+	return &pb.ConditionalResponse{Succeeded: true, Found: true, Value: req.Value}, nil
+}
+
+// serve runs f on a local port until the test ends and returns its address
+func serve(t *testing.T, f *fakeKV) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	pb.RegisterKVServiceServer(server, f)
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+	return lis.Addr().String()
+}
+
+func newTestClient(t *testing.T, addrs []string, opts Options) *Client {
+	t.Helper()
+	c, err := New(addrs, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func testOptions() Options {
+	return Options{Timeout: 5 * time.Second, MaxAttempts: 5, BaseBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+}
+
+func notLeader(leaderAddr string) error {
+	st, err := status.New(codes.FailedPrecondition, "not leader").WithDetails(&pb.NotLeader{LeaderId: 1, LeaderAddr: leaderAddr})
+	if err != nil {
+		panic(err)
+	}
+	return st.Err()
+}
+
+func TestRedirectToLeader(t *testing.T) {
+	leader := &fakeKV{}
+	leaderAddr := serve(t, leader)
+	follower := &fakeKV{fail: func(context.Context, int) error { return notLeader(leaderAddr) }}
+	c := newTestClient(t, []string{serve(t, follower)}, testOptions())
+
+	ctx := context.Background()
+	value := []byte{0, 1, '&', 0xff}
+	if err := c.Put(ctx, "k", value); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	got, found, err := c.Get(ctx, "k")
+	if err != nil || !found || !bytes.Equal(got, value) {
+		t.Fatalf("Get = %v found=%v err=%v, want %v", got, found, err, value)
+	}
+	// The leader is remembered, the follower was asked only once
+	if n := follower.callCount(); n != 1 {
+		t.Errorf("follower got %d calls, want 1", n)
+	}
+	if addr, err := c.Leader(ctx); err != nil || addr != leaderAddr {
+		t.Errorf("Leader = %q, %v, want %q", addr, err, leaderAddr)
+	}
+}
+
+// A condition that did not hold comes back as a result, not an error, and is not retried
+func TestCompareAndSwap(t *testing.T) {
+	leader := &fakeKV{}
+	leaderAddr := serve(t, leader)
+	follower := &fakeKV{fail: func(context.Context, int) error { return notLeader(leaderAddr) }}
+	c := newTestClient(t, []string{serve(t, follower)}, testOptions())
+	ctx := context.Background()
+
+	if err := c.Put(ctx, "k", []byte("a")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	res, err := c.CompareAndSwap(ctx, "k", []byte("b"), []byte("c"))
+	if err != nil || res.Succeeded || !res.Found || string(res.Value) != "a" {
+		t.Fatalf("CompareAndSwap from a wrong value = %+v, %v, want a failed condition showing \"a\"", res, err)
+	}
+	calls := leader.callCount()
+	res, err = c.CompareAndSwap(ctx, "k", []byte("a"), []byte("c"))
+	if err != nil || !res.Succeeded || string(res.Value) != "c" {
+		t.Fatalf("CompareAndSwap = %+v, %v, want it applied", res, err)
+	}
+	if n := leader.callCount() - calls; n != 1 {
+		t.Errorf("leader got %d calls for one CompareAndSwap, want 1", n)
+	}
+	if _, err := c.CompareAndSwapVersion(ctx, "k", 0, []byte("d")); err == nil {
+		t.Error("CompareAndSwapVersion accepted version 0")
+	}
+}
+
+// Nodes that are down or know no leader are skipped in turn until MaxAttempts runs out
+func TestRetryUntilMaxAttempts(t *testing.T) {
+	for _, code := range []codes.Code{codes.Unavailable, codes.FailedPrecondition} {
+		fail := func(context.Context, int) error { return status.Error(code, "no leader") }
+		a, b := &fakeKV{fail: fail}, &fakeKV{fail: fail}
+		opts := testOptions()
+		opts.MaxAttempts = 4
+		c := newTestClient(t, []string{serve(t, a), serve(t, b)}, opts)
+
+		err := c.Put(context.Background(), "k", []byte("v"))
+		if status.Code(err) != code {
+			t.Errorf("Put = %v, want %v", err, code)
+		}
+		if a.callCount() != 2 || b.callCount() != 2 {
+			t.Errorf("%v: nodes got %d and %d calls, want 2 each", code, a.callCount(), b.callCount())
+		}
+	}
+
+	// A node that recovers within the attempts serves the call
+	flaky := &fakeKV{fail: func(_ context.Context, n int) error {
+		if n < 2 {
+			return status.Error(codes.Unavailable, "electing")
+		}
+		return nil
+	}}
+	c := newTestClient(t, []string{serve(t, flaky)}, testOptions())
+	if err := c.Put(context.Background(), "k", []byte("v")); err != nil || flaky.callCount() != 3 {
+		t.Errorf("Put = %v after %d calls, want success after 3", err, flaky.callCount())
+	}
+}
+
+func TestInvalidArgumentReturnedUnchanged(t *testing.T) {
+	want := status.Error(codes.InvalidArgument, "key must not be empty")
+	node := &fakeKV{fail: func(context.Context, int) error { return want }}
+	c := newTestClient(t, []string{serve(t, node)}, testOptions())
+
+	err := c.Put(context.Background(), "", []byte("v"))
+	if st := status.Convert(err); st.Code() != codes.InvalidArgument || st.Message() != "key must not be empty" {
+		t.Errorf("Put = %v, want %v", err, want)
+	}
+	if n := node.callCount(); n != 1 {
+		t.Errorf("node got %d calls, want 1", n)
+	}
+}
+
+// Options.Timeout must reach the RPC itself, not only the waits between retries
+func TestTimeoutBoundsCall(t *testing.T) {
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	node := &fakeKV{fail: func(ctx context.Context, _ int) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-release:
+			return errors.New("released")
+		}
+	}}
+	opts := testOptions()
+	opts.Timeout = 100 * time.Millisecond
+	c := newTestClient(t, []string{serve(t, node)}, opts)
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := c.Get(context.Background(), "k")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if status.Code(err) != codes.DeadlineExceeded {
+			t.Errorf("Get = %v, want DeadlineExceeded", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Get still blocked long after Options.Timeout")
+	}
+
+	// A deadline of the caller's own wins over Options.Timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := c.Put(ctx, "k", []byte("v")); status.Code(err) != codes.DeadlineExceeded || time.Since(start) < 250*time.Millisecond {
+		t.Errorf("Put = %v after %v, want DeadlineExceeded after the caller's 300ms", err, time.Since(start))
+	}
+}
@@ -27,6 +27,11 @@ var (
 		Help: "Current leader ID",
 	}, []string{"node_id"})
 
+	LeaseValidGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "raft_lease_valid",
+		Help: "Whether the leader lease is currently valid (1) or not (0)",
+	}, []string{"node_id"})
+
 	// KV Store Metrics
 	LevelFileCount = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "kv_level_file_count",
@@ -38,6 +43,61 @@ var (
 		Help: "Total size of all SSTables at a level",
 	}, []string{"node_id", "level"})
 
+	LinearizableReads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kv_linearizable_reads_total",
+		Help: "Linearizable reads by path (lease = served under leader lease, read_index = quorum check)",
+	}, []string{"node_id", "path"})
+
+	BlockCacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kv_block_cache_hits_total",
+		Help: "SSTable data block reads served from the block cache",
+	}, []string{"node_id"})
+
+	BlockCacheMisses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kv_block_cache_misses_total",
+		Help: "SSTable data block reads that went to disk",
+	}, []string{"node_id"})
+
+	BlockCacheBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kv_block_cache_bytes",
+		Help: "Bytes of block data held in the block cache",
+	}, []string{"node_id"})
+
+	SSTableRawBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kv_sstable_raw_bytes_total",
+		Help: "Data block bytes written to SSTables before compression",
+	}, []string{"node_id", "level"})
+
+	SSTableStoredBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kv_sstable_stored_bytes_total",
+		Help: "Data block bytes written to SSTables after compression",
+	}, []string{"node_id", "level"})
+
+	CompressionRatio = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kv_sstable_compression_ratio",
+		Help: "Raw to stored data block size of the last SSTable written at each level",
+	}, []string{"node_id", "level"})
+
+	Compactions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kv_compactions_total",
+		Help: "Compactions run, by the level they compacted out of",
+	}, []string{"node_id", "level"})
+
+	QuarantinedTables = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kv_sstable_quarantined_total",
+		Help: "SSTables taken out of service after failing checksum validation",
+	}, []string{"node_id"})
+
+	OpenSnapshots = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kv_open_snapshots",
+		Help: "MVCC snapshots currently open, each pinning the versions it reads against compaction",
+	}, []string{"node_id"})
+
+	Watchers = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kv_watchers",
+		Help: "Watches currently streaming changes from this node",
+	}, []string{"node_id"})
+
 	// HTTP Metrics
 	HttpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "http_requests_total",
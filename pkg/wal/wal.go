@@ -26,12 +26,13 @@ const (
 	CmdDelete Command = 2
 )
 
-const headerSize = 29
+const headerSize = 37
 
-// Entry CRC(4) + LSN(8) + TimeStamp(8) + Cmd(1) + Key(4) + Val(4)
+// Entry CRC(4) + LSN(8) + Seq(8) + TimeStamp(8) + Cmd(1) + Key(4) + Val(4)
 type Entry struct {
 	CRC       uint32
 	LSN       uint64
+	Seq       uint64 // sequence number of the write, orders it against every other write to the key
 	TimeStamp uint64
 	Cmd       Command
 	Key       []byte
@@ -95,7 +96,7 @@ func (w *WAL) Remove() error {
 	return os.Remove(w.path)
 }
 
-func (w *WAL) Write(key string, val string, cmd Command) error {
+func (w *WAL) Write(key string, val string, cmd Command, seq uint64) error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
@@ -108,13 +109,14 @@ func (w *WAL) Write(key string, val string, cmd Command) error {
 	timestamp := uint64(time.Now().UnixNano())
 
 	binary.LittleEndian.PutUint64(buf[4:12], w.currentLSN)
-	binary.LittleEndian.PutUint64(buf[12:20], timestamp)
-	buf[20] = byte(cmd)
-	binary.LittleEndian.PutUint32(buf[21:25], uint32(keySize))
-	binary.LittleEndian.PutUint32(buf[25:29], uint32(valSize))
+	binary.LittleEndian.PutUint64(buf[12:20], seq)
+	binary.LittleEndian.PutUint64(buf[20:28], timestamp)
+	buf[28] = byte(cmd)
+	binary.LittleEndian.PutUint32(buf[29:33], uint32(keySize))
+	binary.LittleEndian.PutUint32(buf[33:37], uint32(valSize))
 
-	copy(buf[29:], []byte(key))
-	copy(buf[29+keySize:], []byte(val))
+	copy(buf[headerSize:], []byte(key))
+	copy(buf[headerSize+keySize:], []byte(val))
 
 	crc := crc32.ChecksumIEEE(buf[4:])
 	binary.LittleEndian.PutUint32(buf[0:4], crc)
@@ -152,10 +154,11 @@ func (w *WAL) Recover() ([]Entry, error) {
 
 		crc := binary.LittleEndian.Uint32(header[0:4])
 		lsn := binary.LittleEndian.Uint64(header[4:12])
-		timestamp := binary.LittleEndian.Uint64(header[12:20])
-		cmd := Command(header[20])
-		keySize := int(binary.LittleEndian.Uint32(header[21:25]))
-		valSize := int(binary.LittleEndian.Uint32(header[25:29]))
+		seq := binary.LittleEndian.Uint64(header[12:20])
+		timestamp := binary.LittleEndian.Uint64(header[20:28])
+		cmd := Command(header[28])
+		keySize := int(binary.LittleEndian.Uint32(header[29:33]))
+		valSize := int(binary.LittleEndian.Uint32(header[33:37]))
 
 		data := make([]byte, valSize+keySize)
 
@@ -180,6 +183,7 @@ func (w *WAL) Recover() ([]Entry, error) {
 		entries = append(entries, Entry{
 			CRC:       crc,
 			LSN:       lsn,
+			Seq:       seq,
 			TimeStamp: timestamp,
 			Cmd:       cmd,
 			Key:       data[:keySize],
@@ -44,25 +44,34 @@ func (rf *Raft) AppendEntries(args *AppendEntriesArgs, reply *AppendEntriesReply
 	reply.Term = rf.currentTerm
 
 	// Log Consistency Check
-	lastLogIndex := len(rf.log) - 1
+	lastLogIndex := rf.lastLogIndex()
+
+	// Everything up to our snapshot is already committed, ask for what follows it
+	if args.PrevLogIndex < rf.lastIncludedIndex {
+		reply.Success = false
+		reply.ConflictTerm = -1
+		reply.ConflictIndex = rf.lastIncludedIndex + 1
+		return
+	}
 
 	// Case A: Follower log is shorter than Leader's PrevLogIndex
 	if args.PrevLogIndex > lastLogIndex {
 		reply.Success = false
 		reply.ConflictTerm = -1
-		reply.ConflictIndex = len(rf.log)
+		reply.ConflictIndex = lastLogIndex + 1
 		return
 	}
 
 	// Case B: Term mismatch at PrevLogIndex
-	if rf.log[args.PrevLogIndex].Term != args.PrevLogTerm {
+	if rf.entryAt(args.PrevLogIndex).Term != args.PrevLogTerm {
 		reply.Success = false
-		reply.ConflictTerm = rf.log[args.PrevLogIndex].Term
+		reply.ConflictTerm = rf.entryAt(args.PrevLogIndex).Term
 
 		// Find the VERY FIRST index of this conflicting term (scan backwards)
 		// This allows jumping over an entire term of bad data
-		for i := args.PrevLogIndex; i >= 0; i-- {
-			if rf.log[i].Term == reply.ConflictTerm {
+		reply.ConflictIndex = args.PrevLogIndex
+		for i := args.PrevLogIndex; i > rf.lastIncludedIndex; i-- {
+			if rf.entryAt(i).Term == reply.ConflictTerm {
 				reply.ConflictIndex = i
 			} else {
 				break
@@ -73,20 +82,31 @@ func (rf *Raft) AppendEntries(args *AppendEntriesArgs, reply *AppendEntriesReply
 
 	//  Append Entries (Safe Merge)
 	insertIndex := args.PrevLogIndex + 1
+	configChanged := false
 	for i, entry := range args.Entries {
 		index := insertIndex + i
-		if index < len(rf.log) {
+		if index <= rf.lastLogIndex() {
 			// If we find a conflict, truncate the rest and start fresh
-			if rf.log[index].Term != entry.Term {
-				rf.log = rf.log[:index]
+			if rf.entryAt(index).Term != entry.Term {
+				rf.log = rf.log[:index-rf.lastIncludedIndex]
 				rf.log = append(rf.log, entry)
+				// truncated entries may have held a membership change
+				configChanged = true
 			}
 		} else {
 			// No conflict, just append
 			rf.log = append(rf.log, entry)
+			if entry.Type == EntryConfig {
+				configChanged = true
+			}
 		}
 	}
 
+	// A server always uses the latest configuration in its log, committed or not
+	if configChanged {
+		rf.setConfig(rf.configFromLog())
+	}
+
 	// Persist if we changed anything
 	if len(args.Entries) > 0 {
 		rf.persist()
@@ -101,11 +121,7 @@ func (rf *Raft) AppendEntries(args *AppendEntriesArgs, reply *AppendEntriesReply
 		} else {
 			rf.commitIndex = lastNewIndex
 		}
-		// Signal applier
-		select {
-		case rf.commitCh <- struct{}{}:
-		default:
-		}
+		rf.signalApplier()
 	}
 
 	reply.Success = true
@@ -118,9 +134,13 @@ func (rf *Raft) sendHeartBeats() {
 		return
 	}
 	term := rf.currentTerm
+	peerIds := rf.replicaIds()
 	rf.mu.Unlock()
 
-	for i := range rf.peers {
+	// Followers that answer this round in our term vouch for our leadership as of roundStart
+	roundStart := time.Now()
+
+	for _, i := range peerIds {
 		if i == rf.me {
 			continue
 		}
@@ -132,13 +152,20 @@ func (rf *Raft) sendHeartBeats() {
 				return
 			}
 
+			// The entries this peer needs were compacted away, ship the snapshot instead
+			if rf.nextIndex[server] <= rf.lastIncludedIndex {
+				rf.mu.Unlock()
+				rf.sendSnapshot(server, term)
+				return
+			}
+
 			prevLogIndex := rf.nextIndex[server] - 1
 			if prevLogIndex < 0 {
 				prevLogIndex = 0
 			}
 
 			entries := make([]LogEntry, 0)
-			lastIdx := len(rf.log)
+			lastIdx := rf.lastLogIndex() + 1
 			nextIdx := rf.nextIndex[server]
 
 			// Prevent OOM by sending max 100 entries at a time
@@ -147,7 +174,7 @@ func (rf *Raft) sendHeartBeats() {
 				if endIdx > lastIdx {
 					endIdx = lastIdx
 				}
-				entries = append(entries, rf.log[nextIdx:endIdx]...)
+				entries = append(entries, rf.log[nextIdx-rf.lastIncludedIndex:endIdx-rf.lastIncludedIndex]...)
 			}
 			if len(entries) > 1 {
 				fmt.Printf("Batched RPC sent with %d entries to Node %d!\n", len(entries), i)
@@ -161,8 +188,8 @@ func (rf *Raft) sendHeartBeats() {
 				Entries:      entries,
 				LeaderCommit: rf.commitIndex,
 			}
-			if prevLogIndex < len(rf.log) {
-				args.PrevLogTerm = rf.log[prevLogIndex].Term
+			if prevLogIndex <= rf.lastLogIndex() {
+				args.PrevLogTerm = rf.entryAt(prevLogIndex).Term
 			}
 
 			rf.mu.Unlock()
@@ -179,6 +206,9 @@ func (rf *Raft) sendHeartBeats() {
 					rf.leaderId = -1
 					return
 				}
+				if reply.Term == term && rf.currentTerm == term && roundStart.After(rf.lastAck[server]) {
+					rf.lastAck[server] = roundStart
+				}
 
 				if reply.Success {
 					// Success: Advance indices
@@ -189,20 +219,20 @@ func (rf *Raft) sendHeartBeats() {
 					}
 
 					// Check if we can commit
-					for N := len(rf.log) - 1; N > rf.commitIndex; N-- {
-						count := 1
-						for peer := range rf.peers {
+					for N := rf.lastLogIndex(); N > rf.commitIndex; N-- {
+						count := 0
+						if rf.isMember(rf.me) {
+							count = 1
+						}
+						for peer := range rf.members {
 							if peer != rf.me && rf.matchIndex[peer] >= N {
 								count++
 							}
 						}
-						if count > len(rf.peers)/2 && rf.log[N].Term == rf.currentTerm {
+						if count >= rf.quorum() && rf.entryAt(N).Term == rf.currentTerm {
 							rf.commitIndex = N
-							// Signal applier
-							select {
-							case rf.commitCh <- struct{}{}:
-							default:
-							}
+							rf.signalApplier()
+							rf.stepDownIfRemoved()
 							break
 						}
 					}
@@ -215,8 +245,8 @@ func (rf *Raft) sendHeartBeats() {
 					} else {
 						// Search for ConflictTerm in our log
 						lastIndexOfTerm := -1
-						for i := len(rf.log) - 1; i >= 0; i-- {
-							if rf.log[i].Term == reply.ConflictTerm {
+						for i := rf.lastLogIndex(); i > rf.lastIncludedIndex; i-- {
+							if rf.entryAt(i).Term == reply.ConflictTerm {
 								lastIndexOfTerm = i
 								break
 							}
@@ -248,6 +278,7 @@ func (rf *Raft) sendAppendEntries(server int, args *AppendEntriesArgs, reply *Ap
 			Index:   int32(v.Index),
 			Term:    int32(v.Term),
 			Command: v.Command,
+			Type:    int32(v.Type),
 		}
 	}
 
@@ -261,10 +292,14 @@ func (rf *Raft) sendAppendEntries(server int, args *AppendEntriesArgs, reply *Ap
 	}
 
 	// 2. Call gRPC
+	client := rf.peerClient(server)
+	if client == nil {
+		return false
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*500)
 	defer cancel()
 
-	pbReply, err := rf.peers[server].AppendEntries(ctx, pbArgs)
+	pbReply, err := client.AppendEntries(ctx, pbArgs)
 	if err != nil {
 		return false
 	}
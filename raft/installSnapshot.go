@@ -0,0 +1,178 @@
+package raft
+
+import (
+	pb "KV-Store/proto"
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// MaxSnapshotSize bounds the InstallSnapshot message; gRPC's default 4MB is far below a real store
+const MaxSnapshotSize = 512 * 1024 * 1024
+
+type InstallSnapshotArgs struct {
+	Term              int
+	LeaderId          int
+	LastIncludedIndex int // snapshot replaces all entries up through this index
+	LastIncludedTerm  int
+	Data              []byte
+	Config            Config // configuration as of LastIncludedIndex
+}
+
+type InstallSnapshotReply struct {
+	Term int
+}
+
+// Snapshot is called by the service once it has serialized its state up to index.
+// Raft discards the log through that index and compacts the WAL.
+func (rf *Raft) Snapshot(index int, snapshot []byte) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if index <= rf.lastIncludedIndex || index > rf.lastApplied {
+		return
+	}
+
+	term := rf.entryAt(index).Term
+	rf.snapshotConfig = rf.configAt(index)
+	newLog := make([]LogEntry, 0, rf.lastLogIndex()-index+1)
+	newLog = append(newLog, LogEntry{Index: index, Term: term})
+	newLog = append(newLog, rf.log[index-rf.lastIncludedIndex+1:]...)
+
+	rf.log = newLog
+	rf.lastIncludedIndex = index
+	rf.lastIncludedTerm = term
+	rf.snapshot = snapshot
+
+	if err := rf.persistSnapshot(); err != nil {
+		fmt.Printf("Node %d failed to persist snapshot at %d: %v\n", rf.me, index, err)
+		return
+	}
+	fmt.Printf("Node %d took snapshot at index %d, %d entries left in log\n", rf.me, index, len(rf.log)-1)
+}
+
+func (rf *Raft) InstallSnapshot(args *InstallSnapshotArgs, reply *InstallSnapshotReply) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	reply.Term = rf.currentTerm
+	if args.Term < rf.currentTerm {
+		return
+	}
+
+	if args.Term > rf.currentTerm {
+		rf.currentTerm = args.Term
+		rf.votedFor = -1
+	}
+	rf.state = Follower
+	rf.leaderId = args.LeaderId
+	rf.lastResetTime = time.Now()
+	rf.persistState()
+	reply.Term = rf.currentTerm
+
+	// Already have everything the snapshot covers
+	if args.LastIncludedIndex <= rf.commitIndex {
+		return
+	}
+
+	// Keep the suffix if our log agrees with the snapshot's last entry, otherwise drop it all
+	newLog := []LogEntry{{Index: args.LastIncludedIndex, Term: args.LastIncludedTerm}}
+	if args.LastIncludedIndex < rf.lastLogIndex() && rf.entryAt(args.LastIncludedIndex).Term == args.LastIncludedTerm {
+		newLog = append(newLog, rf.log[args.LastIncludedIndex-rf.lastIncludedIndex+1:]...)
+	}
+
+	rf.log = newLog
+	rf.lastIncludedIndex = args.LastIncludedIndex
+	rf.lastIncludedTerm = args.LastIncludedTerm
+	rf.snapshot = args.Data
+	rf.snapshotConfig = args.Config.copy()
+	rf.commitIndex = args.LastIncludedIndex
+	rf.setConfig(rf.configFromLog())
+
+	if err := rf.persistSnapshot(); err != nil {
+		fmt.Printf("Node %d failed to persist installed snapshot: %v\n", rf.me, err)
+	}
+
+	// Let the applier hand the snapshot to the service
+	rf.pendingSnapshot = true
+	rf.signalApplier()
+}
+
+// sendSnapshot ships the current snapshot to a peer that fell behind the compacted log
+func (rf *Raft) sendSnapshot(server int, term int) {
+	rf.mu.Lock()
+	// One snapshot per peer at a time, heartbeats keep firing while it is in flight
+	if rf.state != Leader || rf.currentTerm != term || rf.snapshotInFlight[server] {
+		rf.mu.Unlock()
+		return
+	}
+	rf.snapshotInFlight[server] = true
+	args := InstallSnapshotArgs{
+		Term:              term,
+		LeaderId:          rf.me,
+		LastIncludedIndex: rf.lastIncludedIndex,
+		LastIncludedTerm:  rf.lastIncludedTerm,
+		Data:              rf.snapshot,
+		Config:            rf.snapshotConfig,
+	}
+	rf.mu.Unlock()
+
+	fmt.Printf("Sending snapshot up to index %d to Node %d\n", args.LastIncludedIndex, server)
+
+	var reply InstallSnapshotReply
+	ok := rf.sendInstallSnapshot(server, &args, &reply)
+
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	delete(rf.snapshotInFlight, server)
+	if !ok {
+		return
+	}
+
+	if reply.Term > rf.currentTerm {
+		rf.currentTerm = reply.Term
+		rf.state = Follower
+		rf.votedFor = -1
+		rf.leaderId = -1
+		rf.persistState()
+		return
+	}
+	if rf.state != Leader || rf.currentTerm != term {
+		return
+	}
+
+	if args.LastIncludedIndex > rf.matchIndex[server] {
+		rf.matchIndex[server] = args.LastIncludedIndex
+	}
+	if args.LastIncludedIndex+1 > rf.nextIndex[server] {
+		rf.nextIndex[server] = args.LastIncludedIndex + 1
+	}
+}
+
+func (rf *Raft) sendInstallSnapshot(server int, args *InstallSnapshotArgs, reply *InstallSnapshotReply) bool {
+	client := rf.peerClient(server)
+	if client == nil {
+		return false
+	}
+	pbArgs := &pb.InstallSnapshotRequest{
+		Term:              int32(args.Term),
+		LeaderId:          int32(args.LeaderId),
+		LastIncludedIndex: int32(args.LastIncludedIndex),
+		LastIncludedTerm:  int32(args.LastIncludedTerm),
+		Data:              args.Data,
+		Members:           MembersToProto(args.Config),
+	}
+
+	// Snapshots are large, give them more time than a heartbeat
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pbReply, err := client.InstallSnapshot(ctx, pbArgs, grpc.MaxCallSendMsgSize(MaxSnapshotSize))
+	if err != nil {
+		return false
+	}
+	reply.Term = int(pbReply.Term)
+	return true
+}
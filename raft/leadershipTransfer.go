@@ -0,0 +1,146 @@
+package raft
+
+import (
+	pb "KV-Store/proto"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+/*
+	Leadership transfer (Raft dissertation, section 3.10).
+	The leader stops accepting new entries, brings the target's log up to date through the
+	normal nextIndex/matchIndex replication and then sends it TimeoutNow. The target starts
+	an election right away, skipping Pre-Vote, and wins it with its newer term.
+*/
+
+var (
+	ErrTransferPending = errors.New("another leadership transfer is in progress")
+	ErrTransferTimeout = errors.New("timeout waiting for leadership transfer")
+)
+
+// transferTimeout bounds how long the leader refuses writes while handing off
+const transferTimeout = 2 * electionTimeoutMin
+
+// timeoutNowTimeout bounds a TimeoutNow RPC; the target may still act on it until then
+const timeoutNowTimeout = 100 * time.Millisecond
+
+type TimeoutNowArgs struct {
+	Term     int
+	LeaderId int
+}
+
+type TimeoutNowReply struct {
+	Term int
+}
+
+// TransferLeadership hands leadership to target and waits until it has taken over
+func (rf *Raft) TransferLeadership(target int) error {
+	rf.mu.Lock()
+	if rf.state != Leader {
+		rf.mu.Unlock()
+		return ErrNotLeader
+	}
+	if target == rf.me {
+		rf.mu.Unlock()
+		return nil
+	}
+	if !rf.isMember(target) {
+		rf.mu.Unlock()
+		return ErrUnknownMember
+	}
+	if rf.transferTarget != -1 {
+		rf.mu.Unlock()
+		return ErrTransferPending
+	}
+	rf.transferTarget = target
+	term := rf.currentTerm
+	rf.mu.Unlock()
+
+	fmt.Printf("Node %d transferring leadership to Node %d\n", rf.me, target)
+	defer func() {
+		rf.mu.Lock()
+		if rf.currentTerm == term {
+			rf.transferTarget = -1
+		}
+		rf.mu.Unlock()
+	}()
+
+	sent := false
+	deadline := time.Now().Add(transferTimeout)
+	for time.Now().Before(deadline) {
+		rf.mu.Lock()
+		if rf.currentTerm != term {
+			leader := rf.leaderId
+			rf.mu.Unlock()
+			if leader == target {
+				return nil
+			}
+			// Wait for the new leader to make itself known
+			if leader == -1 {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return fmt.Errorf("leadership moved to Node %d instead of Node %d", leader, target)
+		}
+		if rf.state != Leader {
+			rf.mu.Unlock()
+			return ErrNotLeader
+		}
+		caughtUp := rf.matchIndex[target] == rf.lastLogIndex()
+		rf.mu.Unlock()
+
+		if !caughtUp {
+			select {
+			case rf.triggerCh <- struct{}{}:
+			default:
+			}
+		} else if !sent {
+			// The target may be elected as soon as TimeoutNow arrives, before our lease runs out.
+			// Acks from before then must not back a lease, nor those of a round that might still
+			// reach a follower before its vote; one lease past the RPC deadline covers both.
+			rf.mu.Lock()
+			rf.leaseBlockedUntil = time.Now().Add(timeoutNowTimeout + leaseDuration)
+			rf.mu.Unlock()
+			var reply TimeoutNowReply
+			sent = rf.sendTimeoutNow(target, &TimeoutNowArgs{Term: term, LeaderId: rf.me}, &reply)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return ErrTransferTimeout
+}
+
+// TimeoutNow makes this node start an election immediately, as if its election timer fired
+func (rf *Raft) TimeoutNow(args *TimeoutNowArgs, reply *TimeoutNowReply) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	reply.Term = rf.currentTerm
+	if args.Term < rf.currentTerm || !rf.isMember(rf.me) {
+		return
+	}
+	fmt.Printf("Node %d received TimeoutNow from Node %d, starting election\n", rf.me, args.LeaderId)
+	go rf.campaign(rf.currentTerm, true)
+}
+
+func (rf *Raft) sendTimeoutNow(server int, args *TimeoutNowArgs, reply *TimeoutNowReply) bool {
+	client := rf.peerClient(server)
+	if client == nil {
+		return false
+	}
+	pbArgs := &pb.TimeoutNowRequest{
+		Term:     int32(args.Term),
+		LeaderId: int32(args.LeaderId),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeoutNowTimeout)
+	defer cancel()
+
+	pbReply, err := client.TimeoutNow(ctx, pbArgs)
+	if err != nil {
+		return false
+	}
+	reply.Term = int(pbReply.Term)
+	return true
+}
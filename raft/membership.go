@@ -0,0 +1,402 @@
+package raft
+
+import (
+	pb "KV-Store/proto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+/*
+	Single-server membership changes (Raft dissertation, section 4.1).
+	Each change adds or removes exactly one voter and is replicated as an EntryConfig log entry
+	holding the full new configuration. Servers switch to a configuration as soon as it is in
+	their log, and a leader only allows one uncommitted change at a time.
+
+	Learners (section 4.2.1) receive the log like any other peer but never vote and are not
+	counted towards quorum. A learner that has caught up can be promoted to a voter.
+*/
+
+var (
+	ErrNotLeader      = errors.New("not leader")
+	ErrConfigPending  = errors.New("another membership change is in progress")
+	ErrLeaderNotReady = errors.New("leader has not committed an entry in its term yet")
+	ErrUnknownMember  = errors.New("node is not a member of the cluster")
+	ErrMemberExists   = errors.New("node is already a member of the cluster")
+	ErrConfigTimeout  = errors.New("timeout waiting for membership change to commit")
+	ErrTooFewVoters   = fmt.Errorf("cannot shrink the cluster below %d voters", minVoters)
+	ErrNotLearner     = errors.New("node is not a learner")
+	ErrLearnerBehind  = errors.New("learner has not caught up with the leader")
+)
+
+const configTimeout = 5 * time.Second
+
+// minVoters is the smallest cluster a removal may leave. Commits only advance on peer replies and
+// elections are only won on vote replies, so a single voter could never commit or elect itself.
+const minVoters = 2
+
+// Config is a cluster configuration: node id -> gRPC address for voters and learners
+type Config struct {
+	Voters   map[int]string `json:"voters"`
+	Learners map[int]string `json:"learners,omitempty"`
+}
+
+func (c Config) copy() Config {
+	return Config{Voters: copyMembers(c.Voters), Learners: copyMembers(c.Learners)}
+}
+
+func (c Config) equal(other Config) bool {
+	return sameMembers(c.Voters, other.Voters) && sameMembers(c.Learners, other.Learners)
+}
+
+func (c Config) has(id int) bool {
+	_, voter := c.Voters[id]
+	_, learner := c.Learners[id]
+	return voter || learner
+}
+
+func encodeConfig(config Config) []byte {
+	config = config.copy()
+	data, _ := json.Marshal(config)
+	return data
+}
+
+func decodeConfig(data []byte) (Config, error) {
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return Config{}, err
+	}
+	// Configurations written before learners existed are a bare voter map
+	if config.Voters == nil {
+		if err := json.Unmarshal(data, &config.Voters); err != nil {
+			return Config{}, err
+		}
+	}
+	return config.copy(), nil
+}
+
+// MembersToProto converts a configuration into its wire form, sorted by id
+func MembersToProto(config Config) []*pb.Member {
+	out := make([]*pb.Member, 0, len(config.Voters)+len(config.Learners))
+	for _, id := range sortedIds(config.Voters) {
+		out = append(out, &pb.Member{Id: int32(id), Address: config.Voters[id]})
+	}
+	for _, id := range sortedIds(config.Learners) {
+		out = append(out, &pb.Member{Id: int32(id), Address: config.Learners[id], Learner: true})
+	}
+	return out
+}
+
+// MembersFromProto converts the wire form back into a configuration
+func MembersFromProto(members []*pb.Member) Config {
+	config := Config{Voters: make(map[int]string), Learners: make(map[int]string)}
+	for _, m := range members {
+		if m.Learner {
+			config.Learners[int(m.Id)] = m.Address
+		} else {
+			config.Voters[int(m.Id)] = m.Address
+		}
+	}
+	return config
+}
+
+func sortedIds(members map[int]string) []int {
+	ids := make([]int, 0, len(members))
+	for id := range members {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func copyMembers(members map[int]string) map[int]string {
+	out := make(map[int]string, len(members))
+	for id, addr := range members {
+		out[id] = addr
+	}
+	return out
+}
+
+func sameMembers(a, b map[int]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for id, addr := range a {
+		if other, ok := b[id]; !ok || other != addr {
+			return false
+		}
+	}
+	return true
+}
+
+// Members returns a copy of the current configuration
+func (rf *Raft) Members() Config {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.config()
+}
+
+func (rf *Raft) config() Config {
+	return Config{Voters: copyMembers(rf.members), Learners: copyMembers(rf.learners)}
+}
+
+// isMember reports whether id is a voter
+func (rf *Raft) isMember(id int) bool {
+	_, ok := rf.members[id]
+	return ok
+}
+
+func (rf *Raft) isLearner(id int) bool {
+	_, ok := rf.learners[id]
+	return ok
+}
+
+// quorum is the number of votes/acks needed from the current configuration
+func (rf *Raft) quorum() int {
+	return len(rf.members)/2 + 1
+}
+
+// peerIds lists every voter of the current configuration, sorted
+func (rf *Raft) peerIds() []int {
+	return sortedIds(rf.members)
+}
+
+// replicaIds lists every node the leader replicates to: voters and learners, sorted
+func (rf *Raft) replicaIds() []int {
+	ids := append(sortedIds(rf.members), sortedIds(rf.learners)...)
+	sort.Ints(ids)
+	return ids
+}
+
+func (rf *Raft) peerClient(server int) pb.RaftServiceClient {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.peers[server]
+}
+
+// configAt returns the configuration in effect at the given log index
+func (rf *Raft) configAt(index int) Config {
+	for i := index; i > rf.lastIncludedIndex; i-- {
+		entry := rf.entryAt(i)
+		if entry.Type != EntryConfig {
+			continue
+		}
+		config, err := decodeConfig(entry.Command)
+		if err != nil {
+			fmt.Printf("Node %d skipping corrupt config entry at %d: %v\n", rf.me, i, err)
+			continue
+		}
+		return config
+	}
+	return rf.snapshotConfig.copy()
+}
+
+// configFromLog returns the latest configuration in the log, committed or not
+func (rf *Raft) configFromLog() Config {
+	return rf.configAt(rf.lastLogIndex())
+}
+
+// setConfig switches to a new configuration, dialing new peers and dropping removed ones
+func (rf *Raft) setConfig(config Config) {
+	old := rf.config()
+	changed := !old.equal(config)
+	rf.members = copyMembers(config.Voters)
+	rf.learners = copyMembers(config.Learners)
+
+	addrs := make(map[int]string, len(rf.members)+len(rf.learners))
+	for id, addr := range rf.learners {
+		addrs[id] = addr
+	}
+	for id, addr := range rf.members {
+		addrs[id] = addr
+	}
+	oldAddrs := copyMembers(old.Learners)
+	for id, addr := range old.Voters {
+		oldAddrs[id] = addr
+	}
+
+	for id, addr := range addrs {
+		if id == rf.me {
+			continue
+		}
+		if rf.peers[id] != nil && oldAddrs[id] == addr {
+			continue
+		}
+		if conn := rf.conns[id]; conn != nil {
+			_ = conn.Close()
+		}
+		conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			fmt.Printf("Node %d failed to connect to peer %d at %s: %v\n", rf.me, id, addr, err)
+			delete(rf.peers, id)
+			delete(rf.conns, id)
+			continue
+		}
+		rf.conns[id] = conn
+		rf.peers[id] = pb.NewRaftServiceClient(conn)
+
+		// New peers start from the end of our log and backtrack from there
+		if rf.state == Leader {
+			rf.nextIndex[id] = rf.lastLogIndex() + 1
+			rf.matchIndex[id] = 0
+		}
+	}
+	for id := range rf.peers {
+		if _, ok := addrs[id]; !ok {
+			if conn := rf.conns[id]; conn != nil {
+				_ = conn.Close()
+			}
+			delete(rf.peers, id)
+			delete(rf.conns, id)
+			delete(rf.nextIndex, id)
+			delete(rf.matchIndex, id)
+		}
+	}
+
+	if changed {
+		fmt.Printf("Node %d switched to configuration voters=%v learners=%v\n", rf.me, rf.members, rf.learners)
+		rf.persistMembers()
+	}
+}
+
+// stepDownIfRemoved makes a leader that committed its own removal give up leadership
+func (rf *Raft) stepDownIfRemoved() {
+	if rf.state == Leader && !rf.isMember(rf.me) && rf.commitIndex >= rf.lastConfigIndex() {
+		fmt.Printf("Node %d removed from configuration, stepping down\n", rf.me)
+		rf.state = Follower
+		rf.leaderId = -1
+	}
+}
+
+// lastConfigIndex is the index of the latest config entry still in the log, 0 if none
+func (rf *Raft) lastConfigIndex() int {
+	for i := rf.lastLogIndex(); i > rf.lastIncludedIndex; i-- {
+		if rf.entryAt(i).Type == EntryConfig {
+			return i
+		}
+	}
+	return 0
+}
+
+// AddMember adds a voter to the cluster and waits for the change to commit
+func (rf *Raft) AddMember(id int, addr string) error {
+	return rf.changeConfig(func(config *Config) error {
+		if config.has(id) {
+			return ErrMemberExists
+		}
+		config.Voters[id] = addr
+		return nil
+	})
+}
+
+// AddLearner adds a non-voting replica to the cluster and waits for the change to commit
+func (rf *Raft) AddLearner(id int, addr string) error {
+	return rf.changeConfig(func(config *Config) error {
+		if config.has(id) {
+			return ErrMemberExists
+		}
+		config.Learners[id] = addr
+		return nil
+	})
+}
+
+// PromoteLearner turns a learner whose log has caught up into a voter
+func (rf *Raft) PromoteLearner(id int) error {
+	return rf.changeConfig(func(config *Config) error {
+		addr, ok := config.Learners[id]
+		if !ok {
+			return ErrNotLearner
+		}
+		// A lagging voter could stall commits until it catches up
+		if rf.matchIndex[id] < rf.commitIndex {
+			return ErrLearnerBehind
+		}
+		delete(config.Learners, id)
+		config.Voters[id] = addr
+		return nil
+	})
+}
+
+// RemoveMember removes a voter or learner from the cluster and waits for the change to commit
+func (rf *Raft) RemoveMember(id int) error {
+	return rf.changeConfig(func(config *Config) error {
+		if _, ok := config.Learners[id]; ok {
+			delete(config.Learners, id)
+			return nil
+		}
+		if _, ok := config.Voters[id]; !ok {
+			return ErrUnknownMember
+		}
+		if len(config.Voters) <= minVoters {
+			return ErrTooFewVoters
+		}
+		delete(config.Voters, id)
+		return nil
+	})
+}
+
+// changeConfig appends the configuration produced by mutate, which runs with rf.mu held
+func (rf *Raft) changeConfig(mutate func(config *Config) error) error {
+	rf.mu.Lock()
+	if rf.state != Leader {
+		rf.mu.Unlock()
+		return ErrNotLeader
+	}
+	// Only one change at a time, otherwise two disjoint majorities could form
+	if rf.lastConfigIndex() > rf.commitIndex {
+		rf.mu.Unlock()
+		return ErrConfigPending
+	}
+	// Dissertation bugfix: the previous configuration must be committed by this leader's term
+	if rf.entryAt(rf.commitIndex).Term != rf.currentTerm {
+		rf.mu.Unlock()
+		return ErrLeaderNotReady
+	}
+
+	config := rf.config()
+	if err := mutate(&config); err != nil {
+		rf.mu.Unlock()
+		return err
+	}
+
+	index := rf.lastLogIndex() + 1
+	term := rf.currentTerm
+	rf.log = append(rf.log, LogEntry{Index: index, Term: term, Command: encodeConfig(config), Type: EntryConfig})
+	rf.setConfig(config)
+	rf.mu.Unlock()
+
+	select {
+	case rf.triggerCh <- struct{}{}:
+	default:
+	}
+
+	return rf.waitCommitted(index, term)
+}
+
+// waitCommitted polls until the entry at index is committed in term, or the leader moves on
+func (rf *Raft) waitCommitted(index int, term int) error {
+	deadline := time.Now().Add(configTimeout)
+	for time.Now().Before(deadline) {
+		rf.mu.Lock()
+		if rf.commitIndex >= index {
+			ok := index <= rf.lastIncludedIndex || rf.entryAt(index).Term == term
+			rf.mu.Unlock()
+			if !ok {
+				return errors.New("membership change was overwritten by a new leader")
+			}
+			return nil
+		}
+		if rf.currentTerm != term {
+			rf.mu.Unlock()
+			return fmt.Errorf("leadership lost during membership change (term %d)", term)
+		}
+		rf.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	return ErrConfigTimeout
+}
@@ -1,7 +1,9 @@
 package raft
 
 import (
+	"encoding/binary"
 	"fmt"
+	"os"
 )
 
 // persist saves Raft log entries to WAL
@@ -15,16 +17,11 @@ func (rf *Raft) persist() {
 		// Convert only new entries (WAL.AppendEntries handles deduplication)
 		walEntries := make([]WALEntry, 0, len(rf.log))
 		for _, entry := range rf.log {
-			walEntries = append(walEntries, WALEntry{
-				RecordType: RecordTypeLog,
-				Index:      uint32(entry.Index),
-				Term:       uint32(entry.Term),
-				Command:    entry.Command,
-			})
+			walEntries = append(walEntries, toWALEntry(entry))
 		}
 
 		// WAL handles skipping already-persisted entries internally
-		rf.wal.AppendEntries(walEntries, 0)
+		rf.wal.AppendEntries(walEntries, rf.lastIncludedIndex)
 	}
 }
 
@@ -41,6 +38,30 @@ func (rf *Raft) persistState() {
 	)
 }
 
+func toWALEntry(entry LogEntry) WALEntry {
+	recordType := byte(RecordTypeLog)
+	switch entry.Type {
+	case EntryConfig:
+		recordType = RecordTypeConfig
+	case EntryNoop:
+		recordType = RecordTypeNoop
+	}
+	return WALEntry{
+		RecordType: recordType,
+		Index:      uint32(entry.Index),
+		Term:       uint32(entry.Term),
+		Command:    entry.Command,
+	}
+}
+
+// persistMembers saves the current configuration to WAL: only called when it changes
+func (rf *Raft) persistMembers() {
+	if rf.wal == nil {
+		return
+	}
+	rf.wal.PersistMembers(encodeConfig(rf.config()))
+}
+
 // readPersist restores Raft state from the WAL
 func (rf *Raft) readPersist() {
 	if rf.wal == nil {
@@ -57,16 +78,39 @@ func (rf *Raft) readPersist() {
 	if len(walEntries) > 0 {
 		// Clear existing log completely and rebuild from WAL
 		rf.log = make([]LogEntry, 0, len(walEntries))
-		
-		// Restore log entries from WAL (includes sentinel at index 0)
+
+		// The sentinel always stands for the snapshot, even if we crashed before the WAL was compacted
+		rf.log = append(rf.log, LogEntry{Index: rf.lastIncludedIndex, Term: rf.lastIncludedTerm})
+
+		// Restore log entries from WAL, skipping anything already covered by the snapshot
 		for _, walEntry := range walEntries {
-			if walEntry.RecordType == RecordTypeLog {
-				rf.log = append(rf.log, LogEntry{
-					Index:   int(walEntry.Index),
-					Term:    int(walEntry.Term),
-					Command: walEntry.Command,
-				})
+			if int(walEntry.Index) <= rf.lastIncludedIndex {
+				continue
+			}
+			entryType := EntryNormal
+			switch walEntry.RecordType {
+			case RecordTypeConfig:
+				entryType = EntryConfig
+			case RecordTypeNoop:
+				entryType = EntryNoop
 			}
+			rf.log = append(rf.log, LogEntry{
+				Index:   int(walEntry.Index),
+				Term:    int(walEntry.Term),
+				Command: walEntry.Command,
+				Type:    entryType,
+			})
+		}
+	}
+
+	// Persisted membership wins over the bootstrap configuration
+	if hardState.Members != nil {
+		config, err := decodeConfig(hardState.Members)
+		if err != nil {
+			fmt.Printf("raft node %d ignoring corrupt peer list in WAL: %v\n", rf.me, err)
+		} else {
+			rf.members = config.Voters
+			rf.learners = config.Learners
 		}
 	}
 
@@ -75,7 +119,98 @@ func (rf *Raft) readPersist() {
 		rf.currentTerm = int(hardState.Term)
 		rf.votedFor = int(hardState.Vote)
 		rf.commitIndex = int(hardState.Commit)
+		if rf.commitIndex < rf.lastIncludedIndex {
+			rf.commitIndex = rf.lastIncludedIndex
+		}
 		fmt.Printf("Node %d recovered hard state: Term=%d, Vote=%d, Commit=%d\n",
 			rf.me, rf.currentTerm, rf.votedFor, rf.commitIndex)
 	}
 }
+
+func snapshotFileName(nodeId int) string {
+	return fmt.Sprintf("raft_snapshot_%d", nodeId)
+}
+
+// persistSnapshot writes the snapshot atomically (tmp file + rename) and then
+// rewrites the WAL so it only holds the entries after lastIncludedIndex
+func (rf *Raft) persistSnapshot() error {
+	filename := snapshotFileName(rf.me)
+	tmpName := filename + ".tmp"
+
+	// Format: [LastIncludedIndex(4)][LastIncludedTerm(4)][MembersLen(4)][Members][Data]
+	members := encodeConfig(rf.snapshotConfig)
+	buf := make([]byte, 12+len(members)+len(rf.snapshot))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(rf.lastIncludedIndex))
+	binary.LittleEndian.PutUint32(buf[4:8], uint32(rf.lastIncludedTerm))
+	binary.LittleEndian.PutUint32(buf[8:12], uint32(len(members)))
+	copy(buf[12:], members)
+	copy(buf[12+len(members):], rf.snapshot)
+
+	f, err := os.Create(tmpName)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, filename); err != nil {
+		return err
+	}
+
+	if rf.wal == nil {
+		return nil
+	}
+	walEntries := make([]WALEntry, 0, len(rf.log))
+	for _, entry := range rf.log {
+		walEntries = append(walEntries, toWALEntry(entry))
+	}
+	return rf.wal.Compact(walEntries, HardState{
+		Term:    uint32(rf.currentTerm),
+		Vote:    uint32(rf.votedFor),
+		Commit:  uint32(rf.commitIndex),
+		Members: encodeConfig(rf.config()),
+	})
+}
+
+// readSnapshot restores the snapshot metadata and data from disk
+func (rf *Raft) readSnapshot() {
+	data, err := os.ReadFile(snapshotFileName(rf.me))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Printf("raft readSnapshot err node %d: %s\n", rf.me, err)
+		}
+		return
+	}
+	if len(data) < 12 {
+		fmt.Printf("raft readSnapshot node %d: snapshot file too small\n", rf.me)
+		return
+	}
+	membersLen := int(binary.LittleEndian.Uint32(data[8:12]))
+	if 12+membersLen > len(data) {
+		fmt.Printf("raft readSnapshot node %d: truncated peer list\n", rf.me)
+		return
+	}
+	config, err := decodeConfig(data[12 : 12+membersLen])
+	if err != nil {
+		fmt.Printf("raft readSnapshot node %d: corrupt peer list: %v\n", rf.me, err)
+		return
+	}
+
+	rf.lastIncludedIndex = int(binary.LittleEndian.Uint32(data[0:4]))
+	rf.lastIncludedTerm = int(binary.LittleEndian.Uint32(data[4:8]))
+	rf.snapshotConfig = config
+	rf.snapshot = data[12+membersLen:]
+
+	rf.log = []LogEntry{{Index: rf.lastIncludedIndex, Term: rf.lastIncludedTerm}}
+	rf.commitIndex = rf.lastIncludedIndex
+	fmt.Printf("Node %d recovered snapshot: LastIncludedIndex=%d, LastIncludedTerm=%d\n",
+		rf.me, rf.lastIncludedIndex, rf.lastIncludedTerm)
+}
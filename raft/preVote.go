@@ -0,0 +1,128 @@
+package raft
+
+import (
+	pb "KV-Store/proto"
+	"context"
+	"time"
+)
+
+/*
+	Pre-Vote (Raft dissertation, section 9.6).
+	Before bumping its term a candidate asks the cluster whether it could win an election
+	at currentTerm+1. Nothing is persisted and no one changes term, so a node cut off from
+	the leader keeps failing here instead of inflating its term and forcing the healthy
+	leader to step down when the partition heals.
+*/
+
+type PreVoteArgs struct {
+	Term         int // the term the candidate would campaign in
+	CandidateId  int
+	LastLogIndex int
+	LastLogTerm  int
+}
+
+type PreVoteReply struct {
+	Term        int
+	VoteGranted bool
+}
+
+func (rf *Raft) PreVote(args *PreVoteArgs, reply *PreVoteReply) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	reply.Term = rf.currentTerm
+	reply.VoteGranted = false
+
+	if args.Term < rf.currentTerm {
+		return
+	}
+	// A live leader exists, the candidate is the one that lost contact
+	if rf.state == Leader {
+		return
+	}
+	if rf.leaderId != -1 && time.Since(rf.lastResetTime) < electionTimeoutMin {
+		return
+	}
+	reply.VoteGranted = rf.isLogUpToDate(args.LastLogIndex, args.LastLogTerm)
+}
+
+// preVote reports whether a majority would vote for us in the next term
+func (rf *Raft) preVote() bool {
+	rf.mu.Lock()
+	lastLogIndex := rf.lastLogIndex()
+	args := PreVoteArgs{
+		Term:         rf.currentTerm + 1,
+		CandidateId:  rf.me,
+		LastLogIndex: lastLogIndex,
+		LastLogTerm:  rf.entryAt(lastLogIndex).Term,
+	}
+	peerIds := rf.peerIds()
+	votesRequired := rf.quorum()
+	rf.mu.Unlock()
+
+	votesReceived := 1 // Vote for self
+	if votesReceived >= votesRequired {
+		return true
+	}
+
+	results := make(chan bool, len(peerIds))
+	asked := 0
+	for _, i := range peerIds {
+		if i == rf.me {
+			continue
+		}
+		asked++
+		go func(peerIndex int) {
+			reply := PreVoteReply{}
+			if !rf.sendPreVote(peerIndex, &args, &reply) {
+				results <- false
+				return
+			}
+
+			rf.mu.Lock()
+			if reply.Term > rf.currentTerm {
+				rf.currentTerm = reply.Term
+				rf.state = Follower
+				rf.votedFor = -1
+				rf.leaderId = -1
+				rf.persistState()
+			}
+			rf.mu.Unlock()
+			results <- reply.VoteGranted
+		}(i)
+	}
+
+	for ; asked > 0; asked-- {
+		if <-results {
+			votesReceived++
+			if votesReceived >= votesRequired {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (rf *Raft) sendPreVote(server int, args *PreVoteArgs, reply *PreVoteReply) bool {
+	client := rf.peerClient(server)
+	if client == nil {
+		return false
+	}
+	pbArgs := &pb.PreVoteRequest{
+		Term:         int32(args.Term),
+		CandidateId:  int32(args.CandidateId),
+		LastLogIndex: int32(args.LastLogIndex),
+		LastLogTerm:  int32(args.LastLogTerm),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	pbReply, err := client.PreVote(ctx, pbArgs)
+	if err != nil {
+		return false
+	}
+	reply.Term = int(pbReply.Term)
+	reply.VoteGranted = pbReply.VoteGranted
+	return true
+}
@@ -8,37 +8,78 @@ import (
 	"math/rand"
 	"sync"
 	"time"
+
+	"google.golang.org/grpc"
 )
 
 type State int
 
+// electionTimeoutMin is the shortest randomized election timeout used by ticker
+const electionTimeoutMin = 800 * time.Millisecond
+
 const (
 	Follower State = iota
 	Candidate
 	Leader
 )
 
+type EntryType int
+
+const (
+	EntryNormal EntryType = iota // command for the state machine
+	EntryConfig                  // membership change, consumed by raft itself
+	EntryNoop                    // appended by a new leader to commit an entry in its own term
+)
+
 // LogEntry represents a single entry in the Raft log
 type LogEntry struct {
 	Index   int
 	Term    int
 	Command []byte
+	Type    EntryType
+}
+
+// ApplyMsg is what the applier hands to the service: either a committed log
+// entry or a snapshot that replaces the state machine up to SnapshotIndex.
+// CommandValid is false for raft-internal entries (config, no-op); they are
+// still delivered so the service can track its applied index.
+type ApplyMsg struct {
+	CommandValid bool
+	Command      []byte
+	Index        int
+	Term         int
+
+	SnapshotValid bool
+	Snapshot      []byte
+	SnapshotIndex int
+	SnapshotTerm  int
 }
 
 type Raft struct {
 	mu        sync.Mutex
-	peers     []pb.RaftServiceClient // RPC clients to talk to other nodes
+	peers     map[int]pb.RaftServiceClient // RPC clients to talk to other nodes, keyed by node id
+	conns     map[int]*grpc.ClientConn
+	members   map[int]string // current voters: node id -> gRPC address
+	learners  map[int]string // current non-voting replicas: node id -> gRPC address
 	me        int
 	leaderId  int
-	applyCh   chan LogEntry
+	applyCh   chan ApplyMsg
 	triggerCh chan struct{}
-	commitCh  chan struct{} 
+	commitCh  chan struct{}
 
 	//persistent states
 	currentTerm int
 	votedFor    int
 	log         []LogEntry
-	wal         *WAL 
+	wal         *WAL
+
+	// snapshot state: rf.log[0] is a sentinel for lastIncludedIndex
+	lastIncludedIndex int
+	lastIncludedTerm  int
+	snapshot          []byte
+	snapshotConfig    Config // configuration as of lastIncludedIndex
+	pendingSnapshot   bool   // snapshot installed by leader, not yet handed to applier
+	snapshotInFlight  map[int]bool
 
 	//volatile state on all servers
 	commitIndex int // index of highest log entry known to be committed
@@ -47,6 +88,12 @@ type Raft struct {
 	//volatile state on leaders
 	nextIndex  map[int]int
 	matchIndex map[int]int
+	lastAck    map[int]time.Time // start of the latest heartbeat round each peer acknowledged
+
+	transferTarget int // node we are handing leadership to, -1 if none
+	// leaseBlockedUntil: heartbeat rounds started before it do not back a lease. A transfer target
+	// campaigns past leader stickiness, so acks from before TimeoutNow prove nothing about new leaders.
+	leaseBlockedUntil time.Time
 
 	state         State
 	lastResetTime time.Time //last time we heard from a leader
@@ -64,23 +111,41 @@ func (rf *Raft) GetLeader() int {
 	return rf.leaderId
 }
 
+// LogSize returns the number of entries held in memory since the last snapshot
+func (rf *Raft) LogSize() int {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return len(rf.log) - 1
+}
+
+// lastLogIndex returns the absolute index of the last log entry
+func (rf *Raft) lastLogIndex() int {
+	return rf.lastIncludedIndex + len(rf.log) - 1
+}
+
+// entryAt translates an absolute log index into a position in rf.log
+func (rf *Raft) entryAt(index int) LogEntry {
+	return rf.log[index-rf.lastIncludedIndex]
+}
+
 func (rf *Raft) Start(command interface{}) (int, int, bool) {
 	rf.mu.Lock()
 	defer rf.mu.Unlock()
 
-	if rf.state != Leader {
+	// New writes would only delay a leadership transfer, the target serves them shortly
+	if rf.state != Leader || rf.transferTarget != -1 {
 		return -1, rf.currentTerm, false
 	}
 
 	//create log entry
-	index := len(rf.log)
+	index := rf.lastLogIndex() + 1
 	term := rf.currentTerm
 	// TODO: Use type assertion or serialization later here
 	cmdBytes, ok := command.([]byte)
 	if !ok {
 		return -1, rf.currentTerm, false
 	}
-	rf.log = append(rf.log, LogEntry{index, term, cmdBytes})
+	rf.log = append(rf.log, LogEntry{Index: index, Term: term, Command: cmdBytes})
 
 	//trigger replication
 	select {
@@ -94,6 +159,21 @@ func (rf *Raft) Start(command interface{}) (int, int, bool) {
 func (rf *Raft) applier() {
 	for range rf.commitCh {
 		rf.mu.Lock()
+		// A snapshot from the leader supersedes everything not yet applied
+		if rf.pendingSnapshot {
+			rf.pendingSnapshot = false
+			msg := ApplyMsg{
+				SnapshotValid: true,
+				Snapshot:      rf.snapshot,
+				SnapshotIndex: rf.lastIncludedIndex,
+				SnapshotTerm:  rf.lastIncludedTerm,
+			}
+			rf.lastApplied = rf.lastIncludedIndex
+			rf.mu.Unlock()
+			rf.applyCh <- msg
+
+			rf.mu.Lock()
+		}
 		if rf.commitIndex <= rf.lastApplied {
 			rf.mu.Unlock()
 			continue
@@ -103,19 +183,38 @@ func (rf *Raft) applier() {
 		entriesToApply := make([]LogEntry, 0, rf.commitIndex-rf.lastApplied)
 		for rf.lastApplied < rf.commitIndex {
 			rf.lastApplied++
-			entriesToApply = append(entriesToApply, rf.log[rf.lastApplied])
+			entriesToApply = append(entriesToApply, rf.entryAt(rf.lastApplied))
 		}
 		rf.mu.Unlock()
 
 		for _, entry := range entriesToApply {
-			rf.applyCh <- entry
+			rf.applyCh <- ApplyMsg{
+				CommandValid: entry.Type == EntryNormal,
+				Command:      entry.Command,
+				Index:        entry.Index,
+				Term:         entry.Term,
+			}
 		}
 	}
 }
 
-func Make(peers []pb.RaftServiceClient, me int, applyCh chan LogEntry) *Raft {
+// signalApplier wakes up the applier without blocking
+func (rf *Raft) signalApplier() {
+	select {
+	case rf.commitCh <- struct{}{}:
+	default:
+	}
+}
+
+// Make creates a raft peer. members is the bootstrap configuration (node id -> gRPC address);
+// a configuration persisted in the WAL or snapshot takes precedence over it.
+func Make(members map[int]string, me int, applyCh chan ApplyMsg) *Raft {
 	rf := &Raft{}
-	rf.peers = peers
+	rf.peers = make(map[int]pb.RaftServiceClient)
+	rf.conns = make(map[int]*grpc.ClientConn)
+	rf.members = make(map[int]string)
+	rf.learners = make(map[int]string)
+	rf.snapshotConfig = Config{Voters: members}
 	rf.me = me
 	rf.applyCh = applyCh
 	rf.triggerCh = make(chan struct{}, 1)
@@ -133,6 +232,9 @@ func Make(peers []pb.RaftServiceClient, me int, applyCh chan LogEntry) *Raft {
 
 	rf.nextIndex = make(map[int]int)
 	rf.matchIndex = make(map[int]int)
+	rf.lastAck = make(map[int]time.Time)
+	rf.transferTarget = -1
+	rf.snapshotInFlight = make(map[int]bool)
 
 	// Initialize WAL
 	wal, err := createOrOpenRaftWAL(me)
@@ -142,10 +244,24 @@ func Make(peers []pb.RaftServiceClient, me int, applyCh chan LogEntry) *Raft {
 	}
 	rf.wal = wal
 
-	// Recover state from WAL
+	// Recover state from snapshot and WAL
+	rf.readSnapshot()
 	rf.readPersist()
 	rf.lastResetTime = time.Now()
 
+	// Without a persisted peer list, fall back to the log, snapshot and bootstrap flags
+	if len(rf.members) == 0 {
+		rf.setConfig(rf.configFromLog())
+	} else {
+		rf.setConfig(rf.config())
+	}
+
+	// Hand the on-disk snapshot to the service before replaying the log tail
+	if rf.lastIncludedIndex > 0 {
+		rf.pendingSnapshot = true
+		rf.signalApplier()
+	}
+
 	go rf.ticker()
 	go rf.applier()
 	go rf.replicator()
@@ -182,9 +298,9 @@ func (rf *Raft) ticker() {
 
 		if currentState == Leader {
 			rf.sendHeartBeats()
-		} else {
+		} else if rf.isMember(rf.me) {
 			// a randomized timeout after which election starts
-			electionTimeout := time.Duration(800+rand.Intn(200)) * time.Millisecond
+			electionTimeout := electionTimeoutMin + time.Duration(rand.Intn(200))*time.Millisecond
 			if time.Since(lastReset) > electionTimeout {
 				rf.startElection()
 			}
@@ -193,27 +309,55 @@ func (rf *Raft) ticker() {
 }
 func (rf *Raft) startElection() {
 	rf.mu.Lock()
+	// The election timer fired, so we no longer consider the old leader alive
+	rf.leaderId = -1
+	term := rf.currentTerm
+	rf.mu.Unlock()
+
+	if !rf.preVote() {
+		// Wait a full timeout before asking again
+		rf.mu.Lock()
+		rf.lastResetTime = time.Now()
+		rf.mu.Unlock()
+		return
+	}
+
+	rf.campaign(term, false)
+}
+
+// campaign bumps the term and asks for votes. term is the term the decision to campaign was made in;
+// transfer marks an election started on the leader's request, which voters must not ignore.
+func (rf *Raft) campaign(term int, transfer bool) {
+	rf.mu.Lock()
+	// Someone else won or a leader showed up while we were deciding
+	if rf.state == Leader || rf.currentTerm != term || (!transfer && rf.leaderId != -1) {
+		rf.mu.Unlock()
+		return
+	}
 	rf.state = Candidate
+	rf.leaderId = -1
 	rf.currentTerm++
 	rf.votedFor = rf.me
 	rf.lastResetTime = time.Now()
-	rf.persistState() 
+	rf.persistState()
 
-	term := rf.currentTerm
-	lastLogIndex := len(rf.log) - 1
-	lastLogTerm := rf.log[lastLogIndex].Term
+	term = rf.currentTerm
+	lastLogIndex := rf.lastLogIndex()
+	lastLogTerm := rf.entryAt(lastLogIndex).Term
+	peerIds := rf.peerIds()
+	votesRequired := rf.quorum()
 	rf.mu.Unlock()
 
 	votesReceived := 1 // Vote for self
-	votesRequired := len(rf.peers)/2 + 1
 
-	for i := range rf.peers {
+	for _, i := range peerIds {
 		go func(peerIndex int) {
 			args := RequestVoteArgs{
-				Term:         term,
-				CandidateId:  rf.me,
-				LastLogTerm:  lastLogTerm,
-				LastLogIndex: lastLogIndex,
+				Term:               term,
+				CandidateId:        rf.me,
+				LastLogTerm:        lastLogTerm,
+				LastLogIndex:       lastLogIndex,
+				LeadershipTransfer: transfer,
 			}
 			reply := RequestVoteReply{}
 
@@ -240,10 +384,18 @@ func (rf *Raft) startElection() {
 					if votesReceived == votesRequired {
 						rf.state = Leader
 						rf.leaderId = rf.me
-						for p := range rf.peers {
-							rf.nextIndex[p] = len(rf.log)
+						for _, p := range rf.replicaIds() {
+							rf.nextIndex[p] = rf.lastLogIndex() + 1
 							rf.matchIndex[p] = 0
 						}
+						rf.lastAck = make(map[int]time.Time)
+						rf.transferTarget = -1
+						// Commit a no-op so entries from earlier terms (and ReadIndex) can make progress
+						rf.log = append(rf.log, LogEntry{Index: rf.lastLogIndex() + 1, Term: rf.currentTerm, Type: EntryNoop})
+						select {
+						case rf.triggerCh <- struct{}{}:
+						default:
+						}
 						go rf.sendHeartBeats()
 					}
 				}
@@ -253,7 +405,8 @@ func (rf *Raft) startElection() {
 }
 
 func (rf *Raft) sendRequestVote(server int, args *RequestVoteArgs, reply *RequestVoteReply) bool {
-	if rf.peers[server] == nil {
+	client := rf.peerClient(server)
+	if client == nil {
 		return false
 	}
 	pbArgs := &pb.RequestVoteRequest{
@@ -261,12 +414,14 @@ func (rf *Raft) sendRequestVote(server int, args *RequestVoteArgs, reply *Reques
 		CandidateId:  int32(args.CandidateId),
 		LastLogIndex: int32(args.LastLogIndex),
 		LastLogTerm:  int32(args.LastLogTerm),
+
+		LeadershipTransfer: args.LeadershipTransfer,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
 	defer cancel()
 
-	pbReply, err := rf.peers[server].RequestVote(ctx, pbArgs)
+	pbReply, err := client.RequestVote(ctx, pbArgs)
 	if err != nil {
 		return false
 	}
@@ -282,4 +437,10 @@ func (rf *Raft) reportMetrics() {
 	metrics.CommitIndexGauge.WithLabelValues(id).Set(float64(rf.commitIndex))
 	metrics.StateGauge.WithLabelValues(id).Set(float64(rf.state))
 	metrics.LeaderGauge.WithLabelValues(id).Set(float64(rf.leaderId))
+
+	leaseValid := 0.0
+	if _, ok := rf.LeaseReadIndex(); ok {
+		leaseValid = 1
+	}
+	metrics.LeaseValidGauge.WithLabelValues(id).Set(leaseValid)
 }
@@ -25,12 +25,16 @@ var walBufPool = sync.Pool{
 const (
 	RecordTypeLog       = 0x00
 	RecordTypeHardState = 0x01
+	RecordTypeConfig    = 0x02 // log entry carrying a membership change
+	RecordTypeMembers   = 0x03 // current peer list, written whenever the configuration changes
+	RecordTypeNoop      = 0x04 // empty log entry appended by a new leader
 )
 
 type HardState struct {
-	Term   uint32
-	Vote   uint32
-	Commit uint32
+	Term    uint32
+	Vote    uint32
+	Commit  uint32
+	Members []byte // latest peer list record, nil if none was ever written
 }
 
 type WALEntry struct {
@@ -42,6 +46,7 @@ type WALEntry struct {
 
 type WAL struct {
 	file          *os.File
+	path          string
 	writer        *bufio.Writer
 	mu            sync.Mutex
 	triggerCh     chan struct{}
@@ -58,6 +63,7 @@ func createOrOpenRaftWAL(nodeId int) (*WAL, error) {
 
 	wal := &WAL{
 		file:          f,
+		path:          filename,
 		writer:        writer,
 		lastPersisted: 0, // dummy value
 		triggerCh:     make(chan struct{}, 1),
@@ -119,7 +125,7 @@ func (w *WAL) AppendEntries(entries []WALEntry, startIndex int) error {
 		if idx <= w.lastPersisted {
 			continue
 		}
-		if err := buf.WriteByte(RecordTypeLog); err != nil {
+		if err := buf.WriteByte(entry.RecordType); err != nil {
 			return err
 		}
 
@@ -188,6 +194,104 @@ func (w *WAL) PersistHardState(term, vote, commit uint32) error {
 	return nil
 }
 
+// PersistMembers writes the current peer list to WAL: [Len(4)][Members]
+func (w *WAL) PersistMembers(members []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	buf := walBufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer walBufPool.Put(buf)
+
+	buf.WriteByte(RecordTypeMembers)
+	var lenBuf [4]byte
+	binary.LittleEndian.PutUint32(lenBuf[:], uint32(len(members)))
+	buf.Write(lenBuf[:])
+	buf.Write(members)
+
+	if _, err := w.writer.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+
+	select {
+	case w.triggerCh <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Compact replaces the WAL with a fresh file holding only the given hard state and entries.
+// Called after a snapshot so restarts no longer replay the log from genesis.
+func (w *WAL) Compact(entries []WALEntry, state HardState) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	buf := walBufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer walBufPool.Put(buf)
+
+	headerScratch := make([]byte, 12)
+
+	// Hard state first so the term and vote survive the rewrite
+	buf.WriteByte(RecordTypeHardState)
+	binary.LittleEndian.PutUint32(headerScratch[0:4], state.Term)
+	binary.LittleEndian.PutUint32(headerScratch[4:8], state.Vote)
+	binary.LittleEndian.PutUint32(headerScratch[8:12], state.Commit)
+	buf.Write(headerScratch)
+
+	if state.Members != nil {
+		buf.WriteByte(RecordTypeMembers)
+		binary.LittleEndian.PutUint32(headerScratch[0:4], uint32(len(state.Members)))
+		buf.Write(headerScratch[0:4])
+		buf.Write(state.Members)
+	}
+
+	for _, entry := range entries {
+		buf.WriteByte(entry.RecordType)
+		binary.LittleEndian.PutUint32(headerScratch[0:4], entry.Index)
+		binary.LittleEndian.PutUint32(headerScratch[4:8], entry.Term)
+		binary.LittleEndian.PutUint32(headerScratch[8:12], uint32(len(entry.Command)))
+		buf.Write(headerScratch)
+		buf.Write(entry.Command)
+	}
+
+	tmpName := w.path + ".tmp"
+	f, err := os.Create(tmpName)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	_ = f.Close()
+
+	// Swap the files, anything still buffered belongs to the old log
+	_ = w.writer.Flush()
+	_ = w.file.Close()
+	if err := os.Rename(tmpName, w.path); err != nil {
+		return err
+	}
+
+	newFile, err := os.OpenFile(w.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	w.file = newFile
+	w.writer = bufio.NewWriterSize(newFile, 64*1024)
+	if len(entries) > 0 {
+		w.lastPersisted = entries[len(entries)-1].Index
+	}
+	return nil
+}
+
 // RecoverEntries Returns recovered entries, hard states, errors
 func (w *WAL) RecoverEntries() ([]WALEntry, HardState, error) {
 	w.mu.Lock()
@@ -215,7 +319,7 @@ func (w *WAL) RecoverEntries() ([]WALEntry, HardState, error) {
 
 		switch typeByte {
 		// Append into entries for Logs
-		case RecordTypeLog:
+		case RecordTypeLog, RecordTypeConfig, RecordTypeNoop:
 			if _, err := io.ReadFull(reader, header); err != nil {
 				return entries, state, err
 			}
@@ -228,7 +332,7 @@ func (w *WAL) RecoverEntries() ([]WALEntry, HardState, error) {
 			if _, err := io.ReadFull(reader, cmd); err != nil {
 				return entries, state, err
 			}
-			entries = append(entries, WALEntry{RecordTypeLog, idx, term, cmd})
+			entries = append(entries, WALEntry{typeByte, idx, term, cmd})
 
 		// Update states for Hard State
 		case RecordTypeHardState:
@@ -238,6 +342,17 @@ func (w *WAL) RecoverEntries() ([]WALEntry, HardState, error) {
 			state.Term = binary.LittleEndian.Uint32(header[0:4])
 			state.Vote = binary.LittleEndian.Uint32(header[4:8])
 			state.Commit = binary.LittleEndian.Uint32(header[8:12])
+
+		// Latest peer list wins
+		case RecordTypeMembers:
+			if _, err := io.ReadFull(reader, header[0:4]); err != nil {
+				return entries, state, err
+			}
+			members := make([]byte, binary.LittleEndian.Uint32(header[0:4]))
+			if _, err := io.ReadFull(reader, members); err != nil {
+				return entries, state, err
+			}
+			state.Members = members
 		}
 	}
 
@@ -0,0 +1,99 @@
+package raft
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+/*
+	ReadIndex (Raft dissertation, section 6.4).
+	The leader records its commit index, proves it is still leader with a round of heartbeats
+	acknowledged by a majority, and hands the index back. The service serves the read once it
+	has applied up to that index, without writing anything to the log.
+*/
+
+var ErrReadTimeout = errors.New("timeout confirming leadership for read")
+
+const readIndexTimeout = 1 * time.Second
+
+// leaseDuration is how long a majority-acknowledged heartbeat round keeps the leader's lease.
+// Followers do not vote for anyone else within electionTimeoutMin of hearing from the leader,
+// so a new leader cannot exist before it runs out; the margin absorbs clock drift.
+// Leadership transfers bypass that stickiness, so they suspend the lease.
+const leaseDuration = electionTimeoutMin * 9 / 10
+
+// LeaseReadIndex returns the commit index if the leader lease is still valid, so the read
+// can be served without a heartbeat round. ok is false when the caller must fall back to ReadIndex.
+func (rf *Raft) LeaseReadIndex() (int, bool) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.state != Leader || rf.entryAt(rf.commitIndex).Term != rf.currentTerm {
+		return -1, false
+	}
+	// The transfer target may win without waiting out our lease, see TransferLeadership
+	if rf.transferTarget != -1 {
+		return -1, false
+	}
+	ackTime := rf.quorumAckTime()
+	if ackTime.Before(rf.leaseBlockedUntil) || !time.Now().Before(ackTime.Add(leaseDuration)) {
+		return -1, false
+	}
+	return rf.commitIndex, true
+}
+
+// ReadIndex returns a commit index that is safe to serve linearizable reads from
+func (rf *Raft) ReadIndex() (int, error) {
+	rf.mu.Lock()
+	if rf.state != Leader {
+		rf.mu.Unlock()
+		return -1, ErrNotLeader
+	}
+	// Until our no-op commits we do not know the latest committed index
+	if rf.entryAt(rf.commitIndex).Term != rf.currentTerm {
+		rf.mu.Unlock()
+		return -1, ErrLeaderNotReady
+	}
+	readIndex := rf.commitIndex
+	term := rf.currentTerm
+	requestTime := time.Now()
+	rf.mu.Unlock()
+
+	go rf.sendHeartBeats()
+
+	deadline := requestTime.Add(readIndexTimeout)
+	for time.Now().Before(deadline) {
+		rf.mu.Lock()
+		if rf.state != Leader || rf.currentTerm != term {
+			rf.mu.Unlock()
+			return -1, ErrNotLeader
+		}
+		confirmed := !rf.quorumAckTime().Before(requestTime)
+		rf.mu.Unlock()
+
+		if confirmed {
+			return readIndex, nil
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return -1, ErrReadTimeout
+}
+
+// quorumAckTime is the latest heartbeat round start acknowledged by a majority (the leader counts as now)
+func (rf *Raft) quorumAckTime() time.Time {
+	acks := make([]time.Time, 0, len(rf.members))
+	for id := range rf.members {
+		if id == rf.me {
+			acks = append(acks, time.Now())
+		} else {
+			acks = append(acks, rf.lastAck[id])
+		}
+	}
+	if len(acks) < rf.quorum() {
+		return time.Time{}
+	}
+	// Newest first, the quorum-th newest ack is held by a majority
+	sort.Slice(acks, func(i, j int) bool { return acks[i].After(acks[j]) })
+	return acks[rf.quorum()-1]
+}
@@ -7,6 +7,8 @@ type RequestVoteArgs struct {
 	CandidateId  int
 	LastLogIndex int
 	LastLogTerm  int
+
+	LeadershipTransfer bool // election started by TimeoutNow, bypasses leader stickiness
 }
 
 type RequestVoteReply struct {
@@ -24,6 +26,15 @@ func (rf *Raft) RequestVote(args *RequestVoteArgs, reply *RequestVoteReply) {
 		reply.VoteGranted = false
 		return
 	}
+	// Leader stickiness: while we hear from a live leader, ignore candidates entirely.
+	// This is what keeps the leader lease safe.
+	// The current leader asked for this election when it is a leadership transfer.
+	if !args.LeadershipTransfer && rf.leaderId != -1 && args.CandidateId != rf.leaderId &&
+		time.Since(rf.lastResetTime) < electionTimeoutMin {
+		reply.Term = rf.currentTerm
+		reply.VoteGranted = false
+		return
+	}
 	//We can become a follower
 	if args.Term > rf.currentTerm {
 		rf.currentTerm = args.Term
@@ -33,18 +44,8 @@ func (rf *Raft) RequestVote(args *RequestVoteArgs, reply *RequestVoteReply) {
 		rf.persistState()
 	}
 	reply.Term = rf.currentTerm
-	lastLogIndex := len(rf.log) - 1
-	LastLogTerm := rf.log[lastLogIndex].Term
 
-	logOk := false
-	//if log of candidate is greater or upto date with current node accept
-	if args.LastLogTerm > LastLogTerm {
-		logOk = true
-	} else if args.LastLogTerm == LastLogTerm && args.LastLogIndex >= lastLogIndex {
-		logOk = true
-	}
-
-	if (rf.votedFor == -1 || rf.votedFor == args.CandidateId) && logOk {
+	if (rf.votedFor == -1 || rf.votedFor == args.CandidateId) && rf.isLogUpToDate(args.LastLogIndex, args.LastLogTerm) {
 		rf.votedFor = args.CandidateId
 		rf.state = Follower
 		rf.persistState()
@@ -54,3 +55,15 @@ func (rf *Raft) RequestVote(args *RequestVoteArgs, reply *RequestVoteReply) {
 		reply.VoteGranted = false
 	}
 }
+
+// isLogUpToDate reports whether a candidate's log is at least as up to date as ours
+func (rf *Raft) isLogUpToDate(lastLogIndex int, lastLogTerm int) bool {
+	ourIndex := rf.lastLogIndex()
+	ourTerm := rf.entryAt(ourIndex).Term
+
+	//if log of candidate is greater or upto date with current node accept
+	if lastLogTerm > ourTerm {
+		return true
+	}
+	return lastLogTerm == ourTerm && lastLogIndex >= ourIndex
+}
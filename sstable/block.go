@@ -0,0 +1,250 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+/*
+	Data block (format version 2), LevelDB style:
+	[Entry 0] ... [Entry N][Restart(4) x R][NumRestarts(4)]
+
+	Entry: [Header(1)][Shared(uvarint)][Unshared(uvarint)][ValLen(uvarint)][Seq(uvarint)][ExpiresAt(uvarint)?][KeySuffix][ValBytes]
+	Header bit 0 marks a tombstone, bit 1 an entry with an expiry time (unix nanoseconds) after Seq.
+	Shared is the number of leading key bytes shared with the previous entry. Every
+	restartInterval entries the prefix is reset (Shared = 0) and the entry's offset is recorded
+	as a restart point, so a lookup binary-searches the restarts and scans at most one interval.
+
+	Seq is the sequence number of the write. Version 1 tables store full keys without Seq (read as 0):
+	[Header(1)][KeyLen(2)][ValLen(4)][KeyBytes][ValBytes]
+*/
+
+const restartInterval = 16
+
+const (
+	flagTombstone = 1 << 0
+	flagExpiring  = 1 << 1
+)
+
+var errBadBlock = errors.New("malformed block")
+
+// blockBuilder accumulates the prefix-compressed entries of one data block
+type blockBuilder struct {
+	buf      []byte
+	restarts []uint32
+	counter  int // entries since the last restart point
+	lastKey  []byte
+}
+
+func (bb *blockBuilder) add(key []byte, val []byte, seq uint64, expiresAt int64, isTombstone bool) {
+	shared := 0
+	if bb.counter < restartInterval && len(bb.buf) > 0 {
+		for shared < len(key) && shared < len(bb.lastKey) && key[shared] == bb.lastKey[shared] {
+			shared++
+		}
+	} else {
+		bb.restarts = append(bb.restarts, uint32(len(bb.buf)))
+		bb.counter = 0
+	}
+	header := byte(0)
+	if isTombstone {
+		header = flagTombstone
+		val = nil // Tombstones have no val
+		expiresAt = 0
+	}
+	if expiresAt != 0 {
+		header |= flagExpiring
+	}
+	bb.buf = append(bb.buf, header)
+	bb.buf = binary.AppendUvarint(bb.buf, uint64(shared))
+	bb.buf = binary.AppendUvarint(bb.buf, uint64(len(key)-shared))
+	bb.buf = binary.AppendUvarint(bb.buf, uint64(len(val)))
+	bb.buf = binary.AppendUvarint(bb.buf, seq)
+	if expiresAt != 0 {
+		bb.buf = binary.AppendUvarint(bb.buf, uint64(expiresAt))
+	}
+	bb.buf = append(bb.buf, key[shared:]...)
+	bb.buf = append(bb.buf, val...)
+
+	bb.lastKey = append(bb.lastKey[:0], key...)
+	bb.counter++
+}
+
+func (bb *blockBuilder) empty() bool {
+	return len(bb.buf) == 0
+}
+
+// size is the encoded size of the entries so far, without the restart array
+func (bb *blockBuilder) size() int {
+	return len(bb.buf)
+}
+
+// finish appends the restart array and returns the encoded block
+func (bb *blockBuilder) finish() []byte {
+	for _, r := range bb.restarts {
+		bb.buf = binary.LittleEndian.AppendUint32(bb.buf, r)
+	}
+	bb.buf = binary.LittleEndian.AppendUint32(bb.buf, uint32(len(bb.restarts)))
+	return bb.buf
+}
+
+func (bb *blockBuilder) reset() {
+	bb.buf = bb.buf[:0]
+	bb.restarts = bb.restarts[:0]
+	bb.counter = 0
+	bb.lastKey = bb.lastKey[:0]
+}
+
+// blockIter walks the entries of one decoded data block
+type blockIter struct {
+	data     []byte // entries only, restart array stripped
+	restarts []byte // NumRestarts x uint32
+	version  uint32 // format version of the table the block belongs to
+	offset   int    // offset of the next entry in data
+	key      []byte // current key, rebuilt from shared prefixes
+	e        entry
+	err      error
+}
+
+func newBlockIter(block []byte, version uint32) (*blockIter, error) {
+	if version == 1 {
+		return &blockIter{data: block, version: version}, nil
+	}
+	if len(block) < 4 {
+		return nil, errBadBlock
+	}
+	n := int(binary.LittleEndian.Uint32(block[len(block)-4:]))
+	if n == 0 || n > (len(block)-4)/4 {
+		return nil, errBadBlock
+	}
+	restartsStart := len(block) - 4 - 4*n
+	return &blockIter{
+		data:     block[:restartsStart],
+		restarts: block[restartsStart : len(block)-4],
+		version:  version,
+	}, nil
+}
+
+// next decodes the next entry into bi.e; false at the end of the block or on error (see bi.err)
+func (bi *blockIter) next() bool {
+	if bi.err != nil || bi.offset >= len(bi.data) {
+		return false
+	}
+	if bi.version == 1 {
+		return bi.nextLegacy()
+	}
+	isTombstone, shared, unshared, vLen, seq, expiresAt, p, ok := bi.decodeHeader(bi.offset)
+	if !ok || shared > uint64(len(bi.key)) || unshared+vLen > uint64(len(p)) {
+		return bi.fail()
+	}
+	bi.key = append(bi.key[:shared], p[:unshared]...)
+	bi.e = entry{key: string(bi.key), seq: seq, expiresAt: expiresAt, isTombstone: isTombstone}
+	if !isTombstone {
+		bi.e.value = p[unshared : unshared+vLen]
+	}
+	bi.offset = len(bi.data) - len(p) + int(unshared+vLen)
+	return true
+}
+
+// decodeHeader parses the fixed part of the prefix-compressed entry at off; rest starts at the key suffix
+func (bi *blockIter) decodeHeader(off int) (isTombstone bool, shared, unshared, vLen, seq uint64, expiresAt int64, rest []byte, ok bool) {
+	if off+1 > len(bi.data) {
+		return
+	}
+	header := bi.data[off]
+	isTombstone = header&flagTombstone != 0
+	p := bi.data[off+1:]
+	var n1, n2, n3, n4, n5 int
+	if shared, n1 = binary.Uvarint(p); n1 <= 0 {
+		return
+	}
+	if unshared, n2 = binary.Uvarint(p[n1:]); n2 <= 0 {
+		return
+	}
+	if vLen, n3 = binary.Uvarint(p[n1+n2:]); n3 <= 0 {
+		return
+	}
+	if seq, n4 = binary.Uvarint(p[n1+n2+n3:]); n4 <= 0 {
+		return
+	}
+	if header&flagExpiring != 0 {
+		var exp uint64
+		if exp, n5 = binary.Uvarint(p[n1+n2+n3+n4:]); n5 <= 0 {
+			return
+		}
+		expiresAt = int64(exp)
+	}
+	return isTombstone, shared, unshared, vLen, seq, expiresAt, p[n1+n2+n3+n4+n5:], true
+}
+
+// nextLegacy decodes a full-key entry of a version 1 table
+func (bi *blockIter) nextLegacy() bool {
+	p := bi.data[bi.offset:]
+	if len(p) < 7 {
+		return bi.fail()
+	}
+	e := entry{isTombstone: p[0] == 1}
+	// Lengths (Key=2, Val=4)
+	kLen := int(binary.LittleEndian.Uint16(p[1:3]))
+	vLen := int(binary.LittleEndian.Uint32(p[3:7]))
+	if e.isTombstone {
+		vLen = 0 // Tombstones have no val
+	}
+	if len(p)-7 < kLen+vLen {
+		return bi.fail()
+	}
+	e.key = string(p[7 : 7+kLen])
+	if !e.isTombstone {
+		e.value = p[7+kLen : 7+kLen+vLen]
+	}
+	bi.e = e
+	bi.offset += 7 + kLen + vLen
+	return true
+}
+
+func (bi *blockIter) fail() bool {
+	bi.err = errBadBlock
+	return false
+}
+
+// seek positions the iterator at the first entry with a key >= target and reports whether there is one.
+// Restart points hold full keys, so a binary search over them picks the interval to scan.
+func (bi *blockIter) seek(target string) bool {
+	bi.offset = 0
+	if bi.version != 1 {
+		n := len(bi.restarts) / 4
+		// first restart whose key is >= target; the one before it starts our interval,
+		// so we also land on the newest version when a key spans restart points
+		i := sort.Search(n, func(i int) bool {
+			return bi.restartKey(i) >= target
+		})
+		if bi.err != nil {
+			return false
+		}
+		if i > 0 {
+			bi.offset = bi.restartOffset(i - 1)
+		}
+		bi.key = bi.key[:0]
+	}
+	for bi.next() {
+		if bi.e.key >= target {
+			return true
+		}
+	}
+	return false
+}
+
+func (bi *blockIter) restartOffset(i int) int {
+	return int(binary.LittleEndian.Uint32(bi.restarts[4*i:]))
+}
+
+// restartKey decodes the full key stored at restart point i
+func (bi *blockIter) restartKey(i int) string {
+	_, shared, unshared, _, _, _, p, ok := bi.decodeHeader(bi.restartOffset(i))
+	if !ok || shared != 0 || uint64(len(p)) < unshared {
+		bi.err = errBadBlock
+		return ""
+	}
+	return string(p[:unshared])
+}
@@ -0,0 +1,151 @@
+package sstable
+
+import (
+	"fmt"
+	"testing"
+)
+
+func encodeBlock(entries []entry) []byte {
+	var bb blockBuilder
+	for _, e := range entries {
+		bb.add([]byte(e.key), e.value, e.seq, e.expiresAt, e.isTombstone)
+	}
+	return bb.finish()
+}
+
+func sameEntry(a, b entry) bool {
+	return a.key == b.key && string(a.value) == string(b.value) && a.seq == b.seq &&
+		a.expiresAt == b.expiresAt && a.isTombstone == b.isTombstone
+}
+
+// blockEntries has 100 keys sharing long prefixes, several of them with versions straddling restart points
+func blockEntries() []entry {
+	var entries []entry
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("user:%04d", i)
+		versions := 1
+		if i%10 == 3 {
+			versions = restartInterval + 3 // more versions than fit between two restarts
+		}
+		for v := versions; v > 0; v-- {
+			e := entry{key: key, value: []byte(fmt.Sprintf("%s/v%d", key, v)), seq: uint64(i*100 + v)}
+			switch {
+			case v == versions && i%7 == 0:
+				e.value, e.isTombstone = nil, true
+			case i%5 == 0:
+				e.expiresAt = 1700000000000000000 + int64(i)
+			}
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+func TestBlockRoundTrip(t *testing.T) {
+	entries := blockEntries()
+	bi, err := newBlockIter(encodeBlock(entries), formatVersion)
+	if err != nil {
+		t.Fatalf("newBlockIter: %v", err)
+	}
+	if n := len(bi.restarts) / 4; n != (len(entries)+restartInterval-1)/restartInterval {
+		t.Errorf("%d restart points for %d entries", n, len(entries))
+	}
+	for i, want := range entries {
+		if !bi.next() {
+			t.Fatalf("block ended after %d of %d entries, err %v", i, len(entries), bi.err)
+		}
+		if !sameEntry(bi.e, want) {
+			t.Fatalf("entry %d = %+v, want %+v", i, bi.e, want)
+		}
+	}
+	if bi.next() || bi.err != nil {
+		t.Errorf("entries past the end, err %v", bi.err)
+	}
+}
+
+// Every seek must land on the newest version of its key, even when the versions start before
+// the restart point the binary search picks
+func TestBlockSeek(t *testing.T) {
+	entries := blockEntries()
+	bi, err := newBlockIter(encodeBlock(entries), formatVersion)
+	if err != nil {
+		t.Fatalf("newBlockIter: %v", err)
+	}
+	for i, e := range entries {
+		if i > 0 && entries[i-1].key == e.key {
+			continue
+		}
+		if !bi.seek(e.key) || !sameEntry(bi.e, e) {
+			t.Fatalf("seek(%q) = %+v, want %+v", e.key, bi.e, e)
+		}
+		// Between keys: the next key's newest version
+		if i > 0 {
+			if !bi.seek(entries[i-1].key+"\x00") || !sameEntry(bi.e, e) {
+				t.Fatalf("seek after %q = %+v, want %+v", entries[i-1].key, bi.e, e)
+			}
+		}
+	}
+	if !bi.seek("") || !sameEntry(bi.e, entries[0]) {
+		t.Errorf("seek to the start = %+v", bi.e)
+	}
+	if bi.seek("zzz") {
+		t.Errorf("seek past the end found %+v", bi.e)
+	}
+}
+
+func TestBlockRejectsMalformed(t *testing.T) {
+	block := encodeBlock(blockEntries())
+	for _, bad := range [][]byte{
+		nil,
+		{0, 0, 0, 0},             // no restart points
+		{1, 2, 3, 0xff, 0, 0, 0}, // more restarts than bytes
+	} {
+		if _, err := newBlockIter(bad, formatVersion); err == nil {
+			t.Errorf("newBlockIter(%v) accepted a malformed block", bad)
+		}
+	}
+
+	// Cut the entries short but keep the restart array intact
+	restarts := block[len(block)-4-4*((len(blockEntries())+restartInterval-1)/restartInterval):]
+	truncated := append(append([]byte{}, block[:40]...), restarts...)
+	bi, err := newBlockIter(truncated, formatVersion)
+	if err != nil {
+		t.Fatalf("newBlockIter: %v", err)
+	}
+	for bi.next() {
+	}
+	if bi.err == nil {
+		t.Error("a truncated block decoded without error")
+	}
+}
+
+// A table spanning many blocks finds every version through the index, block and restart points
+func TestTableGetAt(t *testing.T) {
+	var entries []testEntry
+	for _, e := range blockEntries() {
+		entries = append(entries, testEntry{key: e.key, val: string(e.value), seq: e.seq, isTombstone: e.isTombstone})
+	}
+	for i := 0; i < 3000; i++ {
+		entries = append(entries, testEntry{key: fmt.Sprintf("z%05d", i), val: "filler value to span blocks", seq: uint64(i + 1)})
+	}
+	r, err := OpenSSTable(buildTable(t, entries))
+	if err != nil {
+		t.Fatalf("OpenSSTable: %v", err)
+	}
+	defer r.Close()
+	if len(r.index) < 3 {
+		t.Fatalf("table has %d blocks, the test needs several", len(r.index))
+	}
+
+	for _, e := range entries {
+		// Reading at the version's own seq returns exactly it, even with newer versions in the table
+		val, seq, _, isTombstone, found, err := r.GetAt(e.key, e.seq)
+		if err != nil || !found || seq != e.seq || val != e.val || isTombstone != e.isTombstone {
+			t.Fatalf("GetAt(%q, %d) = %q seq=%d tombstone=%v found=%v err=%v", e.key, e.seq, val, seq, isTombstone, found, err)
+		}
+	}
+	// Before its oldest version the key did not exist yet
+	if _, _, _, _, found, err := r.GetAt("user:0003", 300); found || err != nil {
+		t.Errorf("GetAt before the first version = found=%v err=%v", found, err)
+	}
+}
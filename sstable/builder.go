@@ -2,6 +2,7 @@ package sstable
 
 import (
 	"KV-Store/pkg/bloom"
+	"bytes"
 	"encoding/binary"
 	"os"
 )
@@ -18,11 +19,29 @@ type Builder struct {
 	File          *os.File
 	index         []IndexEntry
 	filter        *bloom.BloomFilter
-	currentOffset int64
-	blockStart    int64
+	currentOffset int64        // file offset where the current block starts
+	block         blockBuilder // entries of the block being built
+	codec         Codec
+	stats         CompressionStats
+	count         int
+	smallest      string
+	largest       []byte
+	minSeq        uint64
+	maxSeq        uint64
+}
+
+// CompressionStats counts data block bytes before and after compression
+type CompressionStats struct {
+	RawBytes    int64
+	StoredBytes int64
 }
 
 func NewBuilder(filename string, keyCount int) (*Builder, error) {
+	return NewCompressedBuilder(filename, keyCount, CodecNone)
+}
+
+// NewCompressedBuilder creates a builder that compresses every data block with codec
+func NewCompressedBuilder(filename string, keyCount int, codec Codec) (*Builder, error) {
 	f, err := os.Create(filename)
 	if err != nil {
 		return nil, err
@@ -33,73 +52,104 @@ func NewBuilder(filename string, keyCount int) (*Builder, error) {
 		File:          f,
 		filter:        bf,
 		currentOffset: 0,
-		blockStart:    0,
+		codec:         codec,
 	}, nil
 }
 
-func (b *Builder) Add(key []byte, val []byte, isTombstone bool) error {
+// Add appends an entry written at sequence number seq that expires at expiresAt (unix nanoseconds, 0 = never).
+// Keys must arrive in increasing order, several versions of one key newest first.
+func (b *Builder) Add(key []byte, val []byte, seq uint64, expiresAt int64, isTombstone bool) error {
 	//Sparse Index: logic
+	sameKey := b.count > 0 && bytes.Equal(key, b.largest)
 	b.filter.Add(key)
-	if b.currentOffset == 0 || (b.currentOffset-b.blockStart) > blockSize {
+	if b.count == 0 {
+		b.smallest = string(key)
+		b.minSeq = seq
+	}
+	b.minSeq = min(b.minSeq, seq)
+	b.maxSeq = max(b.maxSeq, seq)
+	b.largest = append(b.largest[:0], key...)
+	b.count++
+	// All versions of a key share a block, so the index still finds the newest one
+	if b.block.size() > blockSize && !sameKey {
+		if err := b.finishBlock(); err != nil {
+			return err
+		}
+	}
+	if b.block.empty() {
 		b.index = append(b.index, IndexEntry{
 			key:    string(key),
 			Offset: b.currentOffset,
 		})
-		b.blockStart = b.currentOffset
-	}
-	header := byte(0)
-	if isTombstone {
-		header = 1
-	}
-	if _, err := b.File.Write([]byte{header}); err != nil {
-		return err
 	}
-	var lenBuf [6]byte
-	binary.LittleEndian.PutUint16(lenBuf[0:2], uint16(len(key)))
-	valLen := len(val)
-	if isTombstone {
-		valLen = 0 // Tombstones have no val
+	b.block.add(key, val, seq, expiresAt, isTombstone)
+	return nil
+}
+
+// finishBlock compresses the current block and writes it followed by its trailer
+func (b *Builder) finishBlock() error {
+	if b.block.empty() {
+		return nil
 	}
-	binary.LittleEndian.PutUint32(lenBuf[2:6], uint32(valLen))
-	if _, err := b.File.Write(lenBuf[:]); err != nil {
+	raw := b.block.finish()
+	stored, codec := compressBlock(b.codec, raw)
+	var trailer [trailerSize]byte
+	trailer[0] = byte(codec)
+	binary.LittleEndian.PutUint32(trailer[1:], blockChecksum(stored, codec))
+	if _, err := b.File.Write(stored); err != nil {
 		return err
 	}
-	if _, err := b.File.Write(key); err != nil {
+	if _, err := b.File.Write(trailer[:]); err != nil {
 		return err
 	}
-	if !isTombstone {
-		if _, err := b.File.Write(val); err != nil {
-			return err
-		}
-	}
-	// Size = Header(1) + KeyLen(2) + ValLen(4) + KeyBytes + ValBytes
-	entrySize := int64(1 + 2 + 4 + len(key) + valLen)
-	b.currentOffset += entrySize
-
+	b.stats.RawBytes += int64(len(raw))
+	b.stats.StoredBytes += int64(len(stored))
+	b.currentOffset += int64(len(stored) + trailerSize)
+	b.block.reset()
 	return nil
 }
 
+// EstimatedSize is the number of bytes written so far plus the raw size of the pending block;
+// after Close it is the size of the file
+func (b *Builder) EstimatedSize() int64 {
+	return b.currentOffset + int64(b.block.size())
+}
+
+// KeyRange returns the smallest and largest key added so far
+func (b *Builder) KeyRange() (string, string) {
+	return b.smallest, string(b.largest)
+}
+
+// SeqRange returns the lowest and highest sequence number added so far
+func (b *Builder) SeqRange() (uint64, uint64) {
+	return b.minSeq, b.maxSeq
+}
+
+// Stats reports how well the data blocks written so far compressed
+func (b *Builder) Stats() CompressionStats {
+	return b.stats
+}
+
 func (b *Builder) Close() error {
+	if err := b.finishBlock(); err != nil {
+		return err
+	}
 	indexStartOffset := b.currentOffset // end of the last block is the start of the index entries
 	// Format for each entry: [KeyLen(2)][KeyBytes][Offset(8)]
+	var indexBytes []byte
 	var buf [10]byte // Reusable buffer for lengths and offset
 	for _, entry := range b.index {
 		binary.LittleEndian.PutUint16(buf[0:2], uint16(len(entry.key)))
-		if _, err := b.File.Write(buf[0:2]); err != nil {
-			return err
-		}
-
-		if _, err := b.File.WriteString(entry.key); err != nil {
-			return err
-		}
-
+		indexBytes = append(indexBytes, buf[0:2]...)
+		indexBytes = append(indexBytes, entry.key...)
 		binary.LittleEndian.PutUint64(buf[2:10], uint64(entry.Offset))
-		if _, err := b.File.Write(buf[2:10]); err != nil {
-			return err
-		}
-		entrySize := int64(2 + len(entry.key) + 8)
-		b.currentOffset += entrySize
+		indexBytes = append(indexBytes, buf[2:10]...)
+	}
+	if _, err := b.File.Write(indexBytes); err != nil {
+		return err
 	}
+	b.currentOffset += int64(len(indexBytes))
+
 	filterStartOffset := b.currentOffset // This is where the filter begins
 	filterBytes := b.filter.Bytes()
 	if _, err := b.File.Write(filterBytes); err != nil {
@@ -108,14 +158,16 @@ func (b *Builder) Close() error {
 	b.currentOffset += int64(len(filterBytes))
 
 	//Write the footer
-	// [Index Offset (8 bytes)] + [Filter Offset (8 bytes)]
-	var footer [16]byte
-	binary.LittleEndian.PutUint64(footer[0:8], uint64(indexStartOffset))
-	binary.LittleEndian.PutUint64(footer[8:16], uint64(filterStartOffset))
-
-	if _, err := b.File.Write(footer[:]); err != nil {
+	footerBytes := encodeFooter(footer{
+		indexOffset:  indexStartOffset,
+		filterOffset: filterStartOffset,
+		indexCRC:     checksum(indexBytes),
+		filterCRC:    checksum(filterBytes),
+	})
+	if _, err := b.File.Write(footerBytes); err != nil {
 		return err
 	}
+	b.currentOffset += int64(len(footerBytes))
 
 	if err := b.File.Sync(); err != nil {
 		return err
@@ -0,0 +1,85 @@
+package sstable
+
+import (
+	"KV-Store/pkg/metrics"
+	"container/list"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// blockKey identifies a data block: the reader that owns it and the block's file offset
+type blockKey struct {
+	table  uint64
+	offset int64
+}
+
+type cacheEntry struct {
+	key   blockKey
+	block []byte
+}
+
+// BlockCache is an LRU cache of raw data blocks shared by every Reader of a store.
+// It holds at most capacity bytes of block data; blocks of deleted tables are never
+// looked up again and simply age out.
+type BlockCache struct {
+	mu       sync.Mutex
+	capacity int64
+	size     int64
+	lru      *list.List // front = most recently used
+	entries  map[blockKey]*list.Element
+
+	hits   prometheus.Counter
+	misses prometheus.Counter
+	bytes  prometheus.Gauge
+}
+
+// NewBlockCache creates a cache holding up to capacity bytes, reporting metrics under nodeID.
+// A capacity <= 0 disables caching.
+func NewBlockCache(capacity int64, nodeID string) *BlockCache {
+	return &BlockCache{
+		capacity: capacity,
+		lru:      list.New(),
+		entries:  make(map[blockKey]*list.Element),
+		hits:     metrics.BlockCacheHits.WithLabelValues(nodeID),
+		misses:   metrics.BlockCacheMisses.WithLabelValues(nodeID),
+		bytes:    metrics.BlockCacheBytes.WithLabelValues(nodeID),
+	}
+}
+
+// get returns the cached block and marks it as recently used
+func (c *BlockCache) get(key blockKey) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(e)
+		c.hits.Inc()
+		return e.Value.(*cacheEntry).block, true
+	}
+	c.misses.Inc()
+	return nil, false
+}
+
+// put caches block, evicting the least recently used blocks to stay within capacity.
+// Blocks larger than the whole cache are not cached.
+func (c *BlockCache) put(key blockKey, block []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if int64(len(block)) > c.capacity {
+		return
+	}
+	if e, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, block: block})
+	c.size += int64(len(block))
+	for c.size > c.capacity {
+		last := c.lru.Back()
+		entry := last.Value.(*cacheEntry)
+		c.lru.Remove(last)
+		delete(c.entries, entry.key)
+		c.size -= int64(len(entry.block))
+	}
+	c.bytes.Set(float64(c.size))
+}
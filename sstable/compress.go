@@ -0,0 +1,97 @@
+package sstable
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Codec is the compression applied to a data block, recorded in the block trailer
+type Codec byte
+
+const (
+	CodecNone  Codec = 0
+	CodecFlate Codec = 1 // DEFLATE at BestSpeed, pure Go
+)
+
+// minSavings: a compressed block is only kept if it is at least 1/8 smaller than the raw one
+const minSavings = 8
+
+func (c Codec) String() string {
+	switch c {
+	case CodecNone:
+		return "none"
+	case CodecFlate:
+		return "flate"
+	}
+	return fmt.Sprintf("codec(%d)", byte(c))
+}
+
+// ParseCodec maps a codec name ("none", "flate") to its Codec
+func ParseCodec(name string) (Codec, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "none", "":
+		return CodecNone, nil
+	case "flate":
+		return CodecFlate, nil
+	}
+	return CodecNone, fmt.Errorf("unknown compression codec %q", name)
+}
+
+var flateWriters = sync.Pool{
+	New: func() any {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	},
+}
+
+// compressBlock encodes block with codec. Blocks that do not shrink enough are stored raw,
+// so the returned codec is the one actually used.
+// Compressed layout: [RawLen(uvarint)][compressed bytes]
+func compressBlock(codec Codec, block []byte) ([]byte, Codec) {
+	if codec != CodecFlate {
+		return block, CodecNone
+	}
+	var buf bytes.Buffer
+	var lenBuf [binary.MaxVarintLen64]byte
+	buf.Write(lenBuf[:binary.PutUvarint(lenBuf[:], uint64(len(block)))])
+
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+	w.Reset(&buf)
+	if _, err := w.Write(block); err != nil {
+		return block, CodecNone
+	}
+	if err := w.Close(); err != nil {
+		return block, CodecNone
+	}
+	if buf.Len() > len(block)-len(block)/minSavings {
+		return block, CodecNone
+	}
+	return buf.Bytes(), CodecFlate
+}
+
+// decompressBlock reverses compressBlock
+func decompressBlock(codec Codec, data []byte) ([]byte, error) {
+	switch codec {
+	case CodecNone:
+		return data, nil
+	case CodecFlate:
+		rawLen, n := binary.Uvarint(data)
+		if n <= 0 || rawLen > 1<<31 {
+			return nil, fmt.Errorf("bad compressed block header")
+		}
+		block := make([]byte, rawLen)
+		r := flate.NewReader(bytes.NewReader(data[n:]))
+		defer r.Close()
+		if _, err := io.ReadFull(r, block); err != nil {
+			return nil, fmt.Errorf("decompress: %v", err)
+		}
+		return block, nil
+	}
+	return nil, fmt.Errorf("unknown compression codec %d", byte(codec))
+}
@@ -0,0 +1,147 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+/*
+	SSTable layout (format version 2):
+	[Block 0][Trailer] ... [Block N][Trailer]   data blocks, each followed by a trailer
+	[Index]                                     [KeyLen(2)][KeyBytes][Offset(8)] per block
+	[Filter]                                    bloom filter
+	[Footer]                                    see below
+
+	Block:         prefix-compressed entries and restart points, see block.go.
+	               A key may appear several times, newest version first; all versions of a key share a block.
+	Block trailer: [Codec(1)][CRC32C(4)], the CRC covers the stored (compressed) block and the codec byte
+	Footer (40 bytes):
+	[IndexOffset(8)][FilterOffset(8)][IndexCRC(4)][FilterCRC(4)][Version(4)][FooterCRC(4)][Magic(8)]
+	FooterCRC covers the 28 bytes before it.
+
+	Version 1 tables, written before checksums, are still readable: they have no magic and end with
+	[IndexOffset(8)][FilterOffset(8)], their blocks hold full-key entries without sequence numbers
+	and carry no trailer.
+*/
+
+const (
+	formatVersion = 2
+	tableMagic    = 0x5355485059534953 // "SISYPHUS" in little endian
+
+	footerSize   = 40
+	v1FooterSize = 16
+	trailerSize  = 5
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+func checksum(b []byte) uint32 {
+	return crc32.Checksum(b, castagnoli)
+}
+
+// blockChecksum covers a stored block and the codec byte that follows it in the trailer
+func blockChecksum(stored []byte, codec Codec) uint32 {
+	crc := crc32.Update(0, castagnoli, stored)
+	return crc32.Update(crc, castagnoli, []byte{byte(codec)})
+}
+
+// CorruptionError reports an SSTable whose bytes fail validation. A reader that hits one
+// is quarantined: it keeps returning the error for its key range instead of serving data from the file.
+type CorruptionError struct {
+	File   string
+	Offset int64 // where the bad region starts, -1 if unknown
+	Reason string
+}
+
+func (e *CorruptionError) Error() string {
+	if e.Offset < 0 {
+		return fmt.Sprintf("sstable %s is corrupt: %s", e.File, e.Reason)
+	}
+	return fmt.Sprintf("sstable %s is corrupt at offset %d: %s", e.File, e.Offset, e.Reason)
+}
+
+func corruption(file string, offset int64, format string, args ...any) *CorruptionError {
+	return &CorruptionError{File: file, Offset: offset, Reason: fmt.Sprintf(format, args...)}
+}
+
+type footer struct {
+	version      uint32
+	indexOffset  int64
+	filterOffset int64
+	filterEnd    int64 // the footer starts here
+	indexCRC     uint32
+	filterCRC    uint32
+}
+
+func encodeFooter(f footer) []byte {
+	buf := make([]byte, footerSize)
+	binary.LittleEndian.PutUint64(buf[0:8], uint64(f.indexOffset))
+	binary.LittleEndian.PutUint64(buf[8:16], uint64(f.filterOffset))
+	binary.LittleEndian.PutUint32(buf[16:20], f.indexCRC)
+	binary.LittleEndian.PutUint32(buf[20:24], f.filterCRC)
+	binary.LittleEndian.PutUint32(buf[24:28], formatVersion)
+	binary.LittleEndian.PutUint32(buf[28:32], checksum(buf[0:28]))
+	binary.LittleEndian.PutUint64(buf[32:40], tableMagic)
+	return buf
+}
+
+// readFooter decodes the footer of a table of the given size, detecting the format version
+func readFooter(r interface {
+	ReadAt([]byte, int64) (int, error)
+}, filename string, size int64) (footer, error) {
+	var f footer
+	if size < v1FooterSize {
+		return f, corruption(filename, -1, "file too small (%d bytes)", size)
+	}
+	var magic [8]byte
+	if _, err := r.ReadAt(magic[:], size-8); err != nil {
+		return f, err
+	}
+
+	if binary.LittleEndian.Uint64(magic[:]) != tableMagic {
+		// Version 1: no magic, no checksums
+		var buf [v1FooterSize]byte
+		if _, err := r.ReadAt(buf[:], size-v1FooterSize); err != nil {
+			return f, err
+		}
+		f.version = 1
+		f.indexOffset = int64(binary.LittleEndian.Uint64(buf[0:8]))
+		f.filterOffset = int64(binary.LittleEndian.Uint64(buf[8:16]))
+		f.filterEnd = size - v1FooterSize
+	} else {
+		if size < footerSize {
+			return f, corruption(filename, -1, "file too small (%d bytes)", size)
+		}
+		buf := make([]byte, footerSize)
+		if _, err := r.ReadAt(buf, size-footerSize); err != nil {
+			return f, err
+		}
+		if checksum(buf[0:28]) != binary.LittleEndian.Uint32(buf[28:32]) {
+			return f, corruption(filename, size-footerSize, "footer checksum mismatch")
+		}
+		f.version = binary.LittleEndian.Uint32(buf[24:28])
+		if f.version != formatVersion {
+			return f, fmt.Errorf("sstable %s: unsupported format version %d", filename, f.version)
+		}
+		f.indexOffset = int64(binary.LittleEndian.Uint64(buf[0:8]))
+		f.filterOffset = int64(binary.LittleEndian.Uint64(buf[8:16]))
+		f.indexCRC = binary.LittleEndian.Uint32(buf[16:20])
+		f.filterCRC = binary.LittleEndian.Uint32(buf[20:24])
+		f.filterEnd = size - footerSize
+	}
+	if f.indexOffset < 0 || f.indexOffset > f.filterOffset || f.filterOffset > f.filterEnd {
+		return f, corruption(filename, -1, "footer offsets out of range (index %d, filter %d, size %d)",
+			f.indexOffset, f.filterOffset, size)
+	}
+	return f, nil
+}
+
+// entry is one decoded block entry
+type entry struct {
+	key         string
+	value       []byte
+	seq         uint64
+	expiresAt   int64 // unix nanoseconds, 0 = never
+	isTombstone bool
+}
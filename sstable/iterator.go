@@ -1,19 +1,21 @@
 package sstable
 
 import (
-	"encoding/binary"
-	"io"
-	"os"
+	"sort"
 )
 
-// SSTableIterator reads an SSTable sequentially
+// SSTableIterator reads an SSTable sequentially, one verified block at a time
 type SSTableIterator struct {
-	file     *os.File
-	fileSize int64
+	r        *Reader    // the iterator holds a reference until Close
+	blockIdx int        // index of the block being read
+	block    *blockIter // entries of the current block, nil before the first
 
-	// Current Entry State (The "Head" of the stream)
+	// Current Entry State (The "Head" of the stream).
+	// Value may share memory with the block cache and must not be modified.
 	Key         string
 	Value       []byte
+	Seq         uint64 // sequence number of the write, 0 in tables written before sequence numbers
+	ExpiresAt   int64  // unix nanoseconds after which the value is gone, 0 = never
 	IsTombstone bool
 
 	// Internal State
@@ -23,69 +25,83 @@ type SSTableIterator struct {
 
 // NewIterator opens a file and prepares to read the first key
 func NewIterator(filename string) (*SSTableIterator, error) {
-	f, err := os.Open(filename)
+	r, err := OpenSSTable(filename)
 	if err != nil {
 		return nil, err
 	}
-	stat, _ := f.Stat()
-
-	it := &SSTableIterator{
-		file:     f,
-		fileSize: stat.Size(),
-		Valid:    true,
-	}
+	// The iterator takes over the opener's reference
+	it := &SSTableIterator{r: r, blockIdx: -1, Valid: true}
 	// Prime the first key immediately so 'it.Key' is ready to use
 	it.Next()
 	return it, nil
 }
 
-// Next reads the next entry in the file
-func (it *SSTableIterator) Next() {
-	if !it.Valid {
-		return
+// NewIteratorAt opens an iterator positioned at the first key >= start.
+// The sparse index lets us jump straight to the block that may hold start.
+func (r *Reader) NewIteratorAt(start string) (*SSTableIterator, error) {
+	r.Ref()
+	if start > r.largest {
+		return &SSTableIterator{r: r}, nil
 	}
-
-	// Read Header (1 byte)
-	var header [1]byte
-	if _, err := it.file.Read(header[:]); err != nil {
-		it.Valid = false
-		if err != io.EOF {
-			it.err = err
-		}
-		return
+	if err := r.quarantined.Load(); err != nil {
+		return &SSTableIterator{r: r, err: err}, nil
 	}
-	it.IsTombstone = header[0] == 1
-
-	// read lengths (KeyLen=2, ValLen=4)
-	var lenBuf [6]byte
-	if _, err := it.file.Read(lenBuf[:]); err != nil {
-		it.Valid = false
-		return
+	idx := sort.Search(len(r.index), func(i int) bool {
+		return r.index[i].key > start
+	})
+	// Next moves on to the block before idx, the first that may hold start
+	it := &SSTableIterator{r: r, blockIdx: max(idx-1, 0) - 1, Valid: true}
+	it.Next()
+	for it.Valid && it.Key < start {
+		it.Next()
 	}
-	kLen := binary.LittleEndian.Uint16(lenBuf[0:2])
-	vLen := binary.LittleEndian.Uint32(lenBuf[2:6])
+	return it, nil
+}
 
-	// Read Key
-	keyBytes := make([]byte, kLen)
-	if _, err := it.file.Read(keyBytes); err != nil {
-		it.Valid = false
+// Next reads the next entry, moving on to the next block when the current one is used up
+func (it *SSTableIterator) Next() {
+	if !it.Valid {
 		return
 	}
-	it.Key = string(keyBytes)
-
-	// 4. read value
-	if it.IsTombstone {
-		it.Value = nil
-	} else {
-		valBytes := make([]byte, vLen)
-		if _, err := it.file.Read(valBytes); err != nil {
+	for it.block == nil || !it.block.next() {
+		if it.block != nil && it.block.err != nil {
+			it.fail(it.r.quarantine(corruption(it.r.filename, it.r.index[it.blockIdx].Offset, "%v", it.block.err)))
+			return
+		}
+		it.blockIdx++
+		// Index, bloom filter and footer follow the data blocks
+		if it.blockIdx >= len(it.r.index) {
 			it.Valid = false
 			return
 		}
-		it.Value = valBytes
+		block, err := it.r.readBlock(it.blockIdx)
+		if err != nil {
+			it.fail(err)
+			return
+		}
+		it.block, err = newBlockIter(block, it.r.version)
+		if err != nil {
+			it.fail(it.r.quarantine(corruption(it.r.filename, it.r.index[it.blockIdx].Offset, "%v", err)))
+			return
+		}
 	}
+	it.Key = it.block.e.key
+	it.Value = it.block.e.value
+	it.Seq = it.block.e.seq
+	it.ExpiresAt = it.block.e.expiresAt
+	it.IsTombstone = it.block.e.isTombstone
+}
+
+func (it *SSTableIterator) fail(err error) {
+	it.Valid = false
+	it.err = err
+}
+
+// Err returns the error that stopped the iterator early, nil if it simply ran out of entries
+func (it *SSTableIterator) Err() error {
+	return it.err
 }
 
 func (it *SSTableIterator) Close() {
-	_ = it.file.Close()
+	_ = it.r.Close()
 }
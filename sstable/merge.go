@@ -0,0 +1,196 @@
+package sstable
+
+import (
+	"container/heap"
+	"math"
+)
+
+// Source is one sorted input of a MergingIterator: an SSTable, a memtable, ...
+type Source interface {
+	Valid() bool
+	Key() string
+	Value() []byte
+	Seq() uint64      // sequence number of the write, higher is newer
+	ExpiresAt() int64 // unix nanoseconds after which the value is gone, 0 = never
+	IsTombstone() bool
+	Next()
+	Err() error // why the source stopped early, nil at a clean end
+	Close()
+}
+
+// MergingIterator merges sorted sources into a single sorted stream with a min-heap.
+// Each source yields keys in order and the versions of a key newest first.
+// When several versions of a key exist only the one with the highest sequence number
+// is surfaced; equal sequence numbers (tables written before them all read as 0) go to the
+// source given first, so sources are still passed newest first. Tombstones are surfaced too
+// so callers can drop or keep them.
+type MergingIterator struct {
+	sources     []Source
+	heap        mergeHeap
+	readSeq     uint64 // versions written after readSeq are hidden
+	allVersions bool   // surface every version instead of the newest per key
+
+	key         string
+	value       []byte
+	seq         uint64
+	expiresAt   int64
+	isTombstone bool
+	valid       bool
+}
+
+func NewMergingIterator(sources []Source) *MergingIterator {
+	return newMergingIterator(sources, math.MaxUint64, false)
+}
+
+// NewMergingIteratorAt reads the sources as of readSeq: every key surfaces its newest version
+// written at or before readSeq
+func NewMergingIteratorAt(sources []Source, readSeq uint64) *MergingIterator {
+	return newMergingIterator(sources, readSeq, false)
+}
+
+// NewVersionIterator surfaces every version of every key, newest first within a key,
+// so compaction can decide which ones to keep
+func NewVersionIterator(sources []Source) *MergingIterator {
+	return newMergingIterator(sources, math.MaxUint64, true)
+}
+
+func newMergingIterator(sources []Source, readSeq uint64, allVersions bool) *MergingIterator {
+	m := &MergingIterator{sources: sources, readSeq: readSeq, allVersions: allVersions}
+	for i, src := range sources {
+		if src.Valid() {
+			m.heap.items = append(m.heap.items, heapItem{key: src.Key(), seq: src.Seq(), source: i})
+		}
+	}
+	heap.Init(&m.heap)
+	m.load()
+	return m
+}
+
+func (m *MergingIterator) Valid() bool       { return m.valid }
+func (m *MergingIterator) Key() string       { return m.key }
+func (m *MergingIterator) Value() []byte     { return m.value }
+func (m *MergingIterator) Seq() uint64       { return m.seq }
+func (m *MergingIterator) ExpiresAt() int64  { return m.expiresAt }
+func (m *MergingIterator) IsTombstone() bool { return m.isTombstone }
+
+// Next moves past the current key, skipping its older versions in every source.
+// A version iterator moves to the next version instead.
+func (m *MergingIterator) Next() {
+	if !m.valid {
+		return
+	}
+	if m.allVersions {
+		m.advance()
+	} else {
+		for m.heap.Len() > 0 && m.heap.items[0].key == m.key {
+			m.advance()
+		}
+	}
+	m.load()
+}
+
+// advance moves the source at the top of the heap to its next entry
+func (m *MergingIterator) advance() {
+	top := &m.heap.items[0]
+	src := m.sources[top.source]
+	src.Next()
+	if src.Valid() {
+		top.key, top.seq = src.Key(), src.Seq()
+		heap.Fix(&m.heap, 0)
+	} else {
+		heap.Pop(&m.heap)
+	}
+}
+
+// Err returns the first error a source stopped on. A merge that ends with an error is incomplete.
+func (m *MergingIterator) Err() error {
+	for _, src := range m.sources {
+		if err := src.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes every source; calling it again is a no-op
+func (m *MergingIterator) Close() {
+	for _, src := range m.sources {
+		src.Close()
+	}
+	m.sources = nil
+	m.heap.items = nil
+	m.valid = false
+}
+
+// load copies the entry at the top of the heap: the newest visible version of the smallest key
+func (m *MergingIterator) load() {
+	for m.heap.Len() > 0 && m.heap.items[0].seq > m.readSeq {
+		m.advance()
+	}
+	if m.heap.Len() == 0 {
+		m.valid = false
+		return
+	}
+	src := m.sources[m.heap.items[0].source]
+	m.key = m.heap.items[0].key
+	m.value = src.Value()
+	m.seq = m.heap.items[0].seq
+	m.expiresAt = src.ExpiresAt()
+	m.isTombstone = src.IsTombstone()
+	m.valid = true
+}
+
+// heapItem caches a source's current key and sequence number so heap comparisons avoid interface calls
+type heapItem struct {
+	key    string
+	seq    uint64
+	source int
+}
+
+// mergeHeap orders sources by current key, then by sequence number descending, then by index
+type mergeHeap struct {
+	items []heapItem
+}
+
+func (h *mergeHeap) Len() int { return len(h.items) }
+
+func (h *mergeHeap) Less(a, b int) bool {
+	x, y := h.items[a], h.items[b]
+	if x.key != y.key {
+		return x.key < y.key
+	}
+	if x.seq != y.seq {
+		return x.seq > y.seq
+	}
+	return x.source < y.source
+}
+
+func (h *mergeHeap) Swap(a, b int) { h.items[a], h.items[b] = h.items[b], h.items[a] }
+
+func (h *mergeHeap) Push(x any) { h.items = append(h.items, x.(heapItem)) }
+
+func (h *mergeHeap) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
+
+// iteratorSource adapts SSTableIterator, whose state lives in exported fields, to Source
+type iteratorSource struct {
+	it *SSTableIterator
+}
+
+// AsSource lets an SSTableIterator feed a MergingIterator
+func (it *SSTableIterator) AsSource() Source {
+	return iteratorSource{it: it}
+}
+
+func (s iteratorSource) Valid() bool       { return s.it.Valid }
+func (s iteratorSource) Key() string       { return s.it.Key }
+func (s iteratorSource) Value() []byte     { return s.it.Value }
+func (s iteratorSource) Seq() uint64       { return s.it.Seq }
+func (s iteratorSource) ExpiresAt() int64  { return s.it.ExpiresAt }
+func (s iteratorSource) IsTombstone() bool { return s.it.IsTombstone }
+func (s iteratorSource) Next()             { s.it.Next() }
+func (s iteratorSource) Err() error        { return s.it.Err() }
+func (s iteratorSource) Close()            { s.it.Close() }
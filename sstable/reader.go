@@ -6,75 +6,105 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"io"
+	"math"
 	"os"
 	"sort"
+	"sync/atomic"
 )
 
+// nextTableID hands every opened Reader a unique id for block cache keys
+var nextTableID atomic.Uint64
+
+// Reader serves point lookups from one SSTable. It is safe for concurrent use and is
+// reference counted: the opener holds the first reference, Ref adds one and Close drops one.
+// The file is closed when the last reference goes away.
 type Reader struct {
 	file     *os.File
 	index    []IndexEntry // Sparse Index
 	filter   *bloom.BloomFilter
 	filename string
+	version  uint32
+	dataEnd  int64 // data blocks end where the index starts
+	size     int64
+	smallest string // key range, both empty for a table without entries
+	largest  string
+
+	id          uint64
+	refs        atomic.Int32
+	cache       *BlockCache // nil = read every block from disk
+	quarantined atomic.Pointer[CorruptionError]
 }
 
 func OpenSSTable(filename string) (*Reader, error) {
+	return OpenCachedSSTable(filename, nil)
+}
+
+// OpenCachedSSTable opens an SSTable whose data blocks are read through cache.
+// A table that fails validation returns a *CorruptionError.
+func OpenCachedSSTable(filename string, cache *BlockCache) (*Reader, error) {
 	f, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
-
-	// Read Footer
-	stat, _ := f.Stat()
-	if stat.Size() < 16 { // Changed from 8 to 16
-		return nil, errors.New("invalid ssTable: too small")
+	r, err := openReader(f, filename, cache)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
 	}
+	return r, nil
+}
 
-	// Seek to End - 16 bytes
-	_, err = f.Seek(-16, io.SeekEnd)
+func openReader(f *os.File, filename string, cache *BlockCache) (*Reader, error) {
+	stat, err := f.Stat()
 	if err != nil {
 		return nil, err
 	}
-
-	var footer [16]byte
-	if _, err := f.Read(footer[:]); err != nil {
+	ft, err := readFooter(f, filename, stat.Size())
+	if err != nil {
 		return nil, err
 	}
 
-	indexOffset := int64(binary.LittleEndian.Uint64(footer[:]))
-	filterOffset := int64(binary.LittleEndian.Uint64(footer[8:16])) //bloom filter
 	// Jump to Index and Read it
-	if _, err := f.Seek(indexOffset, io.SeekStart); err != nil {
+	indexBytes := make([]byte, ft.filterOffset-ft.indexOffset)
+	if _, err := f.ReadAt(indexBytes, ft.indexOffset); err != nil {
 		return nil, err
 	}
-
-	indexSize := filterOffset - indexOffset
-	indexBytes := make([]byte, indexSize)
-	if _, err := f.Read(indexBytes); err != nil {
+	filterBytes := make([]byte, ft.filterEnd-ft.filterOffset)
+	if _, err := f.ReadAt(filterBytes, ft.filterOffset); err != nil {
 		return nil, err
 	}
+	if ft.version != 1 {
+		if checksum(indexBytes) != ft.indexCRC {
+			return nil, corruption(filename, ft.indexOffset, "index checksum mismatch")
+		}
+		if checksum(filterBytes) != ft.filterCRC {
+			return nil, corruption(filename, ft.filterOffset, "filter checksum mismatch")
+		}
+	}
 
 	//  Parse Bytes -> []IndexEntry Slice
 	var index []IndexEntry
 	buf := bytes.NewReader(indexBytes)
 
-	// IndexEntry format:
-	//Size = Header(1) + KeyLen(2) + ValLen(4) + KeyBytes + ValBytes
+	// IndexEntry format: [KeyLen(2)][KeyBytes][Offset(8)]
 	for buf.Len() > 0 {
 		var kLen uint16
 		if err := binary.Read(buf, binary.LittleEndian, &kLen); err != nil {
-			break
+			return nil, corruption(filename, ft.indexOffset, "truncated index")
 		}
 
 		keyBytes := make([]byte, kLen)
 		if _, err := buf.Read(keyBytes); err != nil {
-			break
+			return nil, corruption(filename, ft.indexOffset, "truncated index")
 		}
 
 		// Read Offset (8 bytes)
 		var offset int64
 		if err := binary.Read(buf, binary.LittleEndian, &offset); err != nil {
-			break
+			return nil, corruption(filename, ft.indexOffset, "truncated index")
+		}
+		if offset < 0 || offset >= ft.indexOffset || (len(index) > 0 && offset <= index[len(index)-1].Offset) {
+			return nil, corruption(filename, ft.indexOffset, "index points outside the data blocks")
 		}
 
 		index = append(index, IndexEntry{
@@ -82,32 +112,80 @@ func OpenSSTable(filename string) (*Reader, error) {
 			Offset: offset,
 		})
 	}
-	filterSize := stat.Size() - filterOffset - 16
-	filterBytes := make([]byte, filterSize)
-
-	// Seek to Filter Start
-	if _, err := f.Seek(filterOffset, io.SeekStart); err != nil {
-		return nil, err
-	}
-	if _, err := f.Read(filterBytes); err != nil {
-		return nil, err
-	}
 	// Load Filter
 	bf := bloom.Load(filterBytes)
 
-	return &Reader{
+	r := &Reader{
 		file:     f,
 		index:    index,
 		filename: filename,
 		filter:   bf,
-	}, nil
+		version:  ft.version,
+		dataEnd:  ft.indexOffset,
+		size:     stat.Size(),
+		id:       nextTableID.Add(1),
+		cache:    cache,
+	}
+	r.refs.Store(1)
+	if len(index) > 0 {
+		r.smallest = index[0].key
+		if r.largest, err = r.lastKey(); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// NewQuarantinedReader stands in for a table that cannot be opened because it is corrupt.
+// It covers the key range [smallest, largest] recorded for the table and fails every read of it with err,
+// so newer data is never shadowed by older tables answering in its place.
+func NewQuarantinedReader(filename, smallest, largest string, err *CorruptionError) *Reader {
+	r := &Reader{filename: filename, smallest: smallest, largest: largest, id: nextTableID.Add(1)}
+	r.refs.Store(1)
+	r.quarantined.Store(err)
+	return r
 }
 
-func (r *Reader) Get(targetKey string) (string, bool, bool, error) {
+// lastKey decodes the final block to find the largest key in the table
+func (r *Reader) lastKey() (string, error) {
+	last := len(r.index) - 1
+	block, err := r.readBlock(last)
+	if err != nil {
+		return "", err
+	}
+	bi, err := newBlockIter(block, r.version)
+	if err != nil {
+		return "", corruption(r.filename, r.index[last].Offset, "%v", err)
+	}
+	key := r.index[last].key
+	for bi.next() {
+		key = bi.e.key
+	}
+	if bi.err != nil {
+		return "", corruption(r.filename, r.index[last].Offset, "%v", bi.err)
+	}
+	return key, nil
+}
+
+// Get looks up targetKey and returns the newest version in the table with the sequence number that wrote it
+// and when it expires
+func (r *Reader) Get(targetKey string) (val string, seq uint64, expiresAt int64, isTombstone bool, found bool, err error) {
+	return r.GetAt(targetKey, math.MaxUint64)
+}
+
+// GetAt returns the newest version of targetKey in the table written at or before readSeq
+func (r *Reader) GetAt(targetKey string, readSeq uint64) (val string, seq uint64, expiresAt int64, isTombstone bool, found bool, err error) {
+	if targetKey < r.smallest || targetKey > r.largest {
+		return "", 0, 0, false, false, nil
+	}
+	// Keys outside the range cannot be in the table, every key inside it may have been
+	if err := r.quarantined.Load(); err != nil {
+		return "", 0, 0, false, false, err
+	}
 	//bloom filter check
 	if !r.filter.MaybeContains([]byte(targetKey)) {
 		fmt.Printf(" [Bloom Filter] Blocked key '%s' (Saved disk seek!)\n", targetKey)
-		return "", false, false, nil
+		return "", 0, 0, false, false, nil
 	}
 	// BINARY SEARCH IN RAM - []IndexEntries
 	idx := sort.Search(len(r.index), func(i int) bool {
@@ -115,76 +193,129 @@ func (r *Reader) Get(targetKey string) (string, bool, bool, error) {
 	})
 
 	if idx == 0 {
-		return "", false, false, nil
+		return "", 0, 0, false, false, nil
 	}
 
-	// The target is in the previous block
-	blockStart := r.index[idx-1].Offset
+	// The target is in the previous block, every version of it
+	block, err := r.readBlock(idx - 1)
+	if err != nil {
+		return "", 0, 0, false, false, err
+	}
 
-	// DISK SEEK & SCAN
-	if _, err := r.file.Seek(blockStart, io.SeekStart); err != nil {
-		return "", false, false, err
+	// BINARY SEARCH OVER THE BLOCK'S RESTART POINTS, then a short scan
+	bi, err := newBlockIter(block, r.version)
+	if err != nil {
+		return "", 0, 0, false, false, r.quarantine(corruption(r.filename, r.index[idx-1].Offset, "%v", err))
+	}
+	// Sorted block: the first key >= target is either the newest version of the target or proof it is absent
+	ok := bi.seek(targetKey)
+	for ok && bi.e.key == targetKey && bi.e.seq > readSeq {
+		ok = bi.next()
+	}
+	if bi.err != nil {
+		return "", 0, 0, false, false, r.quarantine(corruption(r.filename, r.index[idx-1].Offset, "%v", bi.err))
+	}
+	if !ok || bi.e.key != targetKey {
+		return "", 0, 0, false, false, nil
 	}
+	if bi.e.isTombstone {
+		return "", bi.e.seq, 0, true, true, nil // Found, but deleted
+	}
+	return string(bi.e.value), bi.e.seq, bi.e.expiresAt, false, true, nil
+}
 
-	// LINEAR SCAN OF THE BLOCK
-	for {
-		var header [1]byte
-		if _, err := r.file.Read(header[:]); err != nil {
-			if err == io.EOF {
-				break
-			}
-			return "", false, false, err
+// readBlock returns data block i, from the block cache when possible.
+// ReadAt keeps concurrent lookups from racing on the file offset.
+func (r *Reader) readBlock(i int) ([]byte, error) {
+	if err := r.quarantined.Load(); err != nil {
+		return nil, err
+	}
+	start := r.index[i].Offset
+	end := r.dataEnd
+	if i+1 < len(r.index) {
+		end = r.index[i+1].Offset
+	}
+	key := blockKey{table: r.id, offset: start}
+	if r.cache != nil {
+		if block, ok := r.cache.get(key); ok {
+			return block, nil
 		}
-		isTombstone := header[0] == 1
+	}
+	raw := make([]byte, end-start)
+	if _, err := r.file.ReadAt(raw, start); err != nil {
+		return nil, err
+	}
+	block, err := r.decodeBlock(raw)
+	if err != nil {
+		return nil, r.quarantine(corruption(r.filename, start, "%v", err))
+	}
+	if r.cache != nil {
+		r.cache.put(key, block)
+	}
+	return block, nil
+}
 
-		// 2. Read Lengths (Key=2, Val=4)
-		var lenBuf [6]byte
-		if _, err := r.file.Read(lenBuf[:]); err != nil {
-			return "", false, false, err
-		}
+// decodeBlock verifies a block's trailer and returns the uncompressed entries
+func (r *Reader) decodeBlock(raw []byte) ([]byte, error) {
+	if r.version == 1 {
+		return raw, nil
+	}
+	if len(raw) < trailerSize {
+		return nil, errors.New("block shorter than its trailer")
+	}
+	stored := raw[:len(raw)-trailerSize]
+	codec := Codec(raw[len(stored)])
+	if blockChecksum(stored, codec) != binary.LittleEndian.Uint32(raw[len(stored)+1:]) {
+		return nil, errors.New("block checksum mismatch")
+	}
+	return decompressBlock(codec, stored)
+}
 
-		kLen := binary.LittleEndian.Uint16(lenBuf[0:2])
-		vLen := binary.LittleEndian.Uint32(lenBuf[2:6])
+// quarantine stops the reader from serving any more data and returns err
+func (r *Reader) quarantine(err *CorruptionError) error {
+	r.quarantined.CompareAndSwap(nil, err)
+	return err
+}
 
-		// 3. Read Key
-		keyBytes := make([]byte, kLen)
-		if _, err := r.file.Read(keyBytes); err != nil {
-			return "", false, false, err
-		}
-		currentKey := string(keyBytes)
-
-		// 4. CHECK MATCH
-		if currentKey == targetKey {
-			if isTombstone {
-				return "", true, true, nil // Found, but deleted
-			}
-			// Read Value
-			valBytes := make([]byte, vLen)
-			if _, err := r.file.Read(valBytes); err != nil {
-				return "", false, false, err
-			}
-
-			return string(valBytes), false, true, nil
-		}
+// Quarantined returns the corruption that took the table out of service, nil if it is healthy.
+// A quarantined table keeps failing reads of its key range until it is replaced.
+func (r *Reader) Quarantined() error {
+	if err := r.quarantined.Load(); err != nil {
+		return err
+	}
+	return nil
+}
 
-		// OPTIMIZATION: Sorted file!
-		// Sorted Array: currKey > target means key does not exist in block
-		if currentKey > targetKey {
-			return "", false, false, nil
-		}
+// Filename returns the path of the SSTable backing this reader
+func (r *Reader) Filename() string {
+	return r.filename
+}
 
-		// 5. Skip Value (Jump to next entry)
-		// If match failed, skip over the value bytes to get to next header
-		if !isTombstone {
-			if _, err := r.file.Seek(int64(vLen), io.SeekCurrent); err != nil {
-				return "", false, false, err
-			}
-		}
-	}
+// Size returns the size of the table file in bytes
+func (r *Reader) Size() int64 {
+	return r.size
+}
 
-	return "", false, false, nil // Not found in this block
+// KeyRange returns the smallest and largest key in the table
+func (r *Reader) KeyRange() (string, string) {
+	return r.smallest, r.largest
 }
 
+// Ref takes an extra reference, keeping the file open until the matching Close
+func (r *Reader) Ref() {
+	r.refs.Add(1)
+}
+
+// Close drops a reference and closes the file once none are left
 func (r *Reader) Close() error {
+	if r.refs.Add(-1) > 0 || r.file == nil {
+		return nil
+	}
 	return r.file.Close()
 }
+
+// IsCorruption reports whether err (or anything it wraps) is a *CorruptionError
+func IsCorruption(err error) bool {
+	var ce *CorruptionError
+	return errors.As(err, &ce)
+}
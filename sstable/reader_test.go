@@ -0,0 +1,212 @@
+package sstable
+
+import (
+	"KV-Store/pkg/bloom"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// buildTable writes entries, sorted by key and newest version first, to a table in a temporary directory
+func buildTable(t *testing.T, entries []testEntry) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "L0_000001.sst")
+	b, err := NewBuilder(path, len(entries))
+	if err != nil {
+		t.Fatalf("NewBuilder: %v", err)
+	}
+	for _, e := range entries {
+		if err := b.Add([]byte(e.key), []byte(e.val), e.seq, 0, e.isTombstone); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	if err := b.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return path
+}
+
+// numberedEntries returns n keys spread over several blocks
+func numberedEntries(n int) []testEntry {
+	entries := make([]testEntry, n)
+	for i := range entries {
+		entries[i] = testEntry{key: fmt.Sprintf("key%05d", i), val: fmt.Sprintf("value%05d", i), seq: uint64(i + 1)}
+	}
+	return entries
+}
+
+func TestReaderQuarantinesCorruptBlock(t *testing.T) {
+	path := buildTable(t, numberedEntries(2000))
+
+	// Flip a byte in the first data block
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[10] ^= 0xff
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenSSTable(path)
+	if err != nil {
+		t.Fatalf("OpenSSTable: %v", err)
+	}
+	defer r.Close()
+	if len(r.index) < 2 {
+		t.Fatalf("table has %d blocks, the test needs several", len(r.index))
+	}
+
+	// A healthy block still answers until the corruption is found
+	if val, _, _, _, found, err := r.Get("key01999"); err != nil || !found || val != "value01999" {
+		t.Fatalf("Get from a healthy block = %q found=%v err=%v", val, found, err)
+	}
+	if _, _, _, _, _, err := r.Get("key00000"); !IsCorruption(err) {
+		t.Fatalf("Get from the corrupt block = %v, want a CorruptionError", err)
+	}
+	if r.Quarantined() == nil {
+		t.Fatal("reader not quarantined after the corruption")
+	}
+
+	// From now on every key the table may hold fails, none silently reads as absent
+	for _, key := range []string{"key00000", "key01000", "key01999", "key00500x"} {
+		if _, _, _, _, found, err := r.Get(key); !IsCorruption(err) || found {
+			t.Errorf("Get(%q) on a quarantined table = found=%v err=%v, want a CorruptionError", key, found, err)
+		}
+	}
+	// Keys outside its range cannot be in it
+	for _, key := range []string{"a", "zzz"} {
+		if _, _, _, _, _, err := r.Get(key); err != nil {
+			t.Errorf("Get(%q) outside the key range = %v", key, err)
+		}
+	}
+
+	it, _ := r.NewIteratorAt("key00100")
+	if it.Valid || !IsCorruption(it.Err()) {
+		t.Errorf("iterator over a quarantined table: valid=%v err=%v", it.Valid, it.Err())
+	}
+	it.Close()
+	it, _ = r.NewIteratorAt("zzz")
+	if it.Valid || it.Err() != nil {
+		t.Errorf("iterator past the key range: valid=%v err=%v", it.Valid, it.Err())
+	}
+	it.Close()
+}
+
+func TestQuarantinedReader(t *testing.T) {
+	ce := corruption("L1_000007.sst", -1, "bad footer")
+	r := NewQuarantinedReader("L1_000007.sst", "b", "d", ce)
+	if _, _, _, _, _, err := r.Get("c"); !errors.Is(err, ce) {
+		t.Errorf("Get in range = %v, want %v", err, ce)
+	}
+	if _, _, _, _, found, err := r.Get("e"); err != nil || found {
+		t.Errorf("Get out of range = found=%v err=%v", found, err)
+	}
+	r.Ref()
+	if err := r.Close(); err != nil {
+		t.Errorf("Close = %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf("last Close = %v", err)
+	}
+}
+
+// writeV1Table writes entries the way tables were written before checksums: full-key entries,
+// no trailers and a bare [IndexOffset(8)][FilterOffset(8)] footer
+func writeV1Table(t *testing.T, entries []testEntry, perBlock int) string {
+	t.Helper()
+	var data, index []byte
+	filter := bloom.New(len(entries))
+	for i, e := range entries {
+		if i%perBlock == 0 {
+			index = binary.LittleEndian.AppendUint16(index, uint16(len(e.key)))
+			index = append(index, e.key...)
+			index = binary.LittleEndian.AppendUint64(index, uint64(len(data)))
+		}
+		filter.Add([]byte(e.key))
+		header := byte(0)
+		if e.isTombstone {
+			header = 1
+		}
+		data = append(data, header)
+		data = binary.LittleEndian.AppendUint16(data, uint16(len(e.key)))
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(e.val)))
+		data = append(data, e.key...)
+		data = append(data, e.val...)
+	}
+	indexOffset := len(data)
+	data = append(data, index...)
+	filterOffset := len(data)
+	data = append(data, filter.Bytes()...)
+	data = binary.LittleEndian.AppendUint64(data, uint64(indexOffset))
+	data = binary.LittleEndian.AppendUint64(data, uint64(filterOffset))
+
+	path := filepath.Join(t.TempDir(), "L0_1700000000.sst")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadVersion1Table(t *testing.T) {
+	entries := []testEntry{
+		{key: "apple", val: "red"},
+		{key: "banana", isTombstone: true},
+		{key: "cherry", val: "dark"},
+		{key: "grape", val: ""},
+		{key: "lemon", val: "sour"},
+	}
+	path := writeV1Table(t, entries, 2)
+	r, err := OpenSSTable(path)
+	if err != nil {
+		t.Fatalf("OpenSSTable: %v", err)
+	}
+	defer r.Close()
+	if r.version != 1 {
+		t.Fatalf("version = %d, want 1", r.version)
+	}
+	if lo, hi := r.KeyRange(); lo != "apple" || hi != "lemon" {
+		t.Errorf("KeyRange = %q, %q", lo, hi)
+	}
+
+	for _, e := range entries {
+		val, seq, _, isTombstone, found, err := r.Get(e.key)
+		if err != nil || !found || val != e.val || isTombstone != e.isTombstone || seq != 0 {
+			t.Errorf("Get(%q) = %q seq=%d tombstone=%v found=%v err=%v", e.key, val, seq, isTombstone, found, err)
+		}
+	}
+	if _, _, _, _, found, err := r.Get("date"); found || err != nil {
+		t.Errorf("Get of a missing key = found=%v err=%v", found, err)
+	}
+
+	it, _ := r.NewIteratorAt("c")
+	defer it.Close()
+	var keys []string
+	for ; it.Valid; it.Next() {
+		keys = append(keys, it.Key)
+	}
+	if fmt.Sprint(keys) != "[cherry grape lemon]" || it.Err() != nil {
+		t.Errorf("iterated %v, err %v", keys, it.Err())
+	}
+}
+
+func TestRejectUnknownVersion(t *testing.T) {
+	path := buildTable(t, numberedEntries(10))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Rewrite the version and reseal the footer so only the version is wrong
+	foot := data[len(data)-footerSize:]
+	binary.LittleEndian.PutUint32(foot[24:28], formatVersion+1)
+	binary.LittleEndian.PutUint32(foot[28:32], checksum(foot[0:28]))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenSSTable(path); err == nil {
+		t.Fatal("opened a table of an unknown format version")
+	}
+}
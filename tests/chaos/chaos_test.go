@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -26,6 +29,13 @@ func cleanupState() {
 	}
 	_ = os.RemoveAll("../../Storage/wal")
 	_ = os.RemoveAll("../../Storage/data")
+
+	// Nodes run in the test directory, which is where raft keeps its WAL and snapshot
+	for i := 0; i < 5; i++ {
+		_ = os.Remove(fmt.Sprintf("raf_wal_%d", i))
+		_ = os.Remove(fmt.Sprintf("raft_snapshot_%d", i))
+	}
+	_ = os.RemoveAll("Storage")
 }
 
 // TestLeaderFailoverDuringWrites validates Raft's durability guarantee:
@@ -177,3 +187,177 @@ func TestWritesDuringElection(t *testing.T) {
 		t.Log("✅ At most one node accepted writes during election")
 	}
 }
+
+// TestPartitionedNodeRejoin validates Pre-Vote:
+// a node cut off from the cluster must not bump its term and depose the leader when it comes back.
+func TestPartitionedNodeRejoin(t *testing.T) {
+	cleanupState()
+	binaryPath := getBinaryPath(t)
+
+	t.Log("=== Chaos Test: Partitioned Node Rejoin ===")
+
+	cluster := NewCluster(binaryPath)
+	if err := cluster.StartPartitionable(3); err != nil {
+		t.Fatalf("Failed to start cluster: %v", err)
+	}
+	defer cluster.Shutdown()
+
+	leader, err := cluster.WaitForLeader(10 * time.Second)
+	if err != nil {
+		t.Fatalf("No leader elected: %v", err)
+	}
+	term, err := cluster.GetTerm(leader)
+	if err != nil {
+		t.Fatalf("Failed to read leader term: %v", err)
+	}
+	t.Logf("Leader: Node %d in term %d", leader, term)
+
+	// Isolate a follower for several election timeouts
+	follower := (leader + 1) % 3
+	t.Logf("Partitioning Node %d...", follower)
+	cluster.Partition(follower)
+	time.Sleep(5 * time.Second)
+
+	if err := cluster.WriteKey("during_partition", "1"); err != nil {
+		t.Fatalf("Majority side rejected write: %v", err)
+	}
+	isolatedTerm, err := cluster.GetTerm(follower)
+	if err != nil {
+		t.Fatalf("Failed to read isolated node term: %v", err)
+	}
+	t.Logf("Isolated Node %d is in term %d", follower, isolatedTerm)
+	if isolatedTerm != term {
+		t.Errorf("Isolated node moved from term %d to %d while partitioned", term, isolatedTerm)
+	}
+
+	// Rejoin and give the node time to reconnect and catch up
+	t.Logf("Healing Node %d...", follower)
+	cluster.Heal(follower)
+
+	deadline := time.Now().Add(15 * time.Second)
+	caughtUp := false
+	for time.Now().Before(deadline) {
+		if val, found, _ := cluster.ReadKeyFromNode(follower, "during_partition"); found && val == "1" {
+			caughtUp = true
+			break
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	if !caughtUp {
+		t.Errorf("Node %d did not catch up after healing", follower)
+	}
+
+	newLeader, err := cluster.WaitForLeader(10 * time.Second)
+	if err != nil {
+		t.Fatalf("No leader after healing: %v", err)
+	}
+	newTerm, err := cluster.GetTerm(newLeader)
+	if err != nil {
+		t.Fatalf("Failed to read leader term: %v", err)
+	}
+	t.Logf("Leader after rejoin: Node %d in term %d", newLeader, newTerm)
+
+	if newLeader != leader || newTerm != term {
+		t.Errorf("LEADER DISRUPTED: Node %d (term %d) replaced by Node %d (term %d)", leader, term, newLeader, newTerm)
+	} else {
+		t.Log("✅ Rejoining node did not cause a leader change")
+	}
+}
+
+// TestLeaseReadsDuringTransfer checks that linearizable reads stay linearizable while leadership
+// moves around: a transfer target is elected without waiting out the old leader's lease, so the
+// old leader must stop serving reads from it. Every read has to see at least the last write
+// acknowledged before the read started.
+func TestLeaseReadsDuringTransfer(t *testing.T) {
+	cleanupState()
+	binaryPath := getBinaryPath(t)
+
+	t.Log("=== Chaos Test: Lease Reads During Leadership Transfer ===")
+
+	cluster := NewCluster(binaryPath)
+	if err := cluster.Start(3); err != nil {
+		t.Fatalf("Failed to start cluster: %v", err)
+	}
+	defer cluster.Shutdown()
+
+	leader, err := cluster.WaitForLeader(10 * time.Second)
+	if err != nil {
+		t.Fatalf("No leader elected: %v", err)
+	}
+	t.Logf("Leader elected: Node %d", leader)
+
+	var acked atomic.Int64
+	var reads, violations atomic.Int64
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for n := int64(1); ; n++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if cluster.WriteKey("lin", strconv.FormatInt(n, 10)) == nil {
+				acked.Store(n)
+			}
+		}
+	}()
+
+	for node := 0; node < 3; node++ {
+		wg.Add(1)
+		go func(node int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				before := acked.Load()
+				val, found, err := cluster.ReadKeyLinearizable(node, "lin")
+				if err != nil || !found {
+					continue
+				}
+				reads.Add(1)
+				if got, _ := strconv.ParseInt(val, 10, 64); got < before {
+					violations.Add(1)
+					t.Errorf("STALE READ via Node %d: got %d after %d was acknowledged", node, got, before)
+				}
+			}
+		}(node)
+	}
+
+	// Hand leadership around the cluster a few times while reads and writes run
+	transfers := 0
+	for i := 0; i < 6; i++ {
+		time.Sleep(time.Second)
+		current := cluster.GetLeader()
+		if current < 0 {
+			continue
+		}
+		target := (current + 1) % 3
+		if err := cluster.TransferLeader(current, target); err != nil {
+			t.Logf("Transfer from Node %d to Node %d: %v", current, target, err)
+			continue
+		}
+		transfers++
+		t.Logf("Transferred leadership from Node %d to Node %d", current, target)
+	}
+	time.Sleep(time.Second)
+	close(stop)
+	wg.Wait()
+
+	t.Logf("Reads: %d, last acknowledged write: %d, stale reads: %d", reads.Load(), acked.Load(), violations.Load())
+	if transfers == 0 {
+		t.Fatal("No leadership transfer succeeded")
+	}
+	if reads.Load() == 0 {
+		t.Fatal("No read succeeded during the transfers")
+	}
+	if violations.Load() == 0 {
+		t.Log("✅ No stale reads during leadership transfers")
+	}
+}
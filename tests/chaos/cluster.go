@@ -25,6 +25,7 @@ type Cluster struct {
 	Nodes      []*Node
 	mu         sync.Mutex
 	BinaryPath string
+	links      []*link
 }
 
 // NewCluster creates a new test cluster configuration
@@ -44,7 +45,56 @@ func (c *Cluster) Start(n int) error {
 	}
 	peerStr := strings.Join(rpcAddrs, ",")
 
+	return c.startNodes(n, func(int) string { return peerStr })
+}
+
+// StartPartitionable spawns n nodes that talk to each other through proxies,
+// so Partition and Heal can cut a node off from the rest of the cluster
+func (c *Cluster) StartPartitionable(n int) error {
+	peerStrs := make([]string, n)
+	for from := 0; from < n; from++ {
+		var rpcAddrs []string
+		for to := 0; to < n; to++ {
+			if from == to {
+				rpcAddrs = append(rpcAddrs, fmt.Sprintf("localhost:%d", 5001+to))
+				continue
+			}
+			lk, err := newLink(from, to,
+				fmt.Sprintf("localhost:%d", linkPort(from, to)),
+				fmt.Sprintf("localhost:%d", 5001+to))
+			if err != nil {
+				return err
+			}
+			c.links = append(c.links, lk)
+			rpcAddrs = append(rpcAddrs, fmt.Sprintf("localhost:%d", linkPort(from, to)))
+		}
+		peerStrs[from] = strings.Join(rpcAddrs, ",")
+	}
+
+	return c.startNodes(n, func(i int) string { return peerStrs[i] })
+}
+
+// Partition cuts every link to and from a node; the process keeps running
+func (c *Cluster) Partition(id int) {
+	for _, lk := range c.links {
+		if lk.From == id || lk.To == id {
+			lk.setBlocked(true)
+		}
+	}
+}
+
+// Heal restores every link to and from a node
+func (c *Cluster) Heal(id int) {
+	for _, lk := range c.links {
+		if lk.From == id || lk.To == id {
+			lk.setBlocked(false)
+		}
+	}
+}
+
+func (c *Cluster) startNodes(n int, peersFor func(id int) string) error {
 	for i := 0; i < n; i++ {
+		peerStr := peersFor(i)
 		httpPort := fmt.Sprintf("%d", 8001+i)
 		rpcPort := fmt.Sprintf("%d", 5001+i)
 
@@ -111,6 +161,9 @@ func (c *Cluster) Shutdown() {
 			_ = node.Process.Wait()
 		}
 	}
+	for _, lk := range c.links {
+		lk.close()
+	}
 }
 
 // GetLeader queries nodes to find the current leader
@@ -248,3 +301,76 @@ func (c *Cluster) LiveNodes() int {
 	}
 	return count
 }
+
+// GetTerm reads a node's current raft term from its metrics endpoint
+func (c *Cluster) GetTerm(nodeID int) (int, error) {
+	if nodeID >= len(c.Nodes) || c.Nodes[nodeID] == nil || c.Nodes[nodeID].Process == nil {
+		return -1, fmt.Errorf("node %d not available", nodeID)
+	}
+
+	url := fmt.Sprintf("http://localhost:%s/metrics", c.Nodes[nodeID].HTTPPort)
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return -1, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	prefix := fmt.Sprintf("raft_current_term{node_id=\"%d\"} ", nodeID)
+	for _, line := range strings.Split(string(body), "\n") {
+		if strings.HasPrefix(line, prefix) {
+			var term float64
+			if _, err := fmt.Sscanf(strings.TrimPrefix(line, prefix), "%g", &term); err != nil {
+				return -1, err
+			}
+			return int(term), nil
+		}
+	}
+	return -1, fmt.Errorf("node %d does not report raft_current_term", nodeID)
+}
+
+// ReadKeyLinearizable reads from a node with consistency=linearizable, which only its leader serves
+func (c *Cluster) ReadKeyLinearizable(nodeID int, key string) (string, bool, error) {
+	if nodeID >= len(c.Nodes) || c.Nodes[nodeID] == nil || c.Nodes[nodeID].Process == nil {
+		return "", false, fmt.Errorf("node %d not available", nodeID)
+	}
+
+	url := fmt.Sprintf("http://localhost:%s/get?key=%s&consistency=linearizable", c.Nodes[nodeID].HTTPPort, key)
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", false, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == 200 {
+		return string(body), true, nil
+	}
+	if resp.StatusCode == 404 {
+		return "", false, nil
+	}
+	return "", false, fmt.Errorf("read failed with %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// TransferLeader asks nodeID, which has to be the leader, to hand leadership to target
+func (c *Cluster) TransferLeader(nodeID, target int) error {
+	if nodeID >= len(c.Nodes) || c.Nodes[nodeID] == nil || c.Nodes[nodeID].Process == nil {
+		return fmt.Errorf("node %d not available", nodeID)
+	}
+
+	url := fmt.Sprintf("http://localhost:%s/admin/leader/transfer?id=%d", c.Nodes[nodeID].HTTPPort, target)
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Post(url, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("transfer failed with %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
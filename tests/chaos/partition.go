@@ -0,0 +1,105 @@
+package chaos
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// link is a TCP proxy carrying the gRPC traffic one node initiates towards another.
+// Every ordered pair of nodes gets its own link so a node can be cut off in both directions.
+type link struct {
+	From, To int
+	listener net.Listener
+	target   string
+
+	mu      sync.Mutex
+	blocked bool
+	conns   map[net.Conn]struct{}
+}
+
+func newLink(from, to int, listenAddr, target string) (*link, error) {
+	l, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for link %d->%d: %w", from, to, err)
+	}
+	lk := &link{
+		From:     from,
+		To:       to,
+		listener: l,
+		target:   target,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	go lk.serve()
+	return lk, nil
+}
+
+func (lk *link) serve() {
+	for {
+		client, err := lk.listener.Accept()
+		if err != nil {
+			return
+		}
+		lk.mu.Lock()
+		blocked := lk.blocked
+		lk.mu.Unlock()
+		if blocked {
+			_ = client.Close()
+			continue
+		}
+		go lk.proxy(client)
+	}
+}
+
+func (lk *link) proxy(client net.Conn) {
+	server, err := net.Dial("tcp", lk.target)
+	if err != nil {
+		_ = client.Close()
+		return
+	}
+	lk.track(client, server)
+
+	done := make(chan struct{}, 2)
+	go func() { _, _ = io.Copy(server, client); done <- struct{}{} }()
+	go func() { _, _ = io.Copy(client, server); done <- struct{}{} }()
+	<-done
+
+	_ = client.Close()
+	_ = server.Close()
+	lk.mu.Lock()
+	delete(lk.conns, client)
+	delete(lk.conns, server)
+	lk.mu.Unlock()
+}
+
+func (lk *link) track(conns ...net.Conn) {
+	lk.mu.Lock()
+	defer lk.mu.Unlock()
+	for _, c := range conns {
+		lk.conns[c] = struct{}{}
+	}
+}
+
+// setBlocked cuts or restores the link; cutting drops every open connection
+func (lk *link) setBlocked(blocked bool) {
+	lk.mu.Lock()
+	defer lk.mu.Unlock()
+	lk.blocked = blocked
+	if !blocked {
+		return
+	}
+	for c := range lk.conns {
+		_ = c.Close()
+	}
+}
+
+func (lk *link) close() {
+	_ = lk.listener.Close()
+	lk.setBlocked(true)
+}
+
+// linkPort is where node `from` reaches node `to` when the cluster runs behind links
+func linkPort(from, to int) int {
+	return 6000 + from*10 + to
+}